@@ -23,7 +23,9 @@ var ImplicitExcludes = []string{
 	earthlyIgnoreFile,
 }
 
-func readExcludes(dir string, noImplicitIgnore bool) ([]string, error) {
+// ReadExcludes returns the exclude patterns of a local build context dir, as read from its
+// .earthlyignore (or .earthignore) file, along with the implicit excludes.
+func ReadExcludes(dir string, noImplicitIgnore bool) ([]string, error) {
 	var ignoreFile = earthIgnoreFile
 
 	//earthIgnoreFile
@@ -84,7 +84,7 @@ func Test_readExcludes(t *testing.T) {
 				}
 			}
 
-			excludes, err := readExcludes(dir, testcase.noImplicitIgnore)
+			excludes, err := ReadExcludes(dir, testcase.noImplicitIgnore)
 			if err != testcase.expectedErr {
 				t.Logf("actual err: %v", err)
 				t.Logf("expected err: %v", testcase.expectedErr)
@@ -89,7 +89,7 @@ func (lr *localResolver) resolveLocal(ctx context.Context, gwClient gwclient.Cli
 	var buildContextFactory llbfactory.Factory
 	if _, isTarget := ref.(domain.Target); isTarget {
 		noImplicitIgnore := bf.ftrs != nil && bf.ftrs.NoImplicitIgnore
-		excludes, err := readExcludes(ref.GetLocalPath(), noImplicitIgnore)
+		excludes, err := ReadExcludes(ref.GetLocalPath(), noImplicitIgnore)
 		if err != nil {
 			return nil, err
 		}
@@ -2,12 +2,14 @@ package builder
 
 import (
 	"context"
+	"crypto"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/earthly/earthly/buildcontext"
 	"github.com/earthly/earthly/buildcontext/provider"
@@ -17,16 +19,24 @@ import (
 	"github.com/earthly/earthly/earthfile2llb"
 	"github.com/earthly/earthly/outmon"
 	"github.com/earthly/earthly/states"
+	"github.com/earthly/earthly/util/cachemount"
 	"github.com/earthly/earthly/util/containerutil"
 	"github.com/earthly/earthly/util/dockerutil"
+	"github.com/earthly/earthly/util/explaincache"
 	"github.com/earthly/earthly/util/gatewaycrafter"
 	"github.com/earthly/earthly/util/gwclientlogger"
+	"github.com/earthly/earthly/util/imagebudget"
+	"github.com/earthly/earthly/util/lastbuild"
 	"github.com/earthly/earthly/util/llbutil"
 	"github.com/earthly/earthly/util/llbutil/pllb"
 	"github.com/earthly/earthly/util/llbutil/secretprovider"
+	"github.com/earthly/earthly/util/ociartifact"
 	"github.com/earthly/earthly/util/platutil"
+	"github.com/earthly/earthly/util/provenance"
 	"github.com/earthly/earthly/util/saveartifactlocally"
+	"github.com/earthly/earthly/util/sbom"
 	"github.com/earthly/earthly/util/syncutil/semutil"
+	"github.com/earthly/earthly/util/watchutil"
 	"github.com/earthly/earthly/variables"
 	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/client/llb"
@@ -78,6 +88,35 @@ type Opt struct {
 	InternalSecretStore                   *secretprovider.MutableMapStore
 	InteractiveDebugging                  bool
 	InteractiveDebuggingDebugLevelLogging bool
+	KeepGoing                             bool
+	InvocationRecorder                    *lastbuild.Recorder
+	WatchSet                              *watchutil.Set
+	CacheMountRecorder                    *cachemount.Recorder
+	ExplainCacheRecorder                  *explaincache.Recorder
+	// ImageOutputDir is the OCI image layout dir which all output images are written into,
+	// instead of being loaded into the container frontend.
+	ImageOutputDir string
+	// OutputRoot is the dir which all the SAVE ARTIFACT ... AS LOCAL outputs are written under, if set.
+	OutputRoot string
+	// ChecksumManifest is the path of the checksum manifest of all the local artifacts to write, if set.
+	ChecksumManifest string
+	// ChecksumAlgorithm is the algorithm (sha256 or sha512) of the checksum manifest.
+	ChecksumAlgorithm string
+	// SBOMFormat is the format of the SBOMs to generate for all the output images, if any.
+	SBOMFormat string
+	// Provenance enables generating SLSA provenance statements for the output images and artifacts.
+	Provenance bool
+	// SigningKey is the key used to sign the images saved via SAVE IMAGE --sign, if configured.
+	SigningKey crypto.Signer
+	// SigningKeyErr is the error which occurred loading the signing key, if any.
+	SigningKeyErr error
+	// Registry configures the access to the registries of OCI artifacts, signatures and attestations.
+	// The credentials are those of the registry auth provider among Attachables.
+	Registry ociartifact.Registry
+	// SourceDateEpoch enables the reproducible mode, if set. See earthfile2llb.ConvertOpt.
+	SourceDateEpoch string
+	// OutputLock is the lock held while writing local outputs, until the end of the build.
+	OutputLock *saveartifactlocally.ProcessOutputLock
 }
 
 // BuildOpt is a collection of build options.
@@ -105,13 +144,15 @@ type Builder struct {
 
 	outDirOnce sync.Once
 	outDir     string
+
+	artifactOutputs []string
 }
 
 // NewBuilder returns a new earthly Builder.
 func NewBuilder(ctx context.Context, opt Opt) (*Builder, error) {
 	b := &Builder{
 		s: &solver{
-			sm:              outmon.NewSolverMonitor(opt.Console, opt.Verbose, opt.DisableNoOutputUpdates),
+			sm:              outmon.NewSolverMonitor(opt.Console, opt.Verbose, opt.DisableNoOutputUpdates, opt.ExplainCacheRecorder, opt.InvocationRecorder),
 			bkClient:        opt.BkClient,
 			cacheImports:    opt.CacheImports,
 			cacheExport:     opt.CacheExport,
@@ -128,7 +169,9 @@ func NewBuilder(ctx context.Context, opt Opt) (*Builder, error) {
 }
 
 // BuildTarget executes the build of a given Earthly target.
+// The output lock, if taken during the build, is released at the end of it.
 func (b *Builder) BuildTarget(ctx context.Context, target domain.Target, opt BuildOpt) (*states.MultiTarget, error) {
+	defer b.opt.OutputLock.Unlock()
 	mts, err := b.convertAndBuild(ctx, target, opt)
 	if err != nil {
 		return nil, err
@@ -136,6 +179,11 @@ func (b *Builder) BuildTarget(ctx context.Context, target domain.Target, opt Bui
 	return mts, nil
 }
 
+// ArtifactOutputs returns the local paths of the artifacts output by the build.
+func (b *Builder) ArtifactOutputs() []string {
+	return b.artifactOutputs
+}
+
 func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt BuildOpt) (*states.MultiTarget, error) {
 	var (
 		sharedLocalStateCache = earthfile2llb.NewSharedLocalStateCache()
@@ -144,17 +192,26 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 		platformImgNames      = make(map[string]bool)                  // ensure that these are unique
 		singPlatImgNames      = make(map[string]bool)                  // ensure that these are unique
 		exportCoordinator     = gatewaycrafter.NewExportCoordinator()
+		ociOutputs            = newOCIImageOutputs(b.tempEarthlyOutDir)
+		sbomCollector         = sbom.NewCollector()
+		provenanceCollector   *provenance.Collector
+		signedImages          = make(map[string]bool) // docker tag -> signed
 
 		// dirIDs maps a dirIndex to a dirID; the "dir-id" field was introduced
 		// to accomodate parallelism in the WAIT/END PopWaitBlock handling
 		dirIDs = map[int]string{}
 	)
+	if b.opt.Provenance {
+		provenanceCollector = provenance.NewCollector(opt.BuiltinArgs.EarthlyVersion, time.Now())
+	}
 	var (
 		depIndex   = 0
 		imageIndex = 0
 		dirIndex   = 0
 	)
 	var mts *states.MultiTarget
+	// failedTargetsErr is kept aside, as the error returned by bf loses its type when it crosses the buildkit session.
+	var failedTargetsErr *earthfile2llb.FailedTargetsError
 	bf := func(childCtx context.Context, gwClient gwclient.Client) (*gwclient.Result, error) {
 		if opt.EnableGatewayClientLogging {
 			gwClient = gwclientlogger.New(gwClient)
@@ -195,13 +252,31 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 				LocalArtifactWhiteList:               opt.LocalArtifactWhiteList,
 				InternalSecretStore:                  b.opt.InternalSecretStore,
 				TempEarthlyOutDir:                    b.tempEarthlyOutDir,
+				OutputLock:                           b.opt.OutputLock,
 				GlobalWaitBlockFtr:                   opt.GlobalWaitBlockFtr,
 				LLBCaps:                              &caps,
 				InteractiveDebuggerEnabled:           b.opt.InteractiveDebugging,
 				InteractiveDebuggerDebugLevelLogging: b.opt.InteractiveDebuggingDebugLevelLogging,
+				KeepGoing:                            b.opt.KeepGoing,
+				InvocationRecorder:                   b.opt.InvocationRecorder,
+				WatchSet:                             b.opt.WatchSet,
+				CacheMountRecorder:                   b.opt.CacheMountRecorder,
+				ExplainCacheRecorder:                 b.opt.ExplainCacheRecorder,
+				Registry:                             b.registry(ctx),
+				ImageOutputDir:                       b.opt.ImageOutputDir,
+				OutputRoot:                           b.opt.OutputRoot,
+				SBOMFormat:                           b.opt.SBOMFormat,
+				SBOMCollector:                        sbomCollector,
+				ProvenanceCollector:                  provenanceCollector,
+				SigningKey:                           b.opt.SigningKey,
+				SigningKeyErr:                        b.opt.SigningKeyErr,
+				SourceDateEpoch:                      b.opt.SourceDateEpoch,
 			}
 			mts, err = earthfile2llb.Earthfile2LLB(childCtx, target, opt, true)
 			if err != nil {
+				if fte, ok := earthfile2llb.GetFailedTargetsError(err); ok {
+					failedTargetsErr = fte
+				}
 				return nil, err
 			}
 		}
@@ -282,6 +357,25 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 				if err != nil {
 					return nil, err
 				}
+				if saveImage.SBOM != "" && saveImage.DockerTag != "" && (shouldExport || shouldPush) {
+					var platformStr string
+					if isMultiPlatform[saveImage.DockerTag] {
+						platformStr = sts.PlatformResolver.Materialize(sts.PlatformResolver.Current()).String()
+					}
+					err = b.addImageSBOM(childCtx, gwClient, sbomCollector, sts, saveImage, ref, platformStr, shouldExport, shouldPush)
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				var budget imagebudget.Budget
+				if saveImage.DockerTag != "" && (shouldExport || shouldPush) {
+					budget = saveImage.Budget
+					budget.DockerTag = saveImage.DockerTag
+					if isMultiPlatform[saveImage.DockerTag] {
+						budget.Platform = sts.PlatformResolver.Materialize(sts.PlatformResolver.Current()).String()
+					}
+				}
 
 				if !isMultiPlatform[saveImage.DockerTag] {
 					if saveImage.CheckDuplicate && saveImage.DockerTag != "" {
@@ -297,15 +391,33 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 					if err != nil {
 						return nil, err
 					}
+					gwCrafter.AddImageAnnotations(refPrefix, saveImage.Annotations)
 					imageIndex++
 
 					if shouldExport {
-						if b.opt.LocalRegistryAddr != "" {
+						if saveImage.OCITar != "" || b.opt.ImageOutputDir != "" {
+							exportCoordinator.AddOCIOutput(saveImage.DockerTag, gatewaycrafter.OCIOutputEntry{
+								DockerTag: saveImage.DockerTag,
+								TarPath:   saveImage.OCITar,
+								Dir:       b.opt.ImageOutputDir,
+							})
+							gwCrafter.AddMeta(fmt.Sprintf("%s/export-image", refPrefix), []byte("true"))
+						} else if b.opt.LocalRegistryAddr != "" {
 							gwCrafter.AddMeta(fmt.Sprintf("%s/export-image-local-registry", refPrefix), []byte(localRegPullID))
 						} else {
 							gwCrafter.AddMeta(fmt.Sprintf("%s/export-image", refPrefix), []byte("true"))
 						}
 					}
+					if budget.Enabled() {
+						// Images which are output locally are measured on their existing export: the tarball
+						// which is loaded or written out, or the image pulled from the local registry. Images
+						// which are only pushed are never available locally, so a tarball of them is exported
+						// in addition to the push, just for the check.
+						if !shouldExport {
+							gwCrafter.AddMeta(fmt.Sprintf("%s/export-image", refPrefix), []byte("true"))
+						}
+						exportCoordinator.AddImageBudget(saveImage.DockerTag, budget, !shouldExport)
+					}
 				} else {
 					resolvedPlat := sts.PlatformResolver.Materialize(sts.PlatformResolver.Current())
 					platformStr := resolvedPlat.String()
@@ -328,11 +440,18 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 
 					// For push.
 					if shouldPush {
-						_, err = gwCrafter.AddPushImageEntry(ref, imageIndex, saveImage.DockerTag, shouldPush, saveImage.InsecurePush, saveImage.Image, []byte(platformStr))
+						refPrefix, err := gwCrafter.AddPushImageEntry(ref, imageIndex, saveImage.DockerTag, shouldPush, saveImage.InsecurePush, saveImage.Image, []byte(platformStr))
 						if err != nil {
 							return nil, err
 						}
+						gwCrafter.AddImageAnnotations(refPrefix, saveImage.Annotations)
 						imageIndex++
+						if budget.Enabled() && !shouldExport {
+							// The image is only pushed, so a tarball of the manifest list is exported in
+							// addition to the push, just for the check of the budget of each platform.
+							gwCrafter.AddMeta(fmt.Sprintf("%s/export-image", refPrefix), []byte("true"))
+							exportCoordinator.AddImageBudget(saveImage.DockerTag, budget, true)
+						}
 					}
 
 					// For local.
@@ -341,8 +460,23 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 						if err != nil {
 							return nil, err
 						}
+						gwCrafter.AddImageAnnotations(refPrefix, saveImage.Annotations)
 						imageIndex++
+						if budget.Enabled() {
+							exportCoordinator.AddImageBudget(platformImgName, budget, false)
+						}
 
+						if saveImage.OCITar != "" || b.opt.ImageOutputDir != "" {
+							// The platforms are combined into a manifest list once they have all been exported.
+							exportCoordinator.AddOCIOutput(platformImgName, gatewaycrafter.OCIOutputEntry{
+								DockerTag:     saveImage.DockerTag,
+								MultiPlatform: true,
+								TarPath:       saveImage.OCITar,
+								Dir:           b.opt.ImageOutputDir,
+							})
+							gwCrafter.AddMeta(fmt.Sprintf("%s/export-image", refPrefix), []byte("true"))
+							continue
+						}
 						localRegPullID := exportCoordinator.AddImage(gwClient.BuildOpts().SessionID, platformImgName, nil)
 						if b.opt.LocalRegistryAddr != "" {
 							gwCrafter.AddMeta(fmt.Sprintf("%s/export-image-local-registry", refPrefix), []byte(localRegPullID))
@@ -424,7 +558,10 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 		}
 		return nil
 	}
-	onImage := func(childCtx context.Context, eg *errgroup.Group, imageName, waitFor, manifestKey string) (io.WriteCloser, error) {
+	loadImage := func(childCtx context.Context, eg *errgroup.Group, imageName, waitFor, manifestKey string) (io.WriteCloser, error) {
+		if ociOutput, ok := exportCoordinator.GetOCIOutput(imageName); ok {
+			return ociOutputs.onImage(eg, ociOutput)
+		}
 		pipeR, pipeW := io.Pipe()
 		eg.Go(func() error {
 			defer pipeR.Close()
@@ -439,6 +576,20 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 		})
 		return pipeW, nil
 	}
+	onImage := func(childCtx context.Context, eg *errgroup.Group, imageName, waitFor, manifestKey string) (io.WriteCloser, error) {
+		budgets, checkOnly := exportCoordinator.GetImageBudgets(imageName)
+		if len(budgets) == 0 {
+			return loadImage(childCtx, eg, imageName, waitFor, manifestKey)
+		}
+		if checkOnly {
+			return b.checkImageBudgets(eg, budgets), nil
+		}
+		w, err := loadImage(childCtx, eg, imageName, waitFor, manifestKey)
+		if err != nil {
+			return nil, err
+		}
+		return newTeeWriteCloser(w, b.checkImageBudgets(eg, budgets)), nil
+	}
 	onArtifact := func(childCtx context.Context, index string, artifact domain.Artifact, artifactPath string, destPath string) (string, error) {
 		if !opt.LocalArtifactWhiteList.Exists(destPath) {
 			return "", errors.Errorf("dest path %s is not in the whitelist: %+v", destPath, opt.LocalArtifactWhiteList.AsList())
@@ -479,6 +630,18 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 		if err != nil {
 			return err
 		}
+		for _, imageName := range pullMap {
+			// Images pulled from the local registry are measured once loaded, rather than exported
+			// again as a tarball.
+			budgets, _ := exportCoordinator.GetImageBudgets(imageName)
+			if len(budgets) == 0 {
+				continue
+			}
+			err = b.checkLoadedImageBudgets(childCtx, imageName, budgets)
+			if err != nil {
+				return err
+			}
+		}
 		for parentImageName, children := range manifests {
 			if opt.PlatformResolver == nil {
 				panic("platform resolver is nil")
@@ -495,6 +658,9 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 	}
 	err := b.s.buildMainMulti(ctx, bf, onImage, onArtifact, onFinalArtifact, onPull, PhaseBuild, b.opt.Console)
 	if err != nil {
+		if failedTargetsErr != nil {
+			return nil, failedTargetsErr
+		}
 		return nil, errors.Wrapf(err, "build main")
 	}
 	if opt.PrintPhases {
@@ -528,6 +694,23 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 	outputConsole := conslogging.NewBufferedLogger(&b.opt.Console)
 	outputPhaseSpecial := ""
 
+	err = ociOutputs.write(ctx, outputConsole)
+	if err != nil {
+		return nil, err
+	}
+	err = b.outputSBOMs(ctx, sbomCollector, opt.Push, outputConsole, pushConsole)
+	if err != nil {
+		return nil, err
+	}
+
+	if !opt.NoOutput {
+		// Prevent concurrent earthly invocations from interleaving their writes to the local outputs.
+		err = b.opt.OutputLock.Lock(ctx, b.opt.Console)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if opt.NoOutput {
 		// Nothing.
 	} else if opt.OnlyArtifact != nil {
@@ -538,7 +721,8 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 				return nil, err
 			}
 			err = saveartifactlocally.SaveArtifactLocally(
-				ctx, exportCoordinator, b.opt.Console, *opt.OnlyArtifact, outDir, opt.OnlyArtifactDestPath, mts.Final.ID, false)
+				ctx, exportCoordinator, b.opt.Console, *opt.OnlyArtifact, outDir, opt.OnlyArtifactDestPath, mts.Final.ID, false,
+				saveartifactlocally.SaveOpt{SyncDelete: true})
 			if err != nil {
 				return nil, err
 			}
@@ -555,6 +739,10 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 
 			if shouldPush {
 				exportCoordinator.AddPushedImageSummary(mts.Final.Target.StringCanonical(), saveImage.DockerTag, b.opt.Console.Salt(), true)
+				err = b.signImage(ctx, signedImages, saveImage, pushConsole)
+				if err != nil {
+					return nil, err
+				}
 			}
 			if saveImage.Push && !opt.Push {
 				exportCoordinator.AddPushedImageSummary(mts.Final.Target.StringCanonical(), saveImage.DockerTag, b.opt.Console.Salt(), false)
@@ -575,6 +763,10 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 				}
 				if shouldPush {
 					exportCoordinator.AddPushedImageSummary(sts.Target.StringCanonical(), saveImage.DockerTag, sts.ID, true)
+					err = b.signImage(ctx, signedImages, saveImage, pushConsole)
+					if err != nil {
+						return nil, err
+					}
 				}
 				if saveImage.Push && !opt.Push && !sts.Target.IsRemote() {
 					exportCoordinator.AddPushedImageSummary(sts.Target.StringCanonical(), saveImage.DockerTag, sts.ID, false)
@@ -596,8 +788,7 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 						Target:   sts.Target,
 						Artifact: saveLocal.ArtifactPath,
 					}
-					err = saveartifactlocally.SaveArtifactLocally(
-						ctx, exportCoordinator, b.opt.Console, artifact, artifactDir, saveLocal.DestPath, sts.ID, saveLocal.IfExists)
+					err = b.saveArtifactLocally(ctx, exportCoordinator, artifact, artifactDir, saveLocal, sts.ID)
 					if err != nil {
 						return nil, err
 					}
@@ -621,8 +812,7 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 							Target:   sts.Target,
 							Artifact: saveLocal.ArtifactPath,
 						}
-						err = saveartifactlocally.SaveArtifactLocally(
-							ctx, exportCoordinator, b.opt.Console, artifact, artifactDir, saveLocal.DestPath, sts.ID, saveLocal.IfExists)
+						err = b.saveArtifactLocally(ctx, exportCoordinator, artifact, artifactDir, saveLocal, sts.ID)
 						if err != nil {
 							return nil, err
 						}
@@ -653,9 +843,28 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 	}
 
 	for _, artifactEntry := range exportCoordinator.GetArtifactSummary() {
+		b.artifactOutputs = append(b.artifactOutputs, artifactEntry.Path)
 		console := b.opt.Console.WithPrefixAndSalt(artifactEntry.Target, artifactEntry.Salt)
 		targetStr := console.PrefixColor().Sprintf("%s", artifactEntry.Target)
-		outputConsole.Printf("Artifact %s output as %s\n", targetStr, artifactEntry.Path)
+		if artifactEntry.Changes != "" {
+			outputConsole.Printf("Artifact %s output as %s (%s)\n", targetStr, artifactEntry.Path, artifactEntry.Changes)
+		} else {
+			outputConsole.Printf("Artifact %s output as %s\n", targetStr, artifactEntry.Path)
+		}
+	}
+	if b.opt.OutputRoot != "" && !opt.NoOutput {
+		err = saveartifactlocally.WriteOutputManifest(b.opt.OutputRoot, exportCoordinator.GetArtifactSummary())
+		if err != nil {
+			return nil, err
+		}
+		outputConsole.Printf("Output manifest written to %s\n", filepath.Join(b.opt.OutputRoot, saveartifactlocally.OutputManifestName))
+	}
+	if b.opt.ChecksumManifest != "" && !opt.NoOutput {
+		err = saveartifactlocally.WriteChecksumManifest(b.opt.ChecksumManifest, b.opt.ChecksumAlgorithm, exportCoordinator.GetArtifactSummary())
+		if err != nil {
+			return nil, err
+		}
+		outputConsole.Printf("Checksum manifest written to %s\n", b.opt.ChecksumManifest)
 	}
 	for _, outputEntry := range exportCoordinator.GetLocalOutputSummary() {
 		console := b.opt.Console.WithPrefixAndSalt(outputEntry.Target, outputEntry.Salt)
@@ -685,6 +894,12 @@ func (b *Builder) convertAndBuild(ctx context.Context, target domain.Target, opt
 			return nil, err
 		}
 	}
+	if provenanceCollector != nil {
+		err = b.outputProvenance(ctx, provenanceCollector, exportCoordinator, opt.Push)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if opt.PrintPhases {
 		b.opt.Console.PrintPhaseFooter(PhaseOutput, false, "")
 		b.opt.Console.PrintSuccess()
@@ -699,6 +914,58 @@ func (b *Builder) targetPhaseState(sts *states.SingleTarget) pllb.State {
 	return sts.MainState
 }
 
+// signImage signs a pushed image of SAVE IMAGE --sign, unless it has already been signed.
+func (b *Builder) signImage(ctx context.Context, signed map[string]bool, saveImage states.SaveImage, console *conslogging.BufferedLogger) error {
+	if !saveImage.Sign || signed[saveImage.DockerTag] {
+		return nil
+	}
+	signed[saveImage.DockerTag] = true
+	if b.opt.SigningKeyErr != nil {
+		return errors.Wrapf(b.opt.SigningKeyErr, "cannot sign image %s", saveImage.DockerTag)
+	}
+	if b.opt.SigningKey == nil {
+		return errors.Errorf("cannot sign image %s: no signing key is configured (set global.signing_key or EARTHLY_SIGNING_KEY)", saveImage.DockerTag)
+	}
+	reg := b.registry(ctx)
+	if saveImage.InsecurePush {
+		var err error
+		reg, err = reg.WithPlainHTTP(saveImage.DockerTag)
+		if err != nil {
+			return err
+		}
+	}
+	dgst, err := ociartifact.Sign(ctx, saveImage.DockerTag, b.opt.SigningKey, reg)
+	if err != nil {
+		return errors.Wrapf(err, "failed to sign image %s", saveImage.DockerTag)
+	}
+	console.Printf("Signed image %s (%s)\n", saveImage.DockerTag, dgst)
+	return nil
+}
+
+// registry returns the registry config used for OCI artifacts, signatures and attestations.
+func (b *Builder) registry(ctx context.Context) ociartifact.Registry {
+	reg := b.opt.Registry
+	reg.Creds = ociartifact.CredentialsFromAttachables(ctx, b.opt.Attachables)
+	return reg
+}
+
+// saveArtifactLocally saves an exported artifact to local disk or, for SAVE ARTIFACT ... AS OCI, pushes it to the registry.
+func (b *Builder) saveArtifactLocally(ctx context.Context, exportCoordinator *gatewaycrafter.ExportCoordinator, artifact domain.Artifact, artifactDir string, saveLocal states.SaveLocal, salt string) error {
+	if saveLocal.OCIRef != "" {
+		return ociartifact.PushArtifact(
+			ctx, b.opt.Console, artifact, artifactDir, saveLocal.OCIRef, saveLocal.MediaType, saveLocal.IfExists,
+			b.registry(ctx))
+	}
+	return saveartifactlocally.SaveArtifactLocally(
+		ctx, exportCoordinator, b.opt.Console, artifact, artifactDir, saveLocal.DestPath, salt, saveLocal.IfExists,
+		saveartifactlocally.SaveOpt{
+			Archive:    saveLocal.Archive,
+			KeepTs:     saveLocal.KeepTs,
+			SyncDelete: saveLocal.SyncDelete,
+			Checksum:   saveLocal.Checksum,
+		})
+}
+
 func (b *Builder) targetPhaseArtifacts(sts *states.SingleTarget) []states.SaveLocal {
 	if b.builtMain {
 		return sts.RunPush.SaveLocals
@@ -738,20 +1005,38 @@ func (b *Builder) tempEarthlyOutDir() (string, error) {
 	var err error
 	b.outDirOnce.Do(func() {
 		tmpParentDir := ".tmp-earthly-out"
+		// The parent dir is shared with the concurrent earthly invocations in the same dir: hold a shared lock
+		// on it while in use, such that another invocation does not remove it from under us.
+		var parentLock *saveartifactlocally.OutputLock
+		parentLock, err = saveartifactlocally.NewOutputLock(tmpParentDir)
+		if err != nil {
+			return
+		}
+		err = parentLock.RLock(context.Background(), b.opt.Console)
+		if err != nil {
+			return
+		}
 		err = os.MkdirAll(tmpParentDir, 0755)
 		if err != nil {
+			parentLock.Unlock()
 			err = errors.Wrapf(err, "unable to create dir %s", tmpParentDir)
 			return
 		}
 		b.outDir, err = os.MkdirTemp(tmpParentDir, "tmp")
 		if err != nil {
+			parentLock.Unlock()
 			err = errors.Wrap(err, "mk temp dir for artifacts")
 			return
 		}
 		b.opt.CleanCollection.Add(func() error {
 			remErr := os.RemoveAll(b.outDir)
-			// Remove the parent dir only if it's empty.
-			_ = os.Remove(tmpParentDir)
+			_ = parentLock.Unlock()
+			// Remove the parent dir only if it's empty, and not about to be used by another invocation.
+			locked, _ := parentLock.TryLock()
+			if locked {
+				_ = os.Remove(tmpParentDir)
+				_ = parentLock.Unlock()
+			}
 			return remErr
 		})
 	})
@@ -0,0 +1,94 @@
+package builder
+
+import (
+	"context"
+	"io"
+
+	"github.com/earthly/earthly/util/imagebudget"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// checkImageBudgets returns the writer which the image tarball exported by buildkit is streamed into, to be
+// checked against the budgets set via SAVE IMAGE --max-size and --max-layers.
+func (b *Builder) checkImageBudgets(eg *errgroup.Group, budgets []imagebudget.Budget) io.WriteCloser {
+	pipeR, pipeW := io.Pipe()
+	eg.Go(func() error {
+		defer pipeR.Close()
+		reports, err := imagebudget.CheckAll(pipeR, budgets)
+		// Drain the rest of the tarball, so that the other consumers of the stream are not blocked.
+		_, _ = io.Copy(io.Discard, pipeR)
+		if err != nil {
+			return errors.Wrapf(err, "check size of image %s", budgets[0].DockerTag)
+		}
+		return b.handleImageBudgetReports(reports)
+	})
+	return pipeW
+}
+
+// checkLoadedImageBudgets checks the image imageName, which has been loaded into the container frontend, against
+// the budgets, based on the size and the layers reported by the frontend.
+func (b *Builder) checkLoadedImageBudgets(ctx context.Context, imageName string, budgets []imagebudget.Budget) error {
+	infos, err := b.opt.ContainerFrontend.ImageInfo(ctx, imageName)
+	if err != nil {
+		return errors.Wrapf(err, "inspect image %s", imageName)
+	}
+	info, ok := infos[imageName]
+	if !ok || info.ID == "" {
+		return errors.Errorf("check size of image %s: image not found", imageName)
+	}
+	layers := make([]digest.Digest, 0, len(info.Layers))
+	for _, l := range info.Layers {
+		layers = append(layers, digest.Digest(l))
+	}
+	reports := make([]*imagebudget.Report, 0, len(budgets))
+	for _, budget := range budgets {
+		reports = append(reports, imagebudget.CheckLayers(budget, info.Size, layers))
+	}
+	return b.handleImageBudgetReports(reports)
+}
+
+// handleImageBudgetReports prints the reports of the images which exceed a --warn-only budget, and returns an
+// error for the first image which exceeds its budget otherwise.
+func (b *Builder) handleImageBudgetReports(reports []*imagebudget.Report) error {
+	for _, report := range reports {
+		if !report.Exceeded() {
+			continue
+		}
+		if report.Budget.WarnOnly {
+			b.opt.Console.WithPrefix("output").Warnf("%s", report.String())
+			continue
+		}
+		return errors.New(report.String())
+	}
+	return nil
+}
+
+// teeWriteCloser writes to all of its writers, and closes all of them.
+type teeWriteCloser struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func newTeeWriteCloser(wcs ...io.WriteCloser) io.WriteCloser {
+	ret := &teeWriteCloser{}
+	writers := make([]io.Writer, 0, len(wcs))
+	for _, wc := range wcs {
+		writers = append(writers, wc)
+		ret.closers = append(ret.closers, wc)
+	}
+	ret.Writer = io.MultiWriter(writers...)
+	return ret
+}
+
+func (t *teeWriteCloser) Close() error {
+	var retErr error
+	for _, c := range t.closers {
+		err := c.Close()
+		if err != nil && retErr == nil {
+			retErr = err
+		}
+	}
+	return retErr
+}
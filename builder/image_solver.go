@@ -50,9 +50,9 @@ func (s *tarImageSolver) newSolveOpt(img *image.Image, dockerTag string, w io.Wr
 	if err != nil {
 		return nil, errors.Wrap(err, "image json marshal")
 	}
-	var cacheImports []client.CacheOptionsEntry
-	for _, ci := range s.cacheImports.AsSlice() {
-		cacheImports = append(cacheImports, newCacheImportOpt(ci))
+	cacheImports, err := newCacheImportOpts(s.cacheImports.AsSlice())
+	if err != nil {
+		return nil, err
 	}
 	return &client.SolveOpt{
 		Exports: []client.ExportEntry{
@@ -296,9 +296,9 @@ func (m *multiImageSolver) SolveImages(ctx context.Context, imageDefs []*states.
 		doneChan   = make(chan struct{})
 	)
 
-	var cacheImports []client.CacheOptionsEntry
-	for _, ci := range m.cacheImports.AsSlice() {
-		cacheImports = append(cacheImports, newCacheImportOpt(ci))
+	cacheImports, err := newCacheImportOpts(m.cacheImports.AsSlice())
+	if err != nil {
+		return nil, err
 	}
 
 	solveOpt := &client.SolveOpt{
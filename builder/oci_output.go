@@ -0,0 +1,166 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/earthly/earthly/conslogging"
+	"github.com/earthly/earthly/util/gatewaycrafter"
+	"github.com/earthly/earthly/util/ocilayout"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// ociImageOutputs collects the exported images which are written to the host as OCI image layouts
+// or tarballs, instead of being loaded into the container frontend.
+type ociImageOutputs struct {
+	mu         sync.Mutex
+	tempDir    func() (string, error)
+	staging    *ocilayout.Layout
+	images     map[string]*ociImageOutput // DockerTag -> image
+	tarLayouts int
+}
+
+type ociImageOutput struct {
+	entry     gatewaycrafter.OCIOutputEntry
+	manifests []ocispec.Descriptor
+}
+
+func newOCIImageOutputs(tempDir func() (string, error)) *ociImageOutputs {
+	return &ociImageOutputs{
+		tempDir: tempDir,
+		images:  map[string]*ociImageOutput{},
+	}
+}
+
+func (o *ociImageOutputs) stagingLayout() (*ocilayout.Layout, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.staging != nil {
+		return o.staging, nil
+	}
+	outDir, err := o.tempDir()
+	if err != nil {
+		return nil, err
+	}
+	o.staging, err = ocilayout.Open(filepath.Join(outDir, "oci-staging"))
+	if err != nil {
+		return nil, err
+	}
+	return o.staging, nil
+}
+
+// onImage returns the writer which the image tarball exported by buildkit is streamed into.
+func (o *ociImageOutputs) onImage(eg *errgroup.Group, entry gatewaycrafter.OCIOutputEntry) (io.WriteCloser, error) {
+	staging, err := o.stagingLayout()
+	if err != nil {
+		return nil, err
+	}
+	pipeR, pipeW := io.Pipe()
+	eg.Go(func() error {
+		defer pipeR.Close()
+		manifests, err := staging.Import(pipeR)
+		if err != nil {
+			return errors.Wrapf(err, "import image %s", entry.DockerTag)
+		}
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		img, ok := o.images[entry.DockerTag]
+		if !ok {
+			img = &ociImageOutput{entry: entry}
+			o.images[entry.DockerTag] = img
+		}
+		if !entry.MultiPlatform {
+			img.manifests = nil
+		}
+	Manifests:
+		for _, m := range manifests {
+			for _, existing := range img.manifests {
+				if existing.Digest == m.Digest {
+					continue Manifests
+				}
+			}
+			img.manifests = append(img.manifests, m)
+		}
+		return nil
+	})
+	return pipeW, nil
+}
+
+// write writes all the collected images to their OCI layout dirs and tarballs.
+func (o *ociImageOutputs) write(ctx context.Context, console *conslogging.BufferedLogger) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	dockerTags := make([]string, 0, len(o.images))
+	for dockerTag := range o.images {
+		dockerTags = append(dockerTags, dockerTag)
+	}
+	sort.Strings(dockerTags)
+	for _, dockerTag := range dockerTags {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		img := o.images[dockerTag]
+		if len(img.manifests) == 0 {
+			continue
+		}
+		desc := img.manifests[0]
+		if img.entry.MultiPlatform {
+			var err error
+			desc, err = o.staging.AddIndex(img.manifests)
+			if err != nil {
+				return errors.Wrapf(err, "create manifest list for %s", dockerTag)
+			}
+		}
+		if img.entry.Dir != "" {
+			dst, err := ocilayout.Open(img.entry.Dir)
+			if err != nil {
+				return err
+			}
+			err = o.writeToLayout(dst, dockerTag, desc)
+			if err != nil {
+				return err
+			}
+			console.Printf("Image %s written to OCI layout %s\n", dockerTag, img.entry.Dir)
+		}
+		if img.entry.TarPath != "" {
+			outDir, err := o.tempDir()
+			if err != nil {
+				return err
+			}
+			dst, err := ocilayout.Open(filepath.Join(outDir, fmt.Sprintf("oci-tar-%d", o.tarLayouts)))
+			if err != nil {
+				return err
+			}
+			o.tarLayouts++
+			err = o.writeToLayout(dst, dockerTag, desc)
+			if err != nil {
+				return err
+			}
+			err = dst.WriteTarFile(img.entry.TarPath)
+			if err != nil {
+				return errors.Wrapf(err, "write image %s to %s", dockerTag, img.entry.TarPath)
+			}
+			console.Printf("Image %s written to OCI tarball %s\n", dockerTag, img.entry.TarPath)
+		}
+	}
+	o.images = map[string]*ociImageOutput{}
+	return nil
+}
+
+func (o *ociImageOutputs) writeToLayout(dst *ocilayout.Layout, dockerTag string, desc ocispec.Descriptor) error {
+	err := o.staging.Copy(dst, desc)
+	if err != nil {
+		return errors.Wrapf(err, "copy image %s to %s", dockerTag, dst.Dir())
+	}
+	err = dst.Tag(dockerTag, desc)
+	if err != nil {
+		return errors.Wrapf(err, "tag image %s in %s", dockerTag, dst.Dir())
+	}
+	return nil
+}
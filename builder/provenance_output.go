@@ -0,0 +1,134 @@
+package builder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/earthly/earthly/util/gatewaycrafter"
+	"github.com/earthly/earthly/util/ociartifact"
+	"github.com/earthly/earthly/util/provenance"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// outputProvenance writes the provenance statements of the images and artifacts output by the build to the
+// host and, when pushing, attaches them to the pushed images.
+func (b *Builder) outputProvenance(ctx context.Context, collector *provenance.Collector, exportCoordinator *gatewaycrafter.ExportCoordinator, push bool) error {
+	finished := time.Now()
+	reg := b.registry(ctx)
+
+	pushed := make(map[string]bool) // docker tag -> pushed
+	if push {
+		for _, e := range exportCoordinator.GetPushedImageSummary() {
+			if _, ok := collector.Target(e.Salt); !ok || !e.Pushed {
+				continue
+			}
+			pushed[e.DockerTag] = true
+			predicate, err := collector.Predicate(e.Salt, finished)
+			if err != nil {
+				return err
+			}
+			_, err = ociartifact.Attach(ctx, e.DockerTag, nil, ociartifact.Attestation{
+				PredicateType: provenance.PredicateType,
+				Predicate:     predicate,
+			}, reg)
+			if err != nil {
+				return errors.Wrapf(err, "attach provenance to %s", e.DockerTag)
+			}
+			b.opt.Console.Printf("Attached provenance to image %s\n", e.DockerTag)
+		}
+	}
+
+	for _, e := range exportCoordinator.GetLocalOutputSummary() {
+		target, ok := collector.Target(e.Salt)
+		if !ok {
+			continue
+		}
+		predicate, err := collector.Predicate(e.Salt, finished)
+		if err != nil {
+			return err
+		}
+		subject := ociartifact.InTotoSubject{Name: e.DockerTag}
+		dgst, err := b.imageDigest(ctx, e.DockerTag, pushed[e.DockerTag], reg)
+		if err != nil {
+			return err
+		}
+		if dgst != "" {
+			subject.Digest = map[string]string{dgst.Algorithm().String(): dgst.Encoded()}
+		}
+		localPath := provenance.ImageLocalPath(target.LocalPath, e.DockerTag)
+		err = writeProvenance(localPath, []ociartifact.InTotoSubject{subject}, predicate)
+		if err != nil {
+			return err
+		}
+		b.opt.Console.Printf("Provenance of image %s output as %s\n", e.DockerTag, localPath)
+	}
+
+	for _, e := range exportCoordinator.GetArtifactSummary() {
+		if _, ok := collector.Target(e.Salt); !ok {
+			continue
+		}
+		predicate, err := collector.Predicate(e.Salt, finished)
+		if err != nil {
+			return err
+		}
+		subjects, err := provenance.FileSubjects(e.Path)
+		if err != nil {
+			return err
+		}
+		localPath := provenance.ArtifactLocalPath(e.Path)
+		err = writeProvenance(localPath, subjects, predicate)
+		if err != nil {
+			return err
+		}
+		b.opt.Console.Printf("Provenance of artifact %s output as %s\n", e.Path, localPath)
+	}
+	return nil
+}
+
+// imageDigest returns the digest of an output image: the digest of its manifest in the registry if it was
+// pushed, or else its ID in the container frontend. It returns an empty digest if neither is known.
+func (b *Builder) imageDigest(ctx context.Context, dockerTag string, pushed bool, reg ociartifact.Registry) (digest.Digest, error) {
+	if pushed {
+		desc, err := ociartifact.ResolveImage(ctx, dockerTag, nil, reg)
+		if err != nil {
+			return "", err
+		}
+		return desc.Digest, nil
+	}
+	if b.opt.ContainerFrontend == nil || b.opt.ImageOutputDir != "" {
+		return "", nil
+	}
+	infos, err := b.opt.ContainerFrontend.ImageInfo(ctx, dockerTag)
+	if err != nil {
+		return "", errors.Wrapf(err, "get info of image %s", dockerTag)
+	}
+	info, ok := infos[dockerTag]
+	if !ok || info.ID == "" {
+		return "", nil
+	}
+	dgst, err := digest.Parse(info.ID)
+	if err != nil {
+		return "", nil
+	}
+	return dgst, nil
+}
+
+func writeProvenance(localPath string, subjects []ociartifact.InTotoSubject, predicate []byte) error {
+	dt, err := ociartifact.Statement(provenance.PredicateType, subjects, predicate)
+	if err != nil {
+		return err
+	}
+	p := filepath.FromSlash(localPath)
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return errors.Wrapf(err, "create dir for provenance %s", p)
+	}
+	err = os.WriteFile(p, dt, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "write provenance %s", p)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package builder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/earthly/earthly/conslogging"
+	"github.com/earthly/earthly/states"
+	"github.com/earthly/earthly/util/ociartifact"
+	"github.com/earthly/earthly/util/sbom"
+	gwclient "github.com/moby/buildkit/frontend/gateway/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// addImageSBOM generates the SBOM of a solved image, to be written locally and attached to the pushed image.
+func (b *Builder) addImageSBOM(ctx context.Context, gwClient gwclient.Client, collector *sbom.Collector, sts *states.SingleTarget, saveImage states.SaveImage, ref gwclient.Reference, platform string, shouldExport, shouldPush bool) error {
+	var localPath string
+	if shouldExport {
+		localPath = sbom.LocalPath(sts.Target.LocalPath, saveImage.OCITar, saveImage.DockerTag, platform, saveImage.SBOM)
+	}
+	var workDir string
+	created := time.Now()
+	if saveImage.Image != nil {
+		workDir = saveImage.Image.Config.WorkingDir
+		if saveImage.Image.Created != nil {
+			// Reproducible mode: use the source date epoch, as for the image itself.
+			created = *saveImage.Image.Created
+		}
+	}
+	return collector.AddImage(ctx, sbom.GenerateOpt{
+		GwClient:         gwClient,
+		Ref:              ref,
+		State:            saveImage.State,
+		PlatformResolver: sts.PlatformResolver,
+		Name:             saveImage.DockerTag,
+		Format:           saveImage.SBOM,
+		WorkDir:          workDir,
+		Created:          created,
+	}, sbom.Entry{
+		Target:    sts.Target.StringCanonical(),
+		Salt:      sts.ID,
+		DockerTag: saveImage.DockerTag,
+		Platform:  platform,
+		LocalPath: localPath,
+		Push:      shouldPush,
+	})
+}
+
+// outputSBOMs writes the generated SBOMs to the host and, when pushing, attaches them to the pushed images.
+func (b *Builder) outputSBOMs(ctx context.Context, collector *sbom.Collector, push bool, outputConsole, pushConsole *conslogging.BufferedLogger) error {
+	for _, e := range collector.Entries() {
+		if e.LocalPath != "" {
+			p := filepath.FromSlash(e.LocalPath)
+			err := os.MkdirAll(filepath.Dir(p), 0755)
+			if err != nil {
+				return errors.Wrapf(err, "create dir for sbom %s", p)
+			}
+			err = os.WriteFile(p, e.Document, 0644)
+			if err != nil {
+				return errors.Wrapf(err, "write sbom %s", p)
+			}
+			outputConsole.Printf("SBOM of image %s output as %s\n", e.DockerTag, p)
+		}
+		if e.Push && push {
+			var platform *ocispec.Platform
+			if e.Platform != "" {
+				p, err := platforms.Parse(e.Platform)
+				if err != nil {
+					return errors.Wrapf(err, "parse platform %s", e.Platform)
+				}
+				platform = &p
+			}
+			_, err := ociartifact.Attach(ctx, e.DockerTag, platform, ociartifact.Attestation{
+				PredicateType: sbom.PredicateType(e.Format),
+				Predicate:     e.Document,
+			}, b.registry(ctx))
+			if err != nil {
+				return errors.Wrapf(err, "attach sbom to %s", e.DockerTag)
+			}
+			pushConsole.Printf("Attached SBOM to image %s\n", e.DockerTag)
+		}
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/earthly/earthly/outmon"
 	"github.com/earthly/earthly/states"
 	"github.com/earthly/earthly/util/fsutilprogress"
+	"github.com/earthly/earthly/util/llbutil"
 	"github.com/moby/buildkit/client"
 	gwclient "github.com/moby/buildkit/frontend/gateway/client"
 	"github.com/moby/buildkit/session"
@@ -71,16 +72,24 @@ func (s *solver) buildMainMulti(ctx context.Context, bf gwclient.BuildFunc, onIm
 }
 
 func (s *solver) newSolveOptMulti(ctx context.Context, eg *errgroup.Group, onImage onImageFunc, onArtifact onArtifactFunc, onFinalArtifact onFinalArtifactFunc, onPullCallback pullping.PullCallback, console conslogging.ConsoleLogger) (*client.SolveOpt, error) {
-	var cacheImports []client.CacheOptionsEntry
-	for _, ci := range s.cacheImports.AsSlice() {
-		cacheImports = append(cacheImports, newCacheImportOpt(ci))
+	cacheImports, err := newCacheImportOpts(s.cacheImports.AsSlice())
+	if err != nil {
+		return nil, err
 	}
 	var cacheExports []client.CacheOptionsEntry
 	if s.cacheExport != "" {
-		cacheExports = append(cacheExports, newCacheExportOpt(s.cacheExport, false))
+		cacheExport, err := newCacheExportOpt(s.cacheExport, false)
+		if err != nil {
+			return nil, err
+		}
+		cacheExports = append(cacheExports, cacheExport)
 	}
 	if s.maxCacheExport != "" {
-		cacheExports = append(cacheExports, newCacheExportOpt(s.maxCacheExport, true))
+		cacheExport, err := newCacheExportOpt(s.maxCacheExport, true)
+		if err != nil {
+			return nil, err
+		}
+		cacheExports = append(cacheExports, cacheExport)
 	}
 	if s.saveInlineCache {
 		cacheExports = append(cacheExports, newInlineCacheOpt())
@@ -131,25 +140,31 @@ func (s *solver) newSolveOptMulti(ctx context.Context, eg *errgroup.Group, onIma
 	}, nil
 }
 
-func newCacheImportOpt(ref string) client.CacheOptionsEntry {
-	registryCacheOptAttrs := make(map[string]string)
-	registryCacheOptAttrs["ref"] = ref
-	return client.CacheOptionsEntry{
-		Type:  "registry",
-		Attrs: registryCacheOptAttrs,
+// newCacheImportOpts returns the cache imports of the given remote cache specs (see llbutil.ParseRemoteCache).
+func newCacheImportOpts(specs []string) ([]client.CacheOptionsEntry, error) {
+	var ret []client.CacheOptionsEntry
+	for _, spec := range specs {
+		rc, err := llbutil.ParseRemoteCache(spec)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, client.CacheOptionsEntry{
+			Type:  rc.Type,
+			Attrs: rc.ImportAttrs(),
+		})
 	}
+	return ret, nil
 }
 
-func newCacheExportOpt(ref string, max bool) client.CacheOptionsEntry {
-	registryCacheOptAttrs := make(map[string]string)
-	registryCacheOptAttrs["ref"] = ref
-	if max {
-		registryCacheOptAttrs["mode"] = "max"
+func newCacheExportOpt(spec string, max bool) (client.CacheOptionsEntry, error) {
+	rc, err := llbutil.ParseRemoteCache(spec)
+	if err != nil {
+		return client.CacheOptionsEntry{}, err
 	}
 	return client.CacheOptionsEntry{
-		Type:  "registry",
-		Attrs: registryCacheOptAttrs,
-	}
+		Type:  rc.Type,
+		Attrs: rc.ExportAttrs(max),
+	}, nil
 }
 
 func newInlineCacheOpt() client.CacheOptionsEntry {
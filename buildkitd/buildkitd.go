@@ -18,10 +18,13 @@ import (
 	"github.com/moby/buildkit/client"
 	_ "github.com/moby/buildkit/client/connhelper/dockercontainer" // Load "docker-container://" helper.
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"github.com/earthly/earthly/conslogging"
+	"github.com/earthly/earthly/tracing"
 	"github.com/earthly/earthly/util/cliutil"
 	"github.com/earthly/earthly/util/containerutil"
 	"github.com/earthly/earthly/util/fileutil"
@@ -37,7 +40,13 @@ var (
 
 // NewClient returns a new buildkitd client. If the buildkitd daemon is local, this function
 // might start one up, if not already started.
-func NewClient(ctx context.Context, console conslogging.ConsoleLogger, image, containerName string, fe containerutil.ContainerFrontend, earthlyVersion string, settings Settings, opts ...client.ClientOpt) (*client.Client, error) {
+func NewClient(ctx context.Context, console conslogging.ConsoleLogger, image, containerName string, fe containerutil.ContainerFrontend, earthlyVersion string, settings Settings, opts ...client.ClientOpt) (_ *client.Client, retErr error) {
+	ctx, span := tracing.Start(ctx, "buildkitd.connect", trace.WithAttributes(
+		attribute.String("earthly.buildkit.address", settings.BuildkitAddress),
+	))
+	defer func() {
+		tracing.End(span, retErr)
+	}()
 	opts, err := addRequiredOpts(settings, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "add required client opts")
@@ -270,7 +279,14 @@ func RemoveExited(ctx context.Context, fe containerutil.ContainerFrontend, conta
 }
 
 // Start starts the buildkitd daemon.
-func Start(ctx context.Context, console conslogging.ConsoleLogger, image, containerName string, fe containerutil.ContainerFrontend, settings Settings, reset bool) error {
+func Start(ctx context.Context, console conslogging.ConsoleLogger, image, containerName string, fe containerutil.ContainerFrontend, settings Settings, reset bool) (retErr error) {
+	ctx, span := tracing.Start(ctx, "buildkitd.start", trace.WithAttributes(
+		attribute.String("earthly.buildkit.image", image),
+		attribute.Bool("earthly.buildkit.reset", reset),
+	))
+	defer func() {
+		tracing.End(span, retErr)
+	}()
 	settingsHash, err := settings.Hash()
 	if err != nil {
 		return errors.Wrap(err, "settings hash")
@@ -444,6 +460,10 @@ func Start(ctx context.Context, console conslogging.ConsoleLogger, image, contai
 		envOpts["CACHE_SIZE_PCT"] = strconv.FormatInt(int64(settings.CacheSizePct), 10)
 	}
 
+	if len(settings.GCPolicy) > 0 {
+		envOpts["GC_POLICY_SETTINGS"] = gcPolicyConfig(settings.GCPolicy)
+	}
+
 	if settings.EnableProfiler {
 		envOpts["BUILDKIT_PPROF_ENABLED"] = strconv.FormatBool(true)
 	}
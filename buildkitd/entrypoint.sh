@@ -190,7 +190,10 @@ fi
 # Remains unset if neither percent nor size were specified.  It would be simpler to just process whether it was
 # set (or not), but we'll continue setting to "0" in case anyone has become dependent on that behavior.
 CACHE_SIZE_MB="${EFFECTIVE_CACHE_SIZE_MB:-0}"
-if [ "$CACHE_SIZE_MB" -gt "0" ]; then
+if [ -n "$GC_POLICY_SETTINGS" ]; then
+    # A custom garbage-collection policy replaces the default one derived from the cache size.
+    CACHE_SETTINGS="$GC_POLICY_SETTINGS"
+elif [ "$CACHE_SIZE_MB" -gt "0" ]; then
     CACHE_SETTINGS="$(envsubst </etc/buildkitd.cache.template)"
 fi
 export CACHE_SETTINGS
@@ -0,0 +1,107 @@
+package buildkitd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+
+	"github.com/earthly/earthly/config"
+	"github.com/earthly/earthly/util/pruneutil"
+)
+
+// GCRule is a rule of the garbage-collection policy of buildkitd. Buildkitd applies the rules in order,
+// pruning the records matched by each rule until they fit within its limits.
+type GCRule struct {
+	All          bool
+	KeepDuration time.Duration
+	KeepBytes    int64
+	Filters      []string
+}
+
+// ParseGCPolicy parses the garbage-collection policy set in the earthly config.
+func ParseGCPolicy(rules []config.GCPolicyRule) ([]GCRule, error) {
+	ret := make([]GCRule, 0, len(rules))
+	for i, r := range rules {
+		var rule GCRule
+		rule.All = r.All
+		if r.KeepDuration != "" {
+			d, err := parseKeepDuration(r.KeepDuration)
+			if err != nil {
+				return nil, errors.Wrapf(err, "gc policy rule %d: parse keep_duration %s", i+1, r.KeepDuration)
+			}
+			rule.KeepDuration = d
+		}
+		if r.KeepBytes != "" {
+			b, err := humanize.ParseBytes(r.KeepBytes)
+			if err != nil {
+				return nil, errors.Wrapf(err, "gc policy rule %d: parse keep_bytes %s", i+1, r.KeepBytes)
+			}
+			rule.KeepBytes = int64(b)
+		}
+		if rule.KeepDuration == 0 && rule.KeepBytes == 0 {
+			// Buildkitd would otherwise prune all the matched records on every garbage collection.
+			return nil, errors.Errorf("gc policy rule %d: keep_duration or keep_bytes must be set", i+1)
+		}
+		for _, f := range r.Filters {
+			filter, err := pruneutil.ParseFilter(f)
+			if err != nil {
+				return nil, errors.Wrapf(err, "gc policy rule %d", i+1)
+			}
+			rule.Filters = append(rule.Filters, filter)
+		}
+		ret = append(ret, rule)
+	}
+	return ret, nil
+}
+
+// parseKeepDuration parses a duration such as 72h, additionally accepting a number of days such as 7d.
+func parseKeepDuration(s string) (time.Duration, error) {
+	var d time.Duration
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, err
+		}
+		d = time.Duration(n * float64(24*time.Hour))
+	} else {
+		var err error
+		d, err = time.ParseDuration(s)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if d < time.Second {
+		return 0, errors.New("duration must be at least 1s")
+	}
+	return d, nil
+}
+
+// gcPolicyConfig renders the rules as the gcpolicy of the oci worker in buildkitd.toml.
+func gcPolicyConfig(rules []GCRule) string {
+	// The indentation matches the one of the cache settings in buildkitd.toml.template.
+	var sb strings.Builder
+	for _, r := range rules {
+		sb.WriteString("  [[worker.oci.gcpolicy]]\n")
+		if r.All {
+			sb.WriteString("    all = true\n")
+		}
+		if r.KeepDuration != 0 {
+			fmt.Fprintf(&sb, "    keepDuration = %d\n", int64(r.KeepDuration/time.Second))
+		}
+		if r.KeepBytes != 0 {
+			fmt.Fprintf(&sb, "    keepBytes = %d\n", r.KeepBytes)
+		}
+		if len(r.Filters) != 0 {
+			quoted := make([]string, 0, len(r.Filters))
+			for _, f := range r.Filters {
+				quoted = append(quoted, strconv.Quote(f))
+			}
+			fmt.Fprintf(&sb, "    filters = [ %s ]\n", strings.Join(quoted, ", "))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,44 @@
+package buildkitd
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/assert"
+
+	"github.com/earthly/earthly/config"
+)
+
+func TestParseGCPolicy(t *testing.T) {
+	rules, err := ParseGCPolicy([]config.GCPolicyRule{
+		{KeepDuration: "2h", Filters: []string{"type=source.local"}},
+		{KeepDuration: "7d", KeepBytes: "10GB", Filters: []string{"type=exec.cachemount"}},
+		{KeepBytes: "20GB", All: true},
+	})
+	if !NoError(t, err) {
+		return
+	}
+	Equal(t, []GCRule{
+		{KeepDuration: 2 * time.Hour, Filters: []string{"type==source.local"}},
+		{KeepDuration: 7 * 24 * time.Hour, KeepBytes: 10000000000, Filters: []string{"type==exec.cachemount"}},
+		{KeepBytes: 20000000000, All: true},
+	}, rules)
+	Equal(t, `  [[worker.oci.gcpolicy]]
+    keepDuration = 7200
+    filters = [ "type==source.local" ]
+  [[worker.oci.gcpolicy]]
+    keepDuration = 604800
+    keepBytes = 10000000000
+    filters = [ "type==exec.cachemount" ]
+  [[worker.oci.gcpolicy]]
+    all = true
+    keepBytes = 20000000000
+`, gcPolicyConfig(rules))
+
+	_, err = ParseGCPolicy([]config.GCPolicyRule{{Filters: []string{"type=regular"}}})
+	Error(t, err)
+	_, err = ParseGCPolicy([]config.GCPolicyRule{{KeepDuration: "7 days"}})
+	Error(t, err)
+	_, err = ParseGCPolicy([]config.GCPolicyRule{{KeepBytes: "1GB", Filters: []string{"type=foo"}}})
+	Error(t, err)
+}
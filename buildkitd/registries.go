@@ -0,0 +1,47 @@
+package buildkitd
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	tomlTableRegexp         = regexp.MustCompile(`^\[\[?\s*([^\]]*?)\s*\]\]?$`)
+	tomlRegistryTableRegexp = regexp.MustCompile(`^registry\s*\.\s*"([^"]+)"$`)
+	tomlBoolRegexp          = regexp.MustCompile(`^(http|insecure)\s*=\s*(true|false)$`)
+)
+
+// InsecureRegistries returns the registries configured as insecure in the additional buildkitd config
+// (the buildkit_additional_config setting): the ones accessed via plain HTTP (http = true), and the ones
+// whose TLS certificates are not verified (insecure = true). Only the [registry."<host>"] tables of the
+// TOML config are considered.
+func InsecureRegistries(additionalConfig string) (plainHTTP []string, skipVerify []string) {
+	host := ""
+	for _, line := range strings.Split(additionalConfig, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if m := tomlTableRegexp.FindStringSubmatch(line); m != nil {
+			host = ""
+			if rm := tomlRegistryTableRegexp.FindStringSubmatch(m[1]); rm != nil && !strings.HasPrefix(line, "[[") {
+				host = rm[1]
+			}
+			continue
+		}
+		if host == "" {
+			continue
+		}
+		m := tomlBoolRegexp.FindStringSubmatch(line)
+		if m == nil || m[2] != "true" {
+			continue
+		}
+		switch m[1] {
+		case "http":
+			plainHTTP = append(plainHTTP, host)
+		case "insecure":
+			skipVerify = append(skipVerify, host)
+		}
+	}
+	return plainHTTP, skipVerify
+}
@@ -0,0 +1,27 @@
+package buildkitd
+
+import (
+	"testing"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestInsecureRegistries(t *testing.T) {
+	plainHTTP, skipVerify := InsecureRegistries(`
+[registry."registry.local:5000"]
+  http = true # plain http
+  insecure = true
+[registry."self-signed.example.com"]
+  insecure = true
+  ca=["/etc/config/add.ca"]
+  [[registry."self-signed.example.com".keypair]]
+    key="/etc/config/key.pem"
+[registry."docker.io"]
+  mirrors = ["mirror.example.com"]
+  http = false
+[worker.oci]
+  http = true
+`)
+	Equal(t, []string{"registry.local:5000"}, plainHTTP)
+	Equal(t, []string{"registry.local:5000", "self-signed.example.com"}, skipVerify)
+}
@@ -13,6 +13,7 @@ import (
 type Settings struct {
 	CacheSizeMb          int
 	CacheSizePct         int
+	GCPolicy             []GCRule
 	Debug                bool
 	BuildkitAddress      string
 	DebuggerAddress      string
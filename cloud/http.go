@@ -14,6 +14,10 @@ import (
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/earthly/earthly/tracing"
 )
 
 type request struct {
@@ -83,10 +87,18 @@ func withBody(body string) requestOpt {
 	}
 }
 
-func (c *client) doCall(ctx context.Context, method, url string, opts ...requestOpt) (int, string, error) {
+func (c *client) doCall(ctx context.Context, method, url string, opts ...requestOpt) (_ int, _ string, retErr error) {
 	const maxAttempt = 10
 	const maxSleepBeforeRetry = time.Second * 3
 
+	ctx, span := tracing.Start(ctx, "cloud.call", trace.WithAttributes(
+		attribute.String("http.method", method),
+		attribute.String("http.target", url),
+	))
+	defer func() {
+		tracing.End(span, retErr)
+	}()
+
 	var r request
 	for _, opt := range opts {
 		err := opt(&r)
@@ -112,6 +124,10 @@ func (c *client) doCall(ctx context.Context, method, url string, opts ...request
 	duration := time.Millisecond * 100
 	for attempt := 0; attempt < maxAttempt; attempt++ {
 		status, body, callErr = c.doCallImp(ctx, r, method, url, opts...)
+		span.SetAttributes(
+			attribute.Int("http.status_code", status),
+			attribute.Int("earthly.cloud.attempts", attempt+1),
+		)
 		retry, err := shouldRetry(status, body, callErr, c.warnFunc)
 		if err != nil {
 			return status, body, err
@@ -6,7 +6,9 @@ import (
 	"io"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/containerd/containerd/platforms"
 	"github.com/docker/cli/cli/config"
@@ -27,16 +29,26 @@ import (
 	"github.com/earthly/earthly/buildkitd"
 	"github.com/earthly/earthly/cleanup"
 	"github.com/earthly/earthly/cloud"
+	"github.com/earthly/earthly/conslogging"
 	debuggercommon "github.com/earthly/earthly/debugger/common"
 	"github.com/earthly/earthly/debugger/terminal"
 	"github.com/earthly/earthly/domain"
+	"github.com/earthly/earthly/earthfile2llb"
 	"github.com/earthly/earthly/states"
+	"github.com/earthly/earthly/util/cachemount"
+	"github.com/earthly/earthly/util/cliutil"
 	"github.com/earthly/earthly/util/containerutil"
+	"github.com/earthly/earthly/util/explaincache"
 	"github.com/earthly/earthly/util/gatewaycrafter"
+	"github.com/earthly/earthly/util/lastbuild"
+	"github.com/earthly/earthly/util/llbutil"
 	"github.com/earthly/earthly/util/llbutil/secretprovider"
 	"github.com/earthly/earthly/util/platutil"
+	"github.com/earthly/earthly/util/saveartifactlocally"
+	"github.com/earthly/earthly/util/sbom"
 	"github.com/earthly/earthly/util/syncutil/semutil"
 	"github.com/earthly/earthly/util/termutil"
+	"github.com/earthly/earthly/util/watchutil"
 	"github.com/earthly/earthly/variables"
 )
 
@@ -70,6 +82,45 @@ func (app *earthlyApp) actionBuild(cliCtx *cli.Context) error {
 		return errors.New("A tty-terminal must be present in order to use the --interactive flag")
 	}
 
+	app.invocationRecorder = lastbuild.NewRecorder()
+	defer app.saveLastBuild()
+	app.cacheMountRecorder = cachemount.NewRecorder()
+	defer app.saveCacheMounts()
+	if app.explainCache {
+		if app.rerunFailed {
+			return errors.New("--explain-cache cannot be used with --rerun-failed")
+		}
+		app.explainCacheRecorder = explaincache.NewRecorder()
+	}
+
+	if app.watch {
+		if app.rerunFailed {
+			return errors.New("--watch cannot be used with --rerun-failed")
+		}
+		if app.interactiveDebugging {
+			return errors.New("--watch cannot be used with --interactive")
+		}
+	}
+	if app.verifyReproducible {
+		switch {
+		case app.watch:
+			return errors.New("--verify-reproducible cannot be used with --watch")
+		case app.rerunFailed:
+			return errors.New("--verify-reproducible cannot be used with --rerun-failed")
+		case app.interactiveDebugging:
+			return errors.New("--verify-reproducible cannot be used with --interactive")
+		case app.push:
+			return errors.New("--verify-reproducible cannot be used with --push")
+		case app.imageOutput != "":
+			return errors.New("--verify-reproducible cannot be used with --image-output")
+		case app.explainCache:
+			return errors.New("--verify-reproducible cannot be used with --explain-cache")
+		}
+	}
+	if app.rerunFailed {
+		return app.rerunFailedInvocations(cliCtx)
+	}
+
 	flagArgs, nonFlagArgs, err := variables.ParseFlagArgsWithNonFlags(cliCtx.Args().Slice())
 	if err != nil {
 		return errors.Wrapf(err, "parse args %s", strings.Join(cliCtx.Args().Slice(), " "))
@@ -78,6 +129,99 @@ func (app *earthlyApp) actionBuild(cliCtx *cli.Context) error {
 	return app.actionBuildImp(cliCtx, flagArgs, nonFlagArgs)
 }
 
+// parseImageOutput parses the value of --image-output, and returns the OCI image layout dir which the
+// output images are written into.
+func parseImageOutput(imageOutput string) (string, error) {
+	if imageOutput == "" {
+		return "", nil
+	}
+	dir := strings.TrimPrefix(imageOutput, "oci-dir:")
+	if dir == imageOutput || dir == "" {
+		return "", errors.Errorf("invalid --image-output %q; expected oci-dir:<dir>", imageOutput)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errors.Wrapf(err, "get abs path of %s", dir)
+	}
+	return absDir, nil
+}
+
+func lastBuildStatePath() string {
+	return filepath.Join(cliutil.GetEarthlyDir(), "last-build.json")
+}
+
+// saveLastBuild persists the invocations of the build, such that failed ones can be re-run via --rerun-failed.
+func (app *earthlyApp) saveLastBuild() {
+	if app.invocationRecorder.Len() == 0 {
+		// Nothing was built (e.g. the build failed before converting the Earthfile);
+		// keep the state of the previous build.
+		return
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		app.console.Warnf("Failed to save build state: %v\n", err)
+		return
+	}
+	_, err = cliutil.GetOrCreateEarthlyDir()
+	if err != nil {
+		app.console.Warnf("Failed to save build state: %v\n", err)
+		return
+	}
+	err = lastbuild.Save(lastBuildStatePath(), app.invocationRecorder.State(wd))
+	if err != nil {
+		app.console.Warnf("Failed to save build state: %v\n", err)
+	}
+}
+
+// rerunFailedInvocations re-builds the targets which have failed (or were canceled) as part of
+// the last build, using their original build args and platform.
+func (app *earthlyApp) rerunFailedInvocations(cliCtx *cli.Context) error {
+	if cliCtx.Args().Len() != 0 {
+		return errors.New("--rerun-failed does not take a target or build args; they are taken from the last build")
+	}
+	if app.imageMode || app.artifactMode {
+		return errors.New("--rerun-failed cannot be used with --image or --artifact")
+	}
+	state, err := lastbuild.Load(lastBuildStatePath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return errors.New("no previous build found to re-run")
+		}
+		return errors.Wrap(err, "load last build state")
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return errors.Wrap(err, "get working dir")
+	}
+	if state.WorkingDir != wd {
+		return errors.Errorf("the last build was run from %s; --rerun-failed must be run from the same directory", state.WorkingDir)
+	}
+	invocations := state.ToRerun()
+	if len(invocations) == 0 {
+		app.console.Printf("The last build has succeeded; nothing to re-run\n")
+		return nil
+	}
+
+	var failed []string
+	for _, inv := range invocations {
+		args := inv.Args()
+		app.console.Printf("Re-running %s (%s) %s\n", inv.TargetInput.TargetCanonical, inv.TargetInput.Platform, strings.Join(args, " "))
+		app.platformsStr = *cli.NewStringSlice(inv.TargetInput.Platform)
+		err := app.actionBuildImp(cliCtx, args, []string{inv.TargetInput.TargetCanonical})
+		if err != nil {
+			if !app.keepGoing {
+				return err
+			}
+			app.console.Warnf("Error: %s: %v\n", inv.TargetInput.TargetCanonical, err)
+			failed = append(failed, inv.TargetInput.TargetCanonical)
+		}
+	}
+	if len(failed) != 0 {
+		return errors.Errorf("%d of %d re-run targets failed: %s", len(failed), len(invocations), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
 // warnIfArgContainsBuildArg will issue a warning if a flag is incorrectly prefixed with build-arg.
 // TODO this check should be replaced with a warning if an arg was given but never used.
 func (app *earthlyApp) warnIfArgContainsBuildArg(flagArgs []string) {
@@ -325,10 +469,27 @@ func (app *earthlyApp) actionBuildImp(cliCtx *cli.Context, flagArgs, nonFlagArgs
 		attachables = append(attachables, ssh)
 	}
 
+	var outputRoot string
+	if app.outputRoot != "" {
+		if app.artifactMode {
+			return errors.New("--output-root cannot be used with --artifact")
+		}
+		outputRoot, err = filepath.Abs(app.outputRoot)
+		if err != nil {
+			return errors.Wrapf(err, "get absolute path of --output-root %s", app.outputRoot)
+		}
+	}
+
+	err = saveartifactlocally.ValidateChecksumAlgorithm(app.checksumAlgorithm)
+	if err != nil {
+		return errors.Wrap(err, "invalid --checksum-algorithm")
+	}
+
 	localArtifactWhiteList := gatewaycrafter.NewLocalArtifactWhiteList()
+	outputLock := saveartifactlocally.NewProcessOutputLock(saveartifactlocally.LockRoot(cliCtx.Context, outputRoot))
 
 	socketProvider, err := socketprovider.NewSocketProvider(map[string]socketprovider.SocketAcceptCb{
-		"earthly_save_file": getTryCatchSaveFileHandler(localArtifactWhiteList),
+		"earthly_save_file": getTryCatchSaveFileHandler(localArtifactWhiteList, outputRoot, outputLock, app.console),
 		"earthly_interactive": func(ctx context.Context, conn io.ReadWriteCloser) error {
 			if !termutil.IsTTY() {
 				return fmt.Errorf("interactive mode unavailable due to terminal not being tty")
@@ -362,11 +523,24 @@ func (app *earthlyApp) actionBuildImp(cliCtx *cli.Context, flagArgs, nonFlagArgs
 	}
 
 	cacheImports := make([]string, 0)
+	importSpecs := app.cacheFrom.Value()
 	if app.remoteCache != "" {
-		cacheImports = append(cacheImports, app.remoteCache)
+		importSpecs = append([]string{app.remoteCache}, importSpecs...)
 	}
-	if len(app.cacheFrom.Value()) > 0 {
-		cacheImports = append(cacheImports, app.cacheFrom.Value()...)
+	for _, spec := range importSpecs {
+		rc, err := llbutil.ParseRemoteCache(spec)
+		if err != nil {
+			return err
+		}
+		rc, ok, err := rc.WithLocalDigest()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			app.console.VerbosePrintf("No cache has been exported to %s yet; skipping its import\n", rc.Dir())
+			continue
+		}
+		cacheImports = append(cacheImports, rc.String())
 	}
 	var cacheExport string
 	var maxCacheExport string
@@ -389,6 +563,22 @@ func (app *earthlyApp) actionBuildImp(cliCtx *cli.Context, flagArgs, nonFlagArgs
 		}
 		localRegistryAddr = lrURL.Host
 	}
+	imageOutputDir, err := parseImageOutput(app.imageOutput)
+	if err != nil {
+		return err
+	}
+	if app.sbomFormat != "" {
+		err = sbom.ValidateFormat(app.sbomFormat)
+		if err != nil {
+			return errors.Wrap(err, "invalid --sbom")
+		}
+	}
+	_, err = earthfile2llb.ParseSourceDateEpoch(app.sourceDateEpoch, nil)
+	if err != nil {
+		return errors.Wrap(err, "invalid --source-date-epoch")
+	}
+	// The key is only required by SAVE IMAGE --sign; the error is reported if an image is to be signed.
+	signingKey, signingKeyErr := app.loadSigningKey()
 	builderOpts := builder.Opt{
 		BkClient:                              bkClient,
 		Console:                               app.console,
@@ -418,18 +608,31 @@ func (app *earthlyApp) actionBuildImp(cliCtx *cli.Context, flagArgs, nonFlagArgs
 		InternalSecretStore:                   internalSecretStore,
 		InteractiveDebugging:                  app.interactiveDebugging,
 		InteractiveDebuggingDebugLevelLogging: app.debug,
+		KeepGoing:                             app.keepGoing,
+		InvocationRecorder:                    app.invocationRecorder,
+		CacheMountRecorder:                    app.cacheMountRecorder,
+		ExplainCacheRecorder:                  app.explainCacheRecorder,
+		ImageOutputDir:                        imageOutputDir,
+		OutputRoot:                            outputRoot,
+		ChecksumManifest:                      app.checksumManifest,
+		ChecksumAlgorithm:                     app.checksumAlgorithm,
+		SBOMFormat:                            app.sbomFormat,
+		Provenance:                            app.provenance,
+		SigningKey:                            signingKey,
+		SigningKeyErr:                         signingKeyErr,
+		Registry:                              app.registry(),
+		SourceDateEpoch:                       app.sourceDateEpoch,
+		OutputLock:                            outputLock,
 	}
-	b, err := builder.NewBuilder(cliCtx.Context, builderOpts)
-	if err != nil {
-		return errors.Wrap(err, "new builder")
-	}
-
 	app.console.PrintPhaseFooter(builder.PhaseInit, false, "")
 
 	builtinArgs := variables.DefaultArgs{
 		EarthlyVersion:  Version,
 		EarthlyBuildSha: GitSha,
 	}
+	if app.sourceDateEpoch != earthfile2llb.SourceDateEpochGit {
+		builtinArgs.SourceDateEpoch = app.sourceDateEpoch
+	}
 	buildOpts := builder.BuildOpt{
 		PrintPhases:                true,
 		Push:                       app.push,
@@ -453,7 +656,21 @@ func (app *earthlyApp) actionBuildImp(cliCtx *cli.Context, flagArgs, nonFlagArgs
 		buildOpts.OnlyArtifact = &artifact
 		buildOpts.OnlyArtifactDestPath = destPath
 	}
+	if app.watch {
+		return app.watchBuild(cliCtx, target, builderOpts, buildOpts)
+	}
+	if app.verifyReproducible {
+		return app.verifyReproducibleBuild(cliCtx, target, builderOpts, buildOpts)
+	}
+	b, err := builder.NewBuilder(cliCtx.Context, builderOpts)
+	if err != nil {
+		return errors.Wrap(err, "new builder")
+	}
 	_, err = b.BuildTarget(cliCtx.Context, target, buildOpts)
+	app.invocationRecorder.FinishRoot(err)
+	if app.explainCache {
+		app.explainCacheMisses(target, err)
+	}
 	if err != nil {
 		return errors.Wrap(err, "build target")
 	}
@@ -461,7 +678,71 @@ func (app *earthlyApp) actionBuildImp(cliCtx *cli.Context, flagArgs, nonFlagArgs
 	return nil
 }
 
-func getTryCatchSaveFileHandler(localArtifactWhiteList *gatewaycrafter.LocalArtifactWhiteList) func(ctx context.Context, conn io.ReadWriteCloser) error {
+// watchBuild builds the target, then waits for the local files used by the build to change and re-builds it,
+// until interrupted. The builds share the buildkitd client and session attachables.
+func (app *earthlyApp) watchBuild(cliCtx *cli.Context, target domain.Target, builderOpts builder.Opt, buildOpts builder.BuildOpt) error {
+	const (
+		pollInterval = 500 * time.Millisecond
+		debounce     = 300 * time.Millisecond
+	)
+	for iteration := 1; ; iteration++ {
+		watchSet := watchutil.NewSet()
+		app.invocationRecorder = lastbuild.NewRecorder()
+		builderOpts.WatchSet = watchSet
+		builderOpts.InvocationRecorder = app.invocationRecorder
+		if app.explainCache {
+			app.explainCacheRecorder = explaincache.NewRecorder()
+			builderOpts.ExplainCacheRecorder = app.explainCacheRecorder
+		}
+
+		start := time.Now()
+		b, err := builder.NewBuilder(cliCtx.Context, builderOpts)
+		if err != nil {
+			return errors.Wrap(err, "new builder")
+		}
+		_, err = b.BuildTarget(cliCtx.Context, target, buildOpts)
+		app.invocationRecorder.FinishRoot(err)
+		app.saveLastBuild()
+		if app.explainCache && cliCtx.Context.Err() == nil {
+			app.explainCacheMisses(target, err)
+		}
+		if cliCtx.Context.Err() != nil {
+			return nil
+		}
+		elapsed := time.Since(start).Round(100 * time.Millisecond)
+		if err != nil {
+			msg := strings.SplitN(err.Error(), "\n", 2)[0]
+			app.console.Warnf("[watch #%d] %s failed after %s: %s\n", iteration, target.String(), elapsed, msg)
+		} else {
+			app.console.Printf("[watch #%d] %s succeeded in %s\n", iteration, target.String(), elapsed)
+		}
+		if watchSet.Empty() {
+			return errors.Errorf("no local files to watch for %s", target.String())
+		}
+
+		// The baseline is taken after the build, such that the files written via SAVE ARTIFACT ... AS LOCAL
+		// do not trigger another build.
+		baseline, err := watchSet.Snapshot(cliCtx.Context)
+		if err != nil {
+			return errors.Wrap(err, "snapshot watched files")
+		}
+		app.console.Printf("Watching %d files for changes; press Ctrl+C to stop\n", len(baseline))
+		changed, err := watchSet.Wait(cliCtx.Context, baseline, pollInterval, debounce)
+		if err != nil {
+			if cliCtx.Context.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "watch files")
+		}
+		if len(changed) == 1 {
+			app.console.Printf("%s changed; re-building\n", changed[0])
+		} else {
+			app.console.Printf("%s and %d other files changed; re-building\n", changed[0], len(changed)-1)
+		}
+	}
+}
+
+func getTryCatchSaveFileHandler(localArtifactWhiteList *gatewaycrafter.LocalArtifactWhiteList, outputRoot string, outputLock *saveartifactlocally.ProcessOutputLock, console conslogging.ConsoleLogger) func(ctx context.Context, conn io.ReadWriteCloser) error {
 	return func(ctx context.Context, conn io.ReadWriteCloser) error {
 		// version
 		n, _, err := debuggercommon.ReadDataPacket(conn)
@@ -497,7 +778,24 @@ func getTryCatchSaveFileHandler(localArtifactWhiteList *gatewaycrafter.LocalArti
 			return fmt.Errorf("expected EOF, but got more data")
 		}
 
-		f, err := os.Create(string(dst))
+		// The lock is released at the end of the build.
+		err = outputLock.Lock(ctx, console)
+		if err != nil {
+			return err
+		}
+
+		p := string(dst)
+		if outputRoot != "" {
+			p, err = saveartifactlocally.RebaseDest(outputRoot, p)
+			if err != nil {
+				return err
+			}
+			err = os.MkdirAll(filepath.Dir(p), 0755)
+			if err != nil {
+				return err
+			}
+		}
+		f, err := os.Create(p)
 		if err != nil {
 			return err
 		}
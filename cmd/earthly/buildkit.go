@@ -78,6 +78,10 @@ func (app *earthlyApp) initFrontend(cliCtx *cli.Context) error {
 	app.buildkitdSettings.MaxParallelism = app.cfg.Global.BuildkitMaxParallelism
 	app.buildkitdSettings.CacheSizeMb = app.cfg.Global.BuildkitCacheSizeMb
 	app.buildkitdSettings.CacheSizePct = app.cfg.Global.BuildkitCacheSizePct
+	app.buildkitdSettings.GCPolicy, err = buildkitd.ParseGCPolicy(app.cfg.Global.BuildkitGCPolicy)
+	if err != nil {
+		return errors.Wrap(err, "invalid buildkit_gc_policy")
+	}
 	app.buildkitdSettings.EnableProfiler = app.enableProfiler
 	app.buildkitdSettings.NoUpdate = app.noBuildkitUpdate
 
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/moby/buildkit/client"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/earthly/earthly/cloud"
+	"github.com/earthly/earthly/util/cachemount"
+	"github.com/earthly/earthly/util/cliutil"
+)
+
+func (app *earthlyApp) cacheCmds() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:      "ls",
+			Aliases:   []string{"list"},
+			Usage:     "List the cache mounts (CACHE and RUN --mount type=cache) of the build cache",
+			UsageText: "earthly [options] cache ls",
+			Action:    app.actionCacheList,
+		},
+		{
+			Name:      "inspect",
+			Usage:     "Show the details of a cache mount",
+			UsageText: "earthly [options] cache inspect <id>",
+			Action:    app.actionCacheInspect,
+		},
+		{
+			Name:      "rm",
+			Aliases:   []string{"remove"},
+			Usage:     "Remove cache mounts from the build cache",
+			UsageText: "earthly [options] cache rm [--older-than <duration>] [--larger-than <size>] [--all] [<id>...]",
+			Action:    app.actionCacheRemove,
+			Flags: []cli.Flag{
+				&cli.DurationFlag{
+					Name:        "older-than",
+					Usage:       "Remove the cache mounts which have not been used for the given duration, e.g. 72h",
+					Destination: &app.cacheOlderThan,
+				},
+				&cli.StringFlag{
+					Name:        "larger-than",
+					Usage:       "Remove the cache mounts which are larger than the given size, e.g. 1GB",
+					Destination: &app.cacheLargerThan,
+				},
+				&cli.BoolFlag{
+					Name:        "all",
+					Aliases:     []string{"a"},
+					Usage:       "Remove all cache mounts",
+					Destination: &app.cacheRemoveAll,
+				},
+			},
+		},
+	}
+}
+
+func cacheMountIndexPath() string {
+	return filepath.Join(cliutil.GetEarthlyDir(), "cache-mounts.json")
+}
+
+// saveCacheMounts adds the cache mounts used by the build to the cache mount index, such that the earthly
+// cache commands can attribute them to their targets.
+func (app *earthlyApp) saveCacheMounts() {
+	entries := app.cacheMountRecorder.Entries()
+	if len(entries) == 0 {
+		return
+	}
+	_, err := cliutil.GetOrCreateEarthlyDir()
+	if err != nil {
+		app.console.Warnf("Failed to save cache mount index: %v\n", err)
+		return
+	}
+	idx, err := cachemount.Load(cacheMountIndexPath())
+	if err != nil {
+		app.console.Warnf("Failed to save cache mount index: %v\n", err)
+		return
+	}
+	idx.Update(entries)
+	err = cachemount.Save(cacheMountIndexPath(), idx)
+	if err != nil {
+		app.console.Warnf("Failed to save cache mount index: %v\n", err)
+	}
+}
+
+// cacheMounts returns the cache mounts of the buildkit cache, attributed to the targets which use them.
+func (app *earthlyApp) cacheMounts(cliCtx *cli.Context) (*client.Client, []cachemount.Mount, error) {
+	cloudClient, err := cloud.NewClient(app.cloudHTTPAddr, app.cloudGRPCAddr, app.sshAuthSock, app.authToken, app.console.Warnf)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create cloud client")
+	}
+	bkClient, err := app.getBuildkitClient(cliCtx, cloudClient)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "build new buildkitd client")
+	}
+	records, err := bkClient.DiskUsage(cliCtx.Context)
+	if err != nil {
+		bkClient.Close()
+		return nil, nil, errors.Wrap(err, "get buildkit disk usage")
+	}
+	idx, err := cachemount.Load(cacheMountIndexPath())
+	if err != nil {
+		bkClient.Close()
+		return nil, nil, errors.Wrap(err, "load cache mount index")
+	}
+	return bkClient, cachemount.Match(records, idx.Entries), nil
+}
+
+func (app *earthlyApp) actionCacheList(cliCtx *cli.Context) error {
+	app.commandName = "cacheList"
+	if cliCtx.NArg() != 0 {
+		return errors.New("invalid number of arguments provided")
+	}
+	bkClient, mounts, err := app.cacheMounts(cliCtx)
+	if err != nil {
+		return err
+	}
+	defer bkClient.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "ID\tTARGET\tMOUNT\tSIZE\tLAST USED\tCACHE ID\n")
+	for _, m := range mounts {
+		target, cacheID := "-", "-"
+		if m.Entry != nil {
+			target, cacheID = m.Entry.Target, m.Entry.ID
+		} else if len(m.Candidates) != 0 {
+			target = "(ambiguous)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			m.Record.ID, target, cachemount.MountTargetOf(m.Record.Description),
+			humanize.Bytes(uint64(m.Record.Size)), humanize.Time(cachemount.LastUsed(m.Record)), cacheID)
+	}
+	return nil
+}
+
+func (app *earthlyApp) actionCacheInspect(cliCtx *cli.Context) error {
+	app.commandName = "cacheInspect"
+	if cliCtx.NArg() != 1 {
+		return errors.New("invalid number of arguments provided")
+	}
+	bkClient, mounts, err := app.cacheMounts(cliCtx)
+	if err != nil {
+		return err
+	}
+	defer bkClient.Close()
+	m, err := cachemount.Find(mounts, cliCtx.Args().First())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "ID:\t%s\n", m.Record.ID)
+	if m.Entry != nil {
+		fmt.Fprintf(w, "Cache ID:\t%s\n", m.Entry.ID)
+		fmt.Fprintf(w, "Target:\t%s\n", m.Entry.Target)
+	}
+	for _, e := range m.Candidates {
+		fmt.Fprintf(w, "Candidate:\t%s (%s)\n", e.ID, e.Target)
+	}
+	fmt.Fprintf(w, "Mount:\t%s\n", cachemount.MountTargetOf(m.Record.Description))
+	fmt.Fprintf(w, "Description:\t%s\n", m.Record.Description)
+	fmt.Fprintf(w, "Size:\t%s\n", humanize.Bytes(uint64(m.Record.Size)))
+	fmt.Fprintf(w, "Created:\t%s\n", m.Record.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "Last used:\t%s\n", cachemount.LastUsed(m.Record).Format(time.RFC3339))
+	fmt.Fprintf(w, "Usage count:\t%d\n", m.Record.UsageCount)
+	fmt.Fprintf(w, "In use:\t%t\n", m.Record.InUse)
+	return nil
+}
+
+func (app *earthlyApp) actionCacheRemove(cliCtx *cli.Context) error {
+	app.commandName = "cacheRemove"
+	hasSelector := app.cacheOlderThan != 0 || app.cacheLargerThan != "" || app.cacheRemoveAll
+	if cliCtx.NArg() == 0 && !hasSelector {
+		return errors.New("no cache mounts specified; pass their ids, --older-than, --larger-than or --all")
+	}
+	if cliCtx.NArg() != 0 && hasSelector {
+		return errors.New("cache mount ids cannot be combined with --older-than, --larger-than or --all")
+	}
+	var largerThan uint64
+	if app.cacheLargerThan != "" {
+		var err error
+		largerThan, err = humanize.ParseBytes(app.cacheLargerThan)
+		if err != nil {
+			return errors.Wrapf(err, "parse --larger-than %s", app.cacheLargerThan)
+		}
+	}
+	bkClient, mounts, err := app.cacheMounts(cliCtx)
+	if err != nil {
+		return err
+	}
+	defer bkClient.Close()
+
+	var toRemove []cachemount.Mount
+	if cliCtx.NArg() != 0 {
+		for _, id := range cliCtx.Args().Slice() {
+			m, err := cachemount.Find(mounts, id)
+			if err != nil {
+				return err
+			}
+			toRemove = append(toRemove, m)
+		}
+	} else {
+		var usedBefore time.Time
+		if app.cacheOlderThan != 0 {
+			usedBefore = time.Now().Add(-app.cacheOlderThan)
+		}
+		toRemove = cachemount.Select(mounts, usedBefore, int64(largerThan))
+	}
+	if len(toRemove) == 0 {
+		app.console.Printf("No cache mounts to remove\n")
+		return nil
+	}
+
+	filters := make([]string, 0, len(toRemove))
+	cacheIDs := make(map[string]string) // record ID -> cache ID
+	for _, m := range toRemove {
+		filters = append(filters, "id=="+m.Record.ID)
+		if m.Entry != nil {
+			cacheIDs[m.Record.ID] = m.Entry.ID
+		}
+	}
+	ch := make(chan client.UsageInfo)
+	done := make(chan struct{})
+	var total uint64
+	var numRemoved int
+	var removedCacheIDs []string
+	go func() {
+		defer close(done)
+		for usageInfo := range ch {
+			app.console.Printf("%s\t%s\n", usageInfo.ID, humanize.Bytes(uint64(usageInfo.Size)))
+			total += uint64(usageInfo.Size)
+			numRemoved++
+			if cacheID, ok := cacheIDs[usageInfo.ID]; ok {
+				removedCacheIDs = append(removedCacheIDs, cacheID)
+			}
+		}
+	}()
+	err = bkClient.Prune(cliCtx.Context, ch, client.WithFilter(filters))
+	close(ch)
+	<-done
+	if err != nil {
+		return errors.Wrap(err, "buildkit prune")
+	}
+	app.console.Printf("Freed %s\n", humanize.Bytes(total))
+	if numRemoved < len(toRemove) {
+		app.console.Warnf("%d cache mounts are in use and could not be removed\n", len(toRemove)-numRemoved)
+	}
+	if len(removedCacheIDs) == 0 {
+		return nil
+	}
+
+	idx, err := cachemount.Load(cacheMountIndexPath())
+	if err != nil {
+		return errors.Wrap(err, "load cache mount index")
+	}
+	idx.Remove(removedCacheIDs...)
+	err = cachemount.Save(cacheMountIndexPath(), idx)
+	if err != nil {
+		return errors.Wrap(err, "save cache mount index")
+	}
+	return nil
+}
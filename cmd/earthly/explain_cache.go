@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+
+	"github.com/earthly/earthly/domain"
+	"github.com/earthly/earthly/util/cliutil"
+	"github.com/earthly/earthly/util/explaincache"
+)
+
+// explainCachePath returns the path of the recorded last build of the given target.
+func explainCachePath(target domain.Target) string {
+	sum := sha256.Sum256([]byte(target.StringCanonical()))
+	return filepath.Join(cliutil.GetEarthlyDir(), "explain-cache", fmt.Sprintf("%x.json", sum[:8]))
+}
+
+// explainCacheMisses reports, for every step of the build which has not been cached, the first input which
+// changed since the previous build of the same target. The build is then recorded for the next comparison,
+// unless it failed, since the steps which did not run would then be reported as new.
+func (app *earthlyApp) explainCacheMisses(target domain.Target, buildErr error) {
+	console := app.console.WithPrefix("explain-cache")
+	cur := app.explainCacheRecorder.Build()
+	p := explainCachePath(target)
+	prev, err := explaincache.Load(p)
+	if err != nil {
+		console.Warnf("Failed to load the previous build of %s: %v\n", target.String(), err)
+	}
+	if prev == nil {
+		console.Printf("No previous build of %s recorded; the next build will be compared with this one\n", target.String())
+	} else {
+		explanations := explaincache.Explain(prev, cur)
+		if len(explanations) == 0 {
+			console.Printf("All the steps of %s were cached\n", target.String())
+		}
+		for _, e := range explanations {
+			console.Printf("%s\n", e.String())
+		}
+	}
+	if buildErr != nil {
+		return
+	}
+	_, err = cliutil.GetOrCreateEarthlyDir()
+	if err == nil {
+		err = explaincache.Save(p, cur)
+	}
+	if err != nil {
+		console.Warnf("Failed to record the build of %s: %v\n", target.String(), err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/urfave/cli/v2"
 
 	"github.com/earthly/earthly/util/containerutil"
+	"github.com/earthly/earthly/util/saveartifactlocally"
 )
 
 func (app *earthlyApp) rootFlags() []cli.Flag {
@@ -286,7 +287,7 @@ func (app *earthlyApp) buildFlags() []cli.Flag {
 		&cli.StringFlag{
 			Name:        "remote-cache",
 			EnvVars:     []string{"EARTHLY_REMOTE_CACHE"},
-			Usage:       "A remote docker image tag use as explicit cache",
+			Usage:       "A remote docker image tag use as explicit cache, or a type=local,dest=<dir> or type=s3,bucket=<bucket>,... cache",
 			Destination: &app.remoteCache,
 		},
 		&cli.BoolFlag{
@@ -327,6 +328,79 @@ func (app *earthlyApp) buildFlags() []cli.Flag {
 			Usage:       "Disallow usage of features that may create unrepeatable builds",
 			Destination: &app.strict,
 		},
+		&cli.BoolFlag{
+			Name:        "keep-going",
+			EnvVars:     []string{"EARTHLY_KEEP_GOING"},
+			Usage:       wrap("Do not cancel independent targets when a target fails, ", "report all failed targets at the end of the build"),
+			Destination: &app.keepGoing,
+		},
+		&cli.BoolFlag{
+			Name:        "rerun-failed",
+			EnvVars:     []string{"EARTHLY_RERUN_FAILED"},
+			Usage:       "Re-run only the targets which have failed in the last build, with their original build args and platform",
+			Destination: &app.rerunFailed,
+		},
+		&cli.BoolFlag{
+			Name:        "watch",
+			EnvVars:     []string{"EARTHLY_WATCH"},
+			Usage:       wrap("Watch the local files used by the build (Earthfiles and files referenced via COPY) ", "and re-run the build whenever they change"),
+			Destination: &app.watch,
+		},
+		&cli.StringFlag{
+			Name:        "image-output",
+			EnvVars:     []string{"EARTHLY_IMAGE_OUTPUT"},
+			Usage:       wrap("Write all output images into the given OCI image layout dir (oci-dir:<dir>), ", "instead of loading them into the container frontend"),
+			Destination: &app.imageOutput,
+		},
+		&cli.StringFlag{
+			Name:        "output-root",
+			EnvVars:     []string{"EARTHLY_OUTPUT_ROOT"},
+			Usage:       wrap("Write all the SAVE ARTIFACT ... AS LOCAL outputs under the given directory, preserving their relative paths, ", "along with a manifest of the files written, instead of into the source tree"),
+			Destination: &app.outputRoot,
+		},
+		&cli.StringFlag{
+			Name:        "checksum-manifest",
+			EnvVars:     []string{"EARTHLY_CHECKSUM_MANIFEST"},
+			Usage:       wrap("Write the checksums of all the files saved via SAVE ARTIFACT ... AS LOCAL into the given file, ", "in the JSON format if it ends with .json, or in the GNU coreutils format (as in SHA256SUMS) otherwise"),
+			Destination: &app.checksumManifest,
+		},
+		&cli.StringFlag{
+			Name:        "checksum-algorithm",
+			EnvVars:     []string{"EARTHLY_CHECKSUM_ALGORITHM"},
+			Usage:       "The checksum algorithm of --checksum-manifest; one of sha256 or sha512",
+			Value:       saveartifactlocally.ChecksumSHA256,
+			Destination: &app.checksumAlgorithm,
+		},
+		&cli.StringFlag{
+			Name:        "sbom",
+			EnvVars:     []string{"EARTHLY_SBOM"},
+			Usage:       wrap("Generate an SBOM in the given format (spdx or cyclonedx) for every output image, ", "as if SAVE IMAGE --sbom was used"),
+			Destination: &app.sbomFormat,
+		},
+		&cli.BoolFlag{
+			Name:        "provenance",
+			EnvVars:     []string{"EARTHLY_PROVENANCE"},
+			Usage:       wrap("Generate SLSA provenance statements for the output images and artifacts, ", "and attach them to pushed images"),
+			Destination: &app.provenance,
+		},
+		&cli.BoolFlag{
+			Name:        "verify-reproducible",
+			EnvVars:     []string{"EARTHLY_VERIFY_REPRODUCIBLE"},
+			Usage:       wrap("Build the target twice, the second time without cache, and report the files which differ ", "between the output images and artifacts of the two builds"),
+			Destination: &app.verifyReproducible,
+		},
+		&cli.BoolFlag{
+			Name:        "explain-cache",
+			EnvVars:     []string{"EARTHLY_EXPLAIN_CACHE"},
+			Usage:       wrap("Record the steps of the build and, for every step which is not cached, report the first input ", "which changed since the previous build of the same target: an ARG value, a local file, a base image or a parent step"),
+			Destination: &app.explainCache,
+		},
+		&cli.StringFlag{
+			Name:        "source-date-epoch",
+			EnvVars:     []string{"EARTHLY_SOURCE_DATE_EPOCH"},
+			Usage:       wrap("Enable reproducible builds by clamping the file timestamps and the image created time to the given unix timestamp, ", "or to the git commit timestamp when set to 'git'"),
+			Destination: &app.sourceDateEpoch,
+		},
 		&cli.BoolFlag{
 			Name:        "global-wait-end",
 			EnvVars:     []string{"EARTHLY_GLOBAL_WAIT_END"},
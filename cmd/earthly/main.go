@@ -25,6 +25,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
@@ -35,9 +37,13 @@ import (
 	"github.com/earthly/earthly/config"
 	"github.com/earthly/earthly/conslogging"
 	"github.com/earthly/earthly/earthfile2llb"
+	"github.com/earthly/earthly/tracing"
+	"github.com/earthly/earthly/util/cachemount"
 	"github.com/earthly/earthly/util/cliutil"
 	"github.com/earthly/earthly/util/containerutil"
+	"github.com/earthly/earthly/util/explaincache"
 	"github.com/earthly/earthly/util/fileutil"
+	"github.com/earthly/earthly/util/lastbuild"
 	"github.com/earthly/earthly/util/reflectutil"
 	"github.com/earthly/earthly/util/stringutil"
 )
@@ -58,6 +64,9 @@ type earthlyApp struct {
 	cfg         *config.Config
 	sessionID   string
 	commandName string
+	rootSpan    trace.Span
+	// shutdownTracing flushes any pending trace spans.
+	shutdownTracing func(context.Context) error
 	cliFlags
 	analyticsMetadata
 }
@@ -77,6 +86,10 @@ type cliFlags struct {
 	noCache                   bool
 	pruneAll                  bool
 	pruneReset                bool
+	pruneOlderThan            time.Duration
+	pruneKeepStorage          string
+	pruneFilters              cli.StringSlice
+	pruneDryRun               bool
 	buildkitdSettings         buildkitd.Settings
 	allowPrivileged           bool
 	enableProfiler            bool
@@ -139,6 +152,25 @@ type cliFlags struct {
 	userPermission            string
 	noBuildkitUpdate          bool
 	globalWaitEnd             bool // for feature-flipping builder.go code removal
+	keepGoing                 bool
+	rerunFailed               bool
+	watch                     bool
+	imageOutput               string
+	outputRoot                string
+	checksumManifest          string
+	checksumAlgorithm         string
+	sbomFormat                string
+	provenance                bool
+	sourceDateEpoch           string
+	verifyReproducible        bool
+	verifyKey                 string
+	invocationRecorder        *lastbuild.Recorder
+	cacheMountRecorder        *cachemount.Recorder
+	explainCache              bool
+	explainCacheRecorder      *explaincache.Recorder
+	cacheOlderThan            time.Duration
+	cacheLargerThan           string
+	cacheRemoveAll            bool
 	projectName               string
 	orgName                   string
 	invitePermission          string
@@ -264,6 +296,7 @@ func main() {
 	app.autoComplete(ctx)
 
 	exitCode := app.run(ctx, os.Args)
+	app.endTracing(exitCode)
 	// app.cfg will be nil when a user runs `earthly --version`;
 	// however in all other regular commands app.cfg will be set in app.Before
 	if !app.disableAnalytics && app.cfg != nil && !app.cfg.Global.DisableAnalytics {
@@ -408,6 +441,17 @@ func (app *earthlyApp) before(context *cli.Context) error {
 		return err
 	}
 
+	app.shutdownTracing, err = tracing.Init(context.Context, tracing.Opt{
+		Endpoint: app.cfg.Global.OtelEndpoint,
+		Protocol: app.cfg.Global.OtelProtocol,
+		Insecure: app.cfg.Global.OtelInsecure,
+		Version:  Version,
+	})
+	if err != nil {
+		return errors.Wrap(err, "init tracing")
+	}
+	context.Context, app.rootSpan = tracing.Start(context.Context, "earthly")
+
 	// Make a small attempt to check if we are not bootstrapped. If not, then do that before we do anything else.
 	isBootstrapCmd := false
 	for _, f := range context.Args().Slice() {
@@ -429,6 +473,29 @@ func (app *earthlyApp) before(context *cli.Context) error {
 	return nil
 }
 
+func (app *earthlyApp) endTracing(exitCode int) {
+	if app.rootSpan != nil {
+		app.rootSpan.SetAttributes(
+			attribute.String("earthly.command", app.commandName),
+			attribute.Int("earthly.exit_code", exitCode),
+		)
+		var err error
+		if exitCode != 0 {
+			err = fmt.Errorf("exit code %d", exitCode)
+		}
+		tracing.End(app.rootSpan, err)
+	}
+	if app.shutdownTracing != nil {
+		// Use a new context, in case the original context is cancelled due to sigint.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := app.shutdownTracing(ctx)
+		if err != nil && app.verbose {
+			app.console.Warnf("unable to export traces: %s", err)
+		}
+	}
+}
+
 func (app *earthlyApp) warnIfEarth() {
 	if len(os.Args) == 0 {
 		return
@@ -532,6 +599,23 @@ func (app *earthlyApp) run(ctx context.Context, args []string) int {
 	rpcRegex := regexp.MustCompile(`(?U)rpc error: code = .+ desc = `)
 	err := app.cliApp.RunContext(ctx, args)
 	if err != nil {
+		if fte, ok := earthfile2llb.GetFailedTargetsError(err); ok {
+			app.console.Warnf("Error: %d targets failed\n", len(fte.Errs))
+			for _, targetErr := range fte.Errs {
+				if ie, ok := earthfile2llb.GetInterpreterError(targetErr); ok && !app.verbose {
+					var te *earthfile2llb.TargetError
+					if errors.As(targetErr, &te) {
+						app.console.Warnf("Error: %s: %s\n", te.Target, ie.Error())
+						continue
+					}
+				}
+				app.console.Warnf("Error: %v\n", targetErr)
+			}
+			if errors.Is(err, context.Canceled) {
+				return 2
+			}
+			return 1
+		}
 		ie, isInterpereterError := earthfile2llb.GetInterpreterError(err)
 
 		var failedOutput string
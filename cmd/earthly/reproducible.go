@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/earthly/earthly/builder"
+	"github.com/earthly/earthly/domain"
+	"github.com/earthly/earthly/util/lastbuild"
+	"github.com/earthly/earthly/util/reproducible"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// verifyReproducibleBuild builds the target twice, the second time without using the cache, and compares the
+// output images and artifacts of the two builds. The output images are written into temporary OCI image
+// layouts, such that their layers can be compared, rather than being loaded into the container frontend.
+func (app *earthlyApp) verifyReproducibleBuild(cliCtx *cli.Context, target domain.Target, builderOpts builder.Opt, buildOpts builder.BuildOpt) error {
+	tmpDir, err := os.MkdirTemp("", "earthly-verify-reproducible")
+	if err != nil {
+		return errors.Wrap(err, "create temp dir")
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var outputs [2]*reproducible.Outputs
+	for i := range outputs {
+		if i > 0 {
+			app.console.Printf("Building %s again, without using the cache, to verify its reproducibility\n", target.String())
+			app.invocationRecorder = lastbuild.NewRecorder()
+			builderOpts.InvocationRecorder = app.invocationRecorder
+			builderOpts.NoCache = true
+		}
+		builderOpts.ImageOutputDir = filepath.Join(tmpDir, fmt.Sprintf("build%d", i+1))
+		b, err := builder.NewBuilder(cliCtx.Context, builderOpts)
+		if err != nil {
+			return errors.Wrap(err, "new builder")
+		}
+		_, err = b.BuildTarget(cliCtx.Context, target, buildOpts)
+		app.invocationRecorder.FinishRoot(err)
+		if err != nil {
+			return errors.Wrap(err, "build target")
+		}
+		// The artifacts are snapshotted right away, since the next build overwrites them.
+		outputs[i], err = reproducible.Collect(b.ArtifactOutputs(), builderOpts.ImageOutputDir)
+		if err != nil {
+			return errors.Wrap(err, "collect build outputs")
+		}
+	}
+
+	mismatches, err := reproducible.Compare(outputs[0], outputs[1])
+	if err != nil {
+		return errors.Wrap(err, "compare build outputs")
+	}
+	if len(mismatches) == 0 {
+		app.console.Printf("%s is reproducible: %d artifacts and %d images are identical across both builds\n",
+			target.String(), len(outputs[0].Artifacts), len(outputs[0].Images))
+		return nil
+	}
+	for _, m := range mismatches {
+		app.console.Warnf("Output %s differs between the builds:\n", m.Output)
+		for _, r := range m.Reasons {
+			app.console.Warnf("  %s\n", r)
+		}
+		for _, f := range m.Files {
+			app.console.Warnf("  %s\n", f.String())
+		}
+	}
+	return errors.Errorf("%s is not reproducible: %d outputs differ between the builds", target.String(), len(mismatches))
+}
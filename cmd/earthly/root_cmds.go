@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/moby/buildkit/client"
@@ -25,6 +26,7 @@ import (
 	"github.com/earthly/earthly/earthfile2llb"
 	"github.com/earthly/earthly/util/cliutil"
 	"github.com/earthly/earthly/util/fileutil"
+	"github.com/earthly/earthly/util/pruneutil"
 	"github.com/earthly/earthly/util/termutil"
 )
 
@@ -173,6 +175,51 @@ func (app *earthlyApp) rootCmds() []*cli.Command {
 					Usage:       "Reset cache entirely by wiping cache dir",
 					Destination: &app.pruneReset,
 				},
+				&cli.DurationFlag{
+					Name:        "older-than",
+					EnvVars:     []string{"EARTHLY_PRUNE_OLDER_THAN"},
+					Usage:       "Prune only the cache which has not been used for the given duration, e.g. 72h",
+					Destination: &app.pruneOlderThan,
+				},
+				&cli.StringFlag{
+					Name:        "keep-storage",
+					EnvVars:     []string{"EARTHLY_PRUNE_KEEP_STORAGE"},
+					Usage:       "Prune the least recently used cache until its size is below the given size, e.g. 20GB",
+					Destination: &app.pruneKeepStorage,
+				},
+				&cli.StringSliceFlag{
+					Name:        "filter",
+					EnvVars:     []string{"EARTHLY_PRUNE_FILTER"},
+					Usage:       "Prune only the cache records matching the filter, e.g. type=exec.cachemount; can be repeated",
+					Destination: &app.pruneFilters,
+				},
+				&cli.BoolFlag{
+					Name:        "dry-run",
+					EnvVars:     []string{"EARTHLY_PRUNE_DRY_RUN"},
+					Usage:       "Print what would be pruned, without pruning anything",
+					Destination: &app.pruneDryRun,
+				},
+			},
+		},
+		{
+			Name:        "cache",
+			Usage:       "Inspect and manage the cache mounts of the build cache",
+			Description: "Inspect and manage the cache mounts (CACHE and RUN --mount type=cache) of the build cache",
+			Subcommands: app.cacheCmds(),
+		},
+		{
+			Name:        "verify",
+			Usage:       "Verify the signature of an image signed via SAVE IMAGE --sign",
+			Description: "Verify the signature of an image signed via SAVE IMAGE --sign",
+			ArgsUsage:   "<image>",
+			Action:      app.actionVerify,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "key",
+					EnvVars:     []string{"EARTHLY_VERIFY_KEY"},
+					Usage:       "The path to the PEM public key to verify the signature with; defaults to the public key of the configured signing key",
+					Destination: &app.verifyKey,
+				},
 			},
 		},
 		{
@@ -636,7 +683,28 @@ func (app *earthlyApp) actionPrune(cliCtx *cli.Context) error {
 	if cliCtx.NArg() != 0 {
 		return errors.New("invalid arguments")
 	}
+	pruneOpts := pruneutil.Options{
+		All:          app.pruneAll,
+		KeepDuration: app.pruneOlderThan,
+	}
+	if app.pruneKeepStorage != "" {
+		keepBytes, err := humanize.ParseBytes(app.pruneKeepStorage)
+		if err != nil {
+			return errors.Wrapf(err, "parse --keep-storage %s", app.pruneKeepStorage)
+		}
+		pruneOpts.KeepBytes = int64(keepBytes)
+	}
+	for _, f := range app.pruneFilters.Value() {
+		filter, err := pruneutil.ParseFilter(f)
+		if err != nil {
+			return err
+		}
+		pruneOpts.Filters = append(pruneOpts.Filters, filter)
+	}
 	if app.pruneReset {
+		if app.pruneOlderThan != 0 || app.pruneKeepStorage != "" || len(pruneOpts.Filters) != 0 || app.pruneDryRun {
+			return errors.New("--reset cannot be combined with --older-than, --keep-storage, --filter or --dry-run")
+		}
 		if app.isUsingSatellite(cliCtx) {
 			return errors.New("Cannot prune --reset when using a satellite. Try without --reset")
 		}
@@ -661,14 +729,38 @@ func (app *earthlyApp) actionPrune(cliCtx *cli.Context) error {
 		return errors.Wrap(err, "prune new buildkitd client")
 	}
 	defer bkClient.Close()
-	var opts []client.PruneOption
-	if app.pruneAll {
-		opts = append(opts, client.PruneAll)
+	// The records returned by the prune do not carry their type, hence the types are looked up beforehand.
+	records, err := bkClient.DiskUsage(cliCtx.Context)
+	if err != nil {
+		return errors.Wrap(err, "get buildkit disk usage")
+	}
+	recordTypes := make(map[string]client.UsageRecordType, len(records))
+	for _, r := range records {
+		recordTypes[r.ID] = r.RecordType
+	}
+	summary := pruneutil.NewSummary()
+
+	if app.pruneDryRun {
+		candidates := records
+		if len(pruneOpts.Filters) != 0 {
+			candidates, err = bkClient.DiskUsage(cliCtx.Context, pruneOpts.DiskUsageOptions()...)
+			if err != nil {
+				return errors.Wrap(err, "get buildkit disk usage")
+			}
+		}
+		for _, r := range pruneutil.Plan(records, candidates, pruneOpts, time.Now()) {
+			app.console.Printf("%s\t%s\t%s\n", r.ID, r.RecordType, humanize.Bytes(uint64(r.Size)))
+			summary.Add(r.RecordType, r.Size)
+		}
+		app.printPruneSummary(summary)
+		app.console.Printf("Would free about %s\n", humanize.Bytes(uint64(summary.Size())))
+		return nil
 	}
+
 	ch := make(chan client.UsageInfo, 1)
 	eg, ctx := errgroup.WithContext(cliCtx.Context)
 	eg.Go(func() error {
-		err = bkClient.Prune(ctx, ch, opts...)
+		err = bkClient.Prune(ctx, ch, pruneOpts.PruneOptions()...)
 		if err != nil {
 			return errors.Wrap(err, "buildkit prune")
 		}
@@ -676,7 +768,6 @@ func (app *earthlyApp) actionPrune(cliCtx *cli.Context) error {
 		return nil
 	})
 
-	total := uint64(0)
 	eg.Go(func() error {
 		for {
 			select {
@@ -684,8 +775,9 @@ func (app *earthlyApp) actionPrune(cliCtx *cli.Context) error {
 				if !ok {
 					return nil
 				}
-				app.console.Printf("%s\t%s\n", usageInfo.ID, humanize.Bytes(uint64(usageInfo.Size)))
-				total += uint64(usageInfo.Size)
+				recordType := recordTypes[usageInfo.ID]
+				app.console.Printf("%s\t%s\t%s\n", usageInfo.ID, recordType, humanize.Bytes(uint64(usageInfo.Size)))
+				summary.Add(recordType, usageInfo.Size)
 			case <-ctx.Done():
 				return nil
 			}
@@ -695,10 +787,17 @@ func (app *earthlyApp) actionPrune(cliCtx *cli.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "err group")
 	}
-	app.console.Printf("Freed %s\n", humanize.Bytes(total))
+	app.printPruneSummary(summary)
+	app.console.Printf("Freed %s\n", humanize.Bytes(uint64(summary.Size())))
 	return nil
 }
 
+func (app *earthlyApp) printPruneSummary(summary *pruneutil.Summary) {
+	for _, t := range summary.Totals() {
+		app.console.Printf("%s: %d records, %s\n", t.Type, t.Count, humanize.Bytes(uint64(t.Size)))
+	}
+}
+
 func (app *earthlyApp) actionPreviewPromoted(name, dest string) cli.ActionFunc {
 	return func(*cli.Context) error {
 		return errors.Errorf("the %q command has been moved out of \"preview\" is now available under %q", name, dest)
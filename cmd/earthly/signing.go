@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto"
+	"os"
+	"path/filepath"
+
+	"github.com/earthly/earthly/buildkitd"
+	"github.com/earthly/earthly/util/cliutil"
+	"github.com/earthly/earthly/util/ociartifact"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/auth/authprovider"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	signingKeyEnv         = "EARTHLY_SIGNING_KEY"
+	signingKeyPasswordEnv = "EARTHLY_SIGNING_KEY_PASSWORD"
+	cosignPasswordEnv     = "COSIGN_PASSWORD"
+)
+
+// signingKeyPEM returns the PEM-encoded key used to sign images, provided either via the EARTHLY_SIGNING_KEY
+// env var or via the file configured as global.signing_key. It returns nil if no key is configured.
+func (app *earthlyApp) signingKeyPEM() ([]byte, error) {
+	if k, ok := os.LookupEnv(signingKeyEnv); ok && k != "" {
+		return []byte(k), nil
+	}
+	keyPath := app.cfg.Global.SigningKey
+	if keyPath == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(keyPath) {
+		keyPath = filepath.Join(cliutil.GetEarthlyDir(), keyPath)
+	}
+	dt, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read signing key %s", keyPath)
+	}
+	return dt, nil
+}
+
+// loadSigningKey returns the key used to sign images, or nil if no key is configured. Encrypted (cosign)
+// keys are decrypted with the password from EARTHLY_SIGNING_KEY_PASSWORD or COSIGN_PASSWORD.
+func (app *earthlyApp) loadSigningKey() (crypto.Signer, error) {
+	dt, err := app.signingKeyPEM()
+	if err != nil || dt == nil {
+		return nil, err
+	}
+	return ociartifact.ParsePrivateKey(dt, func() ([]byte, error) {
+		for _, env := range []string{signingKeyPasswordEnv, cosignPasswordEnv} {
+			if pw, ok := os.LookupEnv(env); ok {
+				return []byte(pw), nil
+			}
+		}
+		return nil, errors.Errorf("the signing key is encrypted; provide its password via %s", signingKeyPasswordEnv)
+	})
+}
+
+// registry returns the config used to access the registries of signatures, attestations and OCI artifacts,
+// which honors the insecure registries configured via buildkit_additional_config.
+func (app *earthlyApp) registry() ociartifact.Registry {
+	plainHTTP, skipVerify := buildkitd.InsecureRegistries(app.cfg.Global.BuildkitAdditionalConfig)
+	return ociartifact.Registry{
+		PlainHTTP:  plainHTTP,
+		SkipVerify: skipVerify,
+	}
+}
+
+func (app *earthlyApp) actionVerify(cliCtx *cli.Context) error {
+	app.commandName = "verify"
+	if cliCtx.NArg() != 1 {
+		return errors.New("verify requires exactly one image")
+	}
+	ref := cliCtx.Args().First()
+
+	var pub crypto.PublicKey
+	if app.verifyKey != "" {
+		dt, err := os.ReadFile(app.verifyKey)
+		if err != nil {
+			return errors.Wrapf(err, "read public key %s", app.verifyKey)
+		}
+		pub, err = ociartifact.ParsePublicKey(dt)
+		if err != nil {
+			return err
+		}
+	} else {
+		key, err := app.loadSigningKey()
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			return errors.Errorf("no key to verify with; use --key, or configure global.signing_key or %s", signingKeyEnv)
+		}
+		pub = key.Public()
+	}
+
+	authProvider := authprovider.NewDockerAuthProvider(config.LoadDefaultConfigFile(os.Stderr))
+	reg := app.registry()
+	reg.Creds = ociartifact.CredentialsFromAttachables(cliCtx.Context, []session.Attachable{authProvider})
+	dgst, err := ociartifact.Verify(cliCtx.Context, ref, pub, reg)
+	if err != nil {
+		return err
+	}
+	app.console.Printf("Verified signature of image %s (%s)\n", ref, dgst)
+	return nil
+}
@@ -80,6 +80,12 @@ type GlobalConfig struct {
 	IPTables                 string   `yaml:"ip_tables"                  help:"Which iptables binary to use. Valid values are iptables-legacy or iptables-nft. Bypasses any autodetection."`
 	DisableLogSharing        bool     `yaml:"disable_log_sharing"        help:"Disable cloud log sharing when logged in with an Earthly account, see https://ci.earthly.dev for details."`
 	SecretProvider           string   `yaml:"secret_provider"            help:"Command to execute to retrieve secret."`
+	OtelEndpoint             string   `yaml:"otel_endpoint"              help:"The OTLP collector endpoint to export traces to, as host:port or URL. Falls back to the standard OTEL_EXPORTER_OTLP_ENDPOINT env var."`
+	OtelProtocol             string   `yaml:"otel_protocol"              help:"The OTLP protocol used to export traces. Valid options are 'grpc' and 'http/protobuf'. Falls back to the standard OTEL_EXPORTER_OTLP_PROTOCOL env var, defaults to 'grpc'."`
+	OtelInsecure             bool     `yaml:"otel_insecure"              help:"Disable TLS when exporting traces to the OTLP collector."`
+	SigningKey               string   `yaml:"signing_key"                help:"The path to the PEM private key used to sign images saved via SAVE IMAGE --sign. Relative paths are interpreted as relative to ~/.earthly. Can be overridden by providing the key itself via the EARTHLY_SIGNING_KEY env var."`
+
+	BuildkitGCPolicy []GCPolicyRule `yaml:"buildkit_gc_policy" help:"The garbage-collection policy of the buildkit cache, as a list of rules applied in order. Replaces the default policy derived from cache_size_mb and cache_size_pct. Requires YAML literal to set directly."`
 
 	// Obsolete.
 	CachePath      string `yaml:"cache_path"         help:" *Deprecated* The path to keep Earthly's cache."`
@@ -87,6 +93,14 @@ type GlobalConfig struct {
 	BuildkitScheme string `yaml:"buildkit_transport" help:" *Deprecated* Change how Earthly communicates with its buildkit daemon. Valid options are: docker-container, tcp. TCP is experimental."`
 }
 
+// GCPolicyRule is a rule of the garbage-collection policy of the buildkit cache
+type GCPolicyRule struct {
+	KeepDuration string   `yaml:"keep_duration" help:"Keep the cache records used within the duration, e.g. 2h or 7d."`
+	KeepBytes    string   `yaml:"keep_bytes"    help:"Keep the most recently used cache records within the size, e.g. 20GB."`
+	Filters      []string `yaml:"filters"       help:"Apply the rule only to the cache records matching any of the filters, e.g. type=source.local."`
+	All          bool     `yaml:"all"           help:"Apply the rule to all the cache records, including the internal ones."`
+}
+
 // GitConfig contains git-specific config values
 type GitConfig struct {
 	// these are used for git vendors (e.g. github, gitlab)
@@ -30,11 +30,14 @@ import (
 	"github.com/earthly/earthly/util/containerutil"
 	"github.com/earthly/earthly/util/fileutil"
 	"github.com/earthly/earthly/util/gitutil"
+	"github.com/earthly/earthly/util/imagebudget"
 	"github.com/earthly/earthly/util/inodeutil"
 	"github.com/earthly/earthly/util/llbutil"
 	"github.com/earthly/earthly/util/llbutil/llbfactory"
 	"github.com/earthly/earthly/util/llbutil/pllb"
+	"github.com/earthly/earthly/util/ociartifact"
 	"github.com/earthly/earthly/util/platutil"
+	"github.com/earthly/earthly/util/saveartifactlocally"
 	"github.com/earthly/earthly/util/stringutil"
 	"github.com/earthly/earthly/util/syncutil/semutil"
 	"github.com/earthly/earthly/variables"
@@ -52,6 +55,9 @@ import (
 	"github.com/pkg/errors"
 )
 
+// SourceDateEpochGit is the --source-date-epoch value which uses the git commit timestamp of each Earthfile.
+const SourceDateEpochGit = "git"
+
 type cmdType int
 
 const (
@@ -103,6 +109,7 @@ type Converter struct {
 	containerFrontend   containerutil.ContainerFrontend
 	waitBlockStack      []*waitBlock
 	isPipeline          bool
+	sourceDateEpoch     *time.Time // nil unless in reproducible mode
 }
 
 // NewConverter constructs a new converter for a given earthly target.
@@ -114,6 +121,7 @@ func NewConverter(ctx context.Context, target domain.Target, bc *buildcontext.Da
 		Visited: opt.Visited,
 	}
 	sts.AddOverridingVarsAsBuildArgInputs(opt.OverridingVars)
+	opt.ProvenanceCollector.AddTarget(sts.ID, target, bc.GitMetadata, sts)
 	newCollOpt := variables.NewCollectionOpt{
 		Console:          opt.Console,
 		Target:           target,
@@ -140,6 +148,11 @@ func NewConverter(ctx context.Context, target domain.Target, bc *buildcontext.Da
 		containerFrontend:   opt.ContainerFrontend,
 		waitBlockStack:      []*waitBlock{opt.waitBlock},
 	}
+	var err error
+	c.sourceDateEpoch, err = ParseSourceDateEpoch(opt.SourceDateEpoch, bc.GitMetadata)
+	if err != nil {
+		return nil, err
+	}
 
 	if c.opt.GlobalWaitBlockFtr {
 		c.ftrs.WaitBlock = true
@@ -147,6 +160,36 @@ func NewConverter(ctx context.Context, target domain.Target, bc *buildcontext.Da
 	return c, nil
 }
 
+// mainOutput returns the output of the main state, which changes whenever a command adds a layer to it.
+func (c *Converter) mainOutput() llb.Output {
+	return c.mts.Final.MainState.Output()
+}
+
+// addLayerSource records the command which created the topmost layer of the main state.
+func (c *Converter) addLayerSource(ls imagebudget.LayerSource) {
+	c.mts.Final.MainLayerSources = append(c.mts.Final.MainLayerSources, ls)
+}
+
+// ParseSourceDateEpoch returns the time which the file timestamps and the image created time are clamped to,
+// in reproducible mode. It returns nil if sourceDateEpoch is empty.
+func ParseSourceDateEpoch(sourceDateEpoch string, gitMeta *gitutil.GitMetadata) (*time.Time, error) {
+	switch sourceDateEpoch {
+	case "":
+		return nil, nil
+	case SourceDateEpochGit:
+		sourceDateEpoch = "0"
+		if gitMeta != nil && gitMeta.Timestamp != "" {
+			sourceDateEpoch = gitMeta.Timestamp
+		}
+	}
+	sec, err := strconv.ParseInt(sourceDateEpoch, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse source date epoch %q", sourceDateEpoch)
+	}
+	t := time.Unix(sec, 0).UTC()
+	return &t, nil
+}
+
 // From applies the earthly FROM command.
 func (c *Converter) From(ctx context.Context, imageName string, platform platutil.Platform, allowPrivileged bool, buildArgs []string) error {
 	err := c.checkAllowed(fromCmd)
@@ -193,6 +236,7 @@ func (c *Converter) fromClassical(ctx context.Context, imageName string, platfor
 	}
 	c.mts.Final.MainState = state
 	c.mts.Final.MainImage = img
+	c.mts.Final.MainLayerSources = nil
 	c.mts.Final.RanFromLike = true
 	c.varCollection.ResetEnvVars(envVars)
 	return nil
@@ -218,6 +262,7 @@ func (c *Converter) fromTarget(ctx context.Context, targetName string, platform
 	saveImage := relevantDepState.LastSaveImage()
 	// Pass on dep state over to this state.
 	c.mts.Final.MainState = relevantDepState.MainState
+	c.mts.Final.MainLayerSources = append([]imagebudget.LayerSource(nil), relevantDepState.MainLayerSources...)
 	c.varCollection.ResetEnvVars(mts.Final.VarCollection.EnvVars())
 	c.mts.Final.MainImage = saveImage.Image.Clone()
 	c.mts.Final.RanFromLike = mts.Final.RanFromLike
@@ -268,6 +313,7 @@ func (c *Converter) FromDockerfile(ctx context.Context, contextPath string, dfPa
 				return errors.Wrap(err, "resolve build context for dockerfile")
 			}
 			c.opt.BuildContextProvider.AddDirs(data.LocalDirs)
+			c.opt.WatchSet.AddFile(data.BuildFilePath)
 			dfData, err = os.ReadFile(data.BuildFilePath)
 			if err != nil {
 				return errors.Wrapf(err, "read file %s", data.BuildFilePath)
@@ -295,7 +341,7 @@ func (c *Converter) FromDockerfile(ctx context.Context, contextPath string, dfPa
 		}
 		BuildContextFactory = llbfactory.PreconstructedState(llbutil.CopyOp(
 			mts.Final.ArtifactsState, []string{contextArtifact.Artifact},
-			c.platr.Scratch(), "/", true, true, false, "", nil, false, false,
+			c.platr.Scratch(), "/", true, true, false, nil, "", nil, false, false,
 			c.ftrs.UseCopyLink,
 			llb.WithCustomNamef(
 				"%sFROM DOCKERFILE (copy build context from) %s%s",
@@ -329,8 +375,10 @@ func (c *Converter) FromDockerfile(ctx context.Context, contextPath string, dfPa
 			if err != nil {
 				return errors.Wrapf(err, "read file %s", data.BuildFilePath)
 			}
+			c.opt.WatchSet.AddFile(data.BuildFilePath)
 		}
 		BuildContextFactory = data.BuildContextFactory
+		watchLocalFactory(c.opt.WatchSet, BuildContextFactory, nil)
 	}
 	var pncvf variables.ProcessNonConstantVariableFunc
 	if !c.opt.Features.ShellOutAnywhere {
@@ -369,6 +417,7 @@ func (c *Converter) FromDockerfile(ctx context.Context, contextPath string, dfPa
 	state2, img2, envVars := c.applyFromImage(pllb.FromRawState(*state), &img)
 	c.mts.Final.MainState = state2
 	c.mts.Final.MainImage = img2
+	c.mts.Final.MainLayerSources = nil
 	c.mts.Final.RanFromLike = true
 	c.varCollection.ResetEnvVars(envVars)
 	return nil
@@ -476,7 +525,7 @@ func (c *Converter) CopyArtifact(ctx context.Context, artifactName string, dest
 	// Copy.
 	c.mts.Final.MainState = llbutil.CopyOp(
 		relevantDepState.ArtifactsState, []string{artifact.Artifact},
-		c.mts.Final.MainState, dest, true, isDir, keepTs, c.copyOwner(keepOwn, chown), chmod, ifExists, symlinkNoFollow,
+		c.mts.Final.MainState, dest, true, isDir, keepTs, c.sourceDateEpoch, c.copyOwner(keepOwn, chown), chmod, ifExists, symlinkNoFollow,
 		c.ftrs.UseCopyLink,
 		llb.WithCustomNamef(
 			"%sCOPY %s%s%s%s%s %s",
@@ -506,15 +555,21 @@ func (c *Converter) CopyClassical(ctx context.Context, srcs []string, dest strin
 		// create a new src state with the include patterns set (if this isn't done the entire context will be copied)
 		srcStateFactory := addIncludePathAndSharedKeyHint(c.buildContextFactory, srcs)
 		srcState = c.opt.LocalStateCache.getOrConstruct(srcStateFactory)
+		watchLocalFactory(c.opt.WatchSet, c.buildContextFactory, srcs)
 	} else {
 		srcState = c.buildContextFactory.Construct()
+		watchLocalFactory(c.opt.WatchSet, c.buildContextFactory, nil)
+	}
+	if localFactory, ok := c.buildContextFactory.(*llbfactory.LocalFactory); ok {
+		targetName, platform := c.explainCacheTarget()
+		c.opt.ExplainCacheRecorder.RecordCopy(ctx, targetName, platform, localFactory.GetName(), createIncludePatterns(srcs), localFactory.GetExcludePatterns())
 	}
 
 	c.nonSaveCommand()
 	c.mts.Final.MainState = llbutil.CopyOp(
 		srcState,
 		srcs,
-		c.mts.Final.MainState, dest, true, isDir, keepTs, c.copyOwner(keepOwn, chown), chmod, ifExists, false,
+		c.mts.Final.MainState, dest, true, isDir, keepTs, c.sourceDateEpoch, c.copyOwner(keepOwn, chown), chmod, ifExists, false,
 		c.ftrs.UseCopyLink,
 		llb.WithCustomNamef(
 			"%sCOPY %s%s%s %s",
@@ -526,6 +581,53 @@ func (c *Converter) CopyClassical(ctx context.Context, srcs []string, dest strin
 	return nil
 }
 
+// CopyOCI applies the earthly COPY command, with an OCI artifact (oci://<ref>) as the source. The files of the
+// artifact are pulled from the registry and copied into dest.
+func (c *Converter) CopyOCI(ctx context.Context, ref string, dest string, keepTs bool, keepOwn bool, chown string, chmod *fs.FileMode) error {
+	err := c.checkAllowed(copyCmd)
+	if err != nil {
+		return err
+	}
+	if chmod != nil && !c.ftrs.UseChmod {
+		return fmt.Errorf("COPY --chmod is not supported in this version")
+	}
+	outDir, err := os.MkdirTemp(os.TempDir(), "earthly-oci-artifact")
+	if err != nil {
+		return errors.Wrap(err, "mk temp dir for oci artifact")
+	}
+	c.opt.CleanCollection.Add(func() error {
+		return os.RemoveAll(outDir)
+	})
+	dgst, err := ociartifact.Pull(ctx, ref, outDir, c.opt.Registry)
+	if err != nil {
+		return errors.Wrapf(err, "pull oci artifact %s", ref)
+	}
+	// Name the local dir after the manifest digest, such that buildkit uses the cache
+	// when the artifact has not changed.
+	localName := fmt.Sprintf("oci-artifact-%s", dgst.Encoded())
+	srcState := pllb.Local(
+		localName,
+		llb.SessionID(c.opt.GwClient.BuildOpts().SessionID),
+		llb.Platform(c.platr.LLBNative()),
+		llb.WithCustomNamef("%soci artifact %s", c.vertexPrefix(false, false, true), ref),
+	)
+	c.opt.BuildContextProvider.AddDir(localName, outDir)
+
+	c.nonSaveCommand()
+	c.mts.Final.MainState = llbutil.CopyOp(
+		srcState,
+		[]string{"."},
+		c.mts.Final.MainState, dest, true, false, keepTs, c.sourceDateEpoch, c.copyOwner(keepOwn, chown), chmod, false, false,
+		c.ftrs.UseCopyLink,
+		llb.WithCustomNamef(
+			"%sCOPY %s%s %s",
+			c.vertexPrefix(false, false, false),
+			ociartifact.Scheme,
+			ref,
+			dest))
+	return nil
+}
+
 // ConvertRunOpts represents a set of options needed for the RUN command.
 type ConvertRunOpts struct {
 	CommandName          string
@@ -716,8 +818,22 @@ func (c *Converter) runCommand(ctx context.Context, outputFileName string, isExp
 	return string(outputDt), nil
 }
 
+// SaveArtifactOpt holds the options of the SAVE ARTIFACT command which control how the artifact is output.
+type SaveArtifactOpt struct {
+	// SaveAsOCI is the registry reference to push the artifact to (AS OCI), if any.
+	SaveAsOCI string
+	// Archive is the archive format (tar, tar.gz or zip) to save the artifact as, if any.
+	Archive string
+	// SyncDelete removes the files of the AS LOCAL destination directory which are not part of the artifact.
+	SyncDelete bool
+	// Checksum is the algorithm of the checksum sidecar file to write next to the artifact, if any.
+	Checksum string
+	// MediaType is the media type of the layers of the artifact pushed AS OCI.
+	MediaType string
+}
+
 // SaveArtifact applies the earthly SAVE ARTIFACT command.
-func (c *Converter) SaveArtifact(ctx context.Context, saveFrom string, saveTo string, saveAsLocalTo string, keepTs bool, keepOwn bool, ifExists, symlinkNoFollow, force bool, isPush bool) error {
+func (c *Converter) SaveArtifact(ctx context.Context, saveFrom string, saveTo string, saveAsLocalTo string, keepTs bool, keepOwn bool, ifExists, symlinkNoFollow, force bool, isPush bool, opt SaveArtifactOpt) error {
 	err := c.checkAllowed(saveArtifactCmd)
 	if err != nil {
 		return err
@@ -759,7 +875,7 @@ func (c *Converter) SaveArtifact(ctx context.Context, saveFrom string, saveTo st
 
 	c.mts.Final.ArtifactsState = llbutil.CopyOp(
 		pcState, []string{saveFrom}, c.mts.Final.ArtifactsState,
-		saveToAdjusted, true, true, keepTs, own, nil, ifExists, symlinkNoFollow,
+		saveToAdjusted, true, true, keepTs, c.sourceDateEpoch, own, nil, ifExists, symlinkNoFollow,
 		c.ftrs.UseCopyLink,
 		llb.WithCustomNamef(
 			"%sSAVE ARTIFACT %s%s%s %s",
@@ -768,35 +884,41 @@ func (c *Converter) SaveArtifact(ctx context.Context, saveFrom string, saveTo st
 			strIf(symlinkNoFollow, "--symlink-no-follow "),
 			saveFrom,
 			artifact.String()))
-	if saveAsLocalTo != "" {
+	if opt.SaveAsOCI != "" && !c.opt.DoPushes {
+		c.opt.Console.Printf("Did not push artifact %s to %s; use earthly --push to push it\n", artifact.String(), opt.SaveAsOCI)
+	} else if saveAsLocalTo != "" || opt.SaveAsOCI != "" {
+		outputStr := fmt.Sprintf("AS LOCAL %s", saveAsLocalTo)
+		if opt.SaveAsOCI != "" {
+			outputStr = fmt.Sprintf("AS OCI %s", opt.SaveAsOCI)
+		}
 		separateArtifactsState := c.platr.Scratch()
 		if isPush {
 			pushState := c.persistCache(c.mts.Final.RunPush.State)
 			separateArtifactsState = llbutil.CopyOp(
 				pushState, []string{saveFrom}, separateArtifactsState,
-				saveToAdjusted, true, true, keepTs, "root:root", nil, ifExists, symlinkNoFollow,
+				saveToAdjusted, true, true, keepTs, c.sourceDateEpoch, "root:root", nil, ifExists, symlinkNoFollow,
 				c.ftrs.UseCopyLink,
 				llb.WithCustomNamef(
-					"%sSAVE ARTIFACT %s%s%s %s AS LOCAL %s",
+					"%sSAVE ARTIFACT %s%s%s %s %s",
 					c.vertexPrefix(false, false, false),
 					strIf(ifExists, "--if-exists "),
 					strIf(symlinkNoFollow, "--symlink-no-follow "),
 					saveFrom,
 					artifact.String(),
-					saveAsLocalTo))
+					outputStr))
 		} else {
 			separateArtifactsState = llbutil.CopyOp(
 				pcState, []string{saveFrom}, separateArtifactsState,
-				saveToAdjusted, true, true, keepTs, "root:root", nil, ifExists, symlinkNoFollow,
+				saveToAdjusted, true, true, keepTs, c.sourceDateEpoch, "root:root", nil, ifExists, symlinkNoFollow,
 				c.ftrs.UseCopyLink,
 				llb.WithCustomNamef(
-					"%sSAVE ARTIFACT %s%s%s %s AS LOCAL %s",
+					"%sSAVE ARTIFACT %s%s%s %s %s",
 					c.vertexPrefix(false, false, false),
 					strIf(ifExists, "--if-exists "),
 					strIf(symlinkNoFollow, "--symlink-no-follow "),
 					saveFrom,
 					artifact.String(),
-					saveAsLocalTo))
+					outputStr))
 		}
 		c.mts.Final.SeparateArtifactsState = append(c.mts.Final.SeparateArtifactsState, separateArtifactsState)
 
@@ -805,7 +927,13 @@ func (c *Converter) SaveArtifact(ctx context.Context, saveFrom string, saveTo st
 			saveAsLocalToAdj = "./"
 		}
 
-		if !force {
+		if c.opt.OutputRoot != "" && saveAsLocalTo != "" {
+			// Rebased destinations are always safe to write to.
+			saveAsLocalToAdj, err = c.rebaseLocalDest(saveAsLocalToAdj)
+			if err != nil {
+				return err
+			}
+		} else if !force && saveAsLocalTo != "" {
 			canSave, err := c.canSave(ctx, saveAsLocalToAdj)
 			if err != nil {
 				return err
@@ -819,15 +947,23 @@ func (c *Converter) SaveArtifact(ctx context.Context, saveFrom string, saveTo st
 			}
 		}
 
+		// Directory artifacts replace the destination entirely (i.e. the stale files are removed), unless they
+		// are merged into it via the merge-local-artifacts feature.
 		saveLocal := states.SaveLocal{
 			DestPath:     saveAsLocalToAdj,
 			ArtifactPath: artifactPath,
 			Index:        len(c.mts.Final.SeparateArtifactsState) - 1,
 			IfExists:     ifExists,
+			Archive:      opt.Archive,
+			KeepTs:       keepTs,
+			SyncDelete:   opt.SyncDelete || !c.ftrs.MergeLocalArtifacts,
+			Checksum:     opt.Checksum,
+			OCIRef:       opt.SaveAsOCI,
+			MediaType:    opt.MediaType,
 		}
 
 		if c.ftrs.WaitBlock {
-			if c.opt.DoSaves {
+			if c.opt.DoSaves || opt.SaveAsOCI != "" {
 				c.waitBlock().addSaveArtifactLocal(saveLocal, c)
 			}
 		} else {
@@ -873,6 +1009,18 @@ func (c *Converter) canSave(ctx context.Context, saveAsLocalTo string) (bool, er
 	return strings.HasPrefix(saveAsLocalToAdj, basepath), nil
 }
 
+// rebaseLocalDest returns the AS LOCAL destination rebased under the output root.
+func (c *Converter) rebaseLocalDest(saveAsLocalTo string) (string, error) {
+	dest := saveAsLocalTo
+	if !path.IsAbs(dest) {
+		dest = path.Join(c.target.LocalPath, dest)
+		if strings.HasSuffix(saveAsLocalTo, "/") {
+			dest += "/"
+		}
+	}
+	return saveartifactlocally.RebaseDest(c.opt.OutputRoot, dest)
+}
+
 // SaveArtifactFromLocal saves a local file into the ArtifactsState
 func (c *Converter) SaveArtifactFromLocal(ctx context.Context, saveFrom, saveTo string, keepTs, keepOwn bool, chown string) error {
 	err := c.checkAllowed(saveArtifactCmd)
@@ -909,7 +1057,7 @@ func (c *Converter) SaveArtifactFromLocal(ctx context.Context, saveFrom, saveTo
 	ifExists := false
 	c.mts.Final.ArtifactsState = llbutil.CopyOp(
 		c.mts.Final.MainState, []string{absSaveTo}, c.mts.Final.ArtifactsState,
-		absSaveTo, true, true, keepTs, own, nil, ifExists, false,
+		absSaveTo, true, true, keepTs, c.sourceDateEpoch, own, nil, ifExists, false,
 		c.ftrs.UseCopyLink,
 	)
 	err = c.forceExecution(ctx, c.mts.Final.ArtifactsState, c.platr)
@@ -931,7 +1079,7 @@ func (c *Converter) waitBlock() *waitBlock {
 
 // PushWaitBlock should be called when a WAIT block starts, all commands will be added to this new block
 func (c *Converter) PushWaitBlock(ctx context.Context) error {
-	c.waitBlockStack = append(c.waitBlockStack, newWaitBlock())
+	c.waitBlockStack = append(c.waitBlockStack, newWaitBlock(c.opt.KeepGoing))
 	return nil
 }
 
@@ -956,8 +1104,26 @@ func (c *Converter) PopWaitBlock(ctx context.Context) error {
 	return waitBlock.wait(ctx)
 }
 
+// SaveImageOpt holds the options of the SAVE IMAGE command which control how the image is built and output.
+type SaveImageOpt struct {
+	// OCITar is the path of the OCI tarball to write the image to, if any.
+	OCITar string
+	// SBOMFormat is the format of the SBOM to generate for the image, if any.
+	SBOMFormat string
+	// Sign signs the pushed image.
+	Sign bool
+	// Budget is the maximum size and number of layers of the image.
+	Budget imagebudget.Budget
+	// Squash collapses the layers of the image into a single layer.
+	Squash bool
+	// SquashFrom is the base image whose layers are kept when squashing, if any.
+	SquashFrom string
+	// OCILabels sets the standard OCI labels and annotations of the image.
+	OCILabels bool
+}
+
 // SaveImage applies the earthly SAVE IMAGE command.
-func (c *Converter) SaveImage(ctx context.Context, imageNames []string, pushImages bool, insecurePush bool, cacheHint bool, cacheFrom []string, noManifestList bool) error {
+func (c *Converter) SaveImage(ctx context.Context, imageNames []string, pushImages bool, insecurePush bool, cacheHint bool, cacheFrom []string, noManifestList bool, opt SaveImageOpt) error {
 	err := c.checkAllowed(saveImageCmd)
 	if err != nil {
 		return err
@@ -966,8 +1132,34 @@ func (c *Converter) SaveImage(ctx context.Context, imageNames []string, pushImag
 		return fmt.Errorf("SAVE IMAGE --no-manifest-list is not supported in this version")
 	}
 	for _, cf := range cacheFrom {
+		if strings.Contains(cf, "=") {
+			// Local and S3 remote caches are only supported via the earthly command.
+			return errors.Errorf("SAVE IMAGE --cache-from only supports image names, got %s", cf)
+		}
 		c.opt.CacheImports.Add(cf)
 	}
+	if opt.OCITar != "" && !path.IsAbs(opt.OCITar) {
+		opt.OCITar = path.Join(c.target.LocalPath, opt.OCITar)
+	}
+	if opt.SBOMFormat == "" {
+		opt.SBOMFormat = c.opt.SBOMFormat
+	}
+	// The created time of the base image is never inherited; it is only set in reproducible mode.
+	img := c.mts.Final.MainImage.Clone()
+	img.Created = c.sourceDateEpoch
+	var annotations map[string]string
+	if opt.OCILabels {
+		annotations = c.applyOCILabels(img)
+	}
+	if opt.Budget.Enabled() {
+		opt.Budget.Sources = append([]imagebudget.LayerSource(nil), c.mts.Final.MainLayerSources...)
+		if opt.Squash {
+			opt.Budget.Sources = []imagebudget.LayerSource{{Command: "SAVE IMAGE --squash"}}
+			if opt.SquashFrom != "" {
+				opt.Budget.Sources = append([]imagebudget.LayerSource{{Command: "SAVE IMAGE --squash-from=" + opt.SquashFrom, Base: true}}, opt.Budget.Sources...)
+			}
+		}
+	}
 	justCacheHint := false
 	if len(imageNames) == 0 && cacheHint {
 		imageNames = []string{""}
@@ -980,12 +1172,18 @@ func (c *Converter) SaveImage(ctx context.Context, imageNames []string, pushImag
 			}
 			// pcState persists any files that may be cached via CACHE command.
 			pcState := c.persistCache(c.mts.Final.RunPush.State)
+			if opt.Squash {
+				pcState, err = c.squashState(ctx, pcState, opt.SquashFrom)
+				if err != nil {
+					return err
+				}
+			}
 			// SAVE IMAGE --push when it comes before any RUN --push should be treated as if they are in the main state,
 			// since thats their only dependency. It will still be marked as a push.
 			c.mts.Final.RunPush.SaveImages = append(c.mts.Final.RunPush.SaveImages,
 				states.SaveImage{
 					State:               pcState,
-					Image:               c.mts.Final.MainImage.Clone(), // We can get away with this because no Image details can vary in a --push. This should be fixed before then.
+					Image:               img.Clone(), // We can get away with this because no Image details can vary in a --push. This should be fixed before then.
 					DockerTag:           imageName,
 					Push:                pushImages,
 					InsecurePush:        insecurePush,
@@ -994,11 +1192,23 @@ func (c *Converter) SaveImage(ctx context.Context, imageNames []string, pushImag
 					ForceSave:           c.opt.ForceSaveImage,
 					CheckDuplicate:      c.ftrs.CheckDuplicateImages,
 					NoManifestList:      noManifestList,
+					OCITar:              opt.OCITar,
+					SBOM:                opt.SBOMFormat,
+					Sign:                opt.Sign,
+					Budget:              opt.Budget,
+					Annotations:         annotations,
 				})
 		} else {
+			state := c.persistCache(c.mts.Final.MainState)
+			if opt.Squash {
+				state, err = c.squashState(ctx, state, opt.SquashFrom)
+				if err != nil {
+					return err
+				}
+			}
 			si := states.SaveImage{
-				State:               c.persistCache(c.mts.Final.MainState),
-				Image:               c.mts.Final.MainImage.Clone(),
+				State:               state,
+				Image:               img.Clone(),
 				DockerTag:           imageName,
 				Push:                pushImages,
 				InsecurePush:        insecurePush,
@@ -1010,6 +1220,11 @@ func (c *Converter) SaveImage(ctx context.Context, imageNames []string, pushImag
 
 				Platform:    c.platr.Materialize(c.platr.Current()),
 				HasPlatform: platutil.IsPlatformDefined(c.platr.Current()),
+				OCITar:      opt.OCITar,
+				SBOM:        opt.SBOMFormat,
+				Sign:        opt.Sign,
+				Budget:      opt.Budget,
+				Annotations: annotations,
 			}
 
 			if c.ftrs.WaitBlock {
@@ -1038,6 +1253,26 @@ func (c *Converter) SaveImage(ctx context.Context, imageNames []string, pushImag
 	return nil
 }
 
+// squashState collapses the layers of the state into a single layer. If squashFrom is set, the layers of that
+// base image are kept, and only the changes made on top of it are collapsed.
+func (c *Converter) squashState(ctx context.Context, state pllb.State, squashFrom string) (pllb.State, error) {
+	squashed := pllb.Scratch().Platform(c.platr.ToLLBPlatform(c.platr.Current())).File(
+		pllb.Copy(state, "/", "/", &llb.CopyInfo{CopyDirContentsOnly: true}),
+		llb.WithCustomNamef("%sSAVE IMAGE --squash", c.vertexPrefix(false, false, false)))
+	if squashFrom == "" {
+		return squashed, nil
+	}
+	base, _, _, err := c.internalFromClassical(
+		ctx, squashFrom, c.platr.Current(),
+		llb.WithCustomNamef("%sSAVE IMAGE --squash-from=%s", c.vertexPrefix(false, false, false), squashFrom))
+	if err != nil {
+		return pllb.State{}, errors.Wrapf(err, "squash from %s", squashFrom)
+	}
+	// The diff is computed against the squashed state, which does not descend from the base, such that it
+	// is a single layer, which includes the deletions of the files of the base as whiteouts.
+	return pllb.Merge([]pllb.State{base, pllb.Diff(base, squashed)}), nil
+}
+
 // Build applies the earthly BUILD command.
 func (c *Converter) Build(ctx context.Context, fullTargetName string, platform platutil.Platform, allowPrivileged bool, buildArgs []string) error {
 	err := c.checkAllowed(buildCmd)
@@ -1057,7 +1292,17 @@ func (c *Converter) BuildAsync(ctx context.Context, fullTargetName string, platf
 	if err != nil {
 		return err
 	}
-	c.opt.ErrorGroup.Go(func() error {
+	if cmdT == buildCmd {
+		opt.invocation = opt.InvocationRecorder.Start(target, opt.PlatformResolver, opt.AllowPrivileged, opt.OverridingVars, false)
+	}
+	c.opt.ErrorGroup.Go(func() (retErr error) {
+		if cmdT == buildCmd {
+			defer func() {
+				if retErr != nil {
+					opt.InvocationRecorder.Finish(opt.invocation, retErr)
+				}
+			}()
+		}
 		if sem == nil {
 			sem = c.opt.Parallelism
 		}
@@ -1068,11 +1313,17 @@ func (c *Converter) BuildAsync(ctx context.Context, fullTargetName string, platf
 		defer rel()
 		mts, err := Earthfile2LLB(ctx, target, opt, false)
 		if err != nil {
+			if c.opt.KeepGoing {
+				return newTargetError(target.String(), err)
+			}
 			return errors.Wrapf(err, "async earthfile2llb for %s", fullTargetName)
 		}
 		if c.ftrs.ExecAfterParallel && mts != nil && mts.Final != nil {
 			err = c.forceExecution(ctx, mts.Final.MainState, mts.Final.PlatformResolver)
 			if err != nil {
+				if c.opt.KeepGoing {
+					return newTargetError(target.String(), err)
+				}
 				return errors.Wrapf(err, "async force execution for %s", fullTargetName)
 			}
 		}
@@ -1278,7 +1529,7 @@ func (c *Converter) GitClone(ctx context.Context, gitURL string, branch string,
 	}
 	gitState := pllb.Git(gitURL, branch, gitOpts...)
 	c.mts.Final.MainState = llbutil.CopyOp(
-		gitState, []string{"."}, c.mts.Final.MainState, dest, false, false, keepTs,
+		gitState, []string{"."}, c.mts.Final.MainState, dest, false, false, keepTs, c.sourceDateEpoch,
 		c.mts.Final.MainImage.Config.User, nil, false, false, c.ftrs.UseCopyLink,
 		llb.WithCustomNamef(
 			"%sCOPY GIT CLONE (--branch %s) %s TO %s", c.vertexPrefix(false, false, false),
@@ -1372,6 +1623,7 @@ func (c *Converter) Cache(ctx context.Context, mountTarget string) error {
 	}
 	mountID := path.Clean(mountTarget)
 	cachePath := path.Join("/run/cache", key, mountID)
+	c.opt.CacheMountRecorder.Record(cachePath, c.target.StringCanonical(), mountTarget)
 
 	if _, exists := c.persistentCacheDirs[mountTarget]; !exists {
 		c.persistentCacheDirs[mountTarget] = pllb.AddMount(mountTarget, pllb.Scratch(),
@@ -1475,6 +1727,15 @@ func (c *Converter) FinalizeStates(ctx context.Context) (*states.MultiTarget, er
 	// Persists any cache directories created by using a `CACHE` command
 	c.mts.Final.MainState = c.persistCache(c.mts.Final.MainState)
 
+	if c.opt.ExplainCacheRecorder != nil {
+		args := make(map[string]string)
+		for _, name := range c.varCollection.SortedActiveVariables() {
+			args[name], _ = c.varCollection.GetActive(name)
+		}
+		targetName, platform := c.explainCacheTarget()
+		c.opt.ExplainCacheRecorder.RecordArgs(targetName, platform, args)
+	}
+
 	c.mts.Final.PlatformResolver = c.platr
 	c.mts.Final.VarCollection = c.varCollection
 	c.mts.Final.GlobalImports = c.varCollection.Imports().Global()
@@ -1568,7 +1829,14 @@ func (c *Converter) buildTarget(ctx context.Context, fullTargetName string, plat
 	if err != nil {
 		return nil, err
 	}
+	if cmdT == buildCmd {
+		opt.invocation = opt.InvocationRecorder.Start(target, opt.PlatformResolver, opt.AllowPrivileged, opt.OverridingVars, false)
+	}
 	mts, err := Earthfile2LLB(ctx, target, opt, false)
+	if cmdT == buildCmd && err != nil {
+		// A successful conversion is not the end of the invocation: it remains pending until the solve.
+		opt.InvocationRecorder.Finish(opt.invocation, err)
+	}
 	if err != nil {
 		return nil, errors.Wrapf(err, "earthfile2llb for %s", fullTargetName)
 	}
@@ -1752,13 +2020,15 @@ func (c *Converter) internalRun(ctx context.Context, opts ConvertRunOpts) (pllb.
 		}
 		saveFiles := []debuggercommon.SaveFilesSettings{}
 		for _, interactiveSaveFile := range opts.InteractiveSaveFiles {
-
-			canSave, err := c.canSave(ctx, interactiveSaveFile.Dst)
-			if err != nil {
-				return pllb.State{}, err
-			}
-			if !canSave {
-				return pllb.State{}, fmt.Errorf("unable to save to %s; path must be located under %s", interactiveSaveFile.Dst, c.target.LocalPath)
+			if c.opt.OutputRoot == "" {
+				// Otherwise, the file is rebased under the output root when saved.
+				canSave, err := c.canSave(ctx, interactiveSaveFile.Dst)
+				if err != nil {
+					return pllb.State{}, err
+				}
+				if !canSave {
+					return pllb.State{}, fmt.Errorf("unable to save to %s; path must be located under %s", interactiveSaveFile.Dst, c.target.LocalPath)
+				}
 			}
 			dst := path.Join(localPathAbs, interactiveSaveFile.Dst)
 			c.opt.LocalArtifactWhiteList.Add(dst)
@@ -2044,6 +2314,8 @@ func (c *Converter) internalFromClassical(ctx context.Context, imageName string,
 	if err != nil {
 		return pllb.State{}, nil, nil, errors.Wrapf(err, "unmarshal image config for %s", imageName)
 	}
+	c.opt.ProvenanceCollector.AddBaseImage(baseImageName, platforms.Format(llbPlatform), dgst)
+	c.opt.ExplainCacheRecorder.RecordBaseImage(c.mts.Final.Target.String(), c.platr.Materialize(platform).String(), imageName, dgst)
 	if dgst != "" {
 		ref, err = reference.WithDigest(ref, dgst)
 		if err != nil {
@@ -2146,6 +2418,12 @@ func (c *Converter) vertexPrefix(local bool, interactive bool, internal bool) st
 	return vm.ToVertexPrefix()
 }
 
+// explainCacheTarget returns the target name and the platform the vertices of the current target are
+// attributed to, as in vertexPrefix.
+func (c *Converter) explainCacheTarget() (string, string) {
+	return c.mts.Final.Target.String(), c.platr.Materialize(c.platr.Current()).String()
+}
+
 func (c *Converter) imageVertexPrefix(id string, platform platutil.Platform) string {
 	platform = c.platr.Materialize(platform)
 	isNativePlatform := c.platr.PlatformEquals(platform, platutil.NativePlatform)
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/earthly/earthly/features"
+	"github.com/earthly/earthly/util/gitutil"
 )
 
 func Test_parseSecretFlag(t *testing.T) {
@@ -87,3 +88,45 @@ func Test_parseSecretFlag(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSourceDateEpoch(t *testing.T) {
+	gitMeta := &gitutil.GitMetadata{Timestamp: "1626881847"}
+	tests := []struct {
+		name    string
+		val     string
+		gitMeta *gitutil.GitMetadata
+		want    int64
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "disabled", val: "", gitMeta: gitMeta, wantNil: true},
+		{name: "unix seconds", val: "1600000000", gitMeta: gitMeta, want: 1600000000},
+		{name: "git", val: SourceDateEpochGit, gitMeta: gitMeta, want: 1626881847},
+		{name: "git without repo", val: SourceDateEpochGit, want: 0},
+		{name: "invalid", val: "yesterday", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseSourceDateEpoch(test.val, test.gitMeta)
+			if test.wantErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if test.wantNil {
+				if got != nil {
+					t.Errorf("expected nil, got %v", got)
+				}
+				return
+			}
+			if got == nil || got.Unix() != test.want {
+				t.Errorf("expected %d, got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -2,7 +2,9 @@ package earthfile2llb
 
 import (
 	"context"
+	"crypto"
 	"fmt"
+	"path/filepath"
 
 	"github.com/earthly/earthly/util/containerutil"
 	"github.com/earthly/earthly/util/gatewaycrafter"
@@ -12,6 +14,8 @@ import (
 	gwclient "github.com/moby/buildkit/frontend/gateway/client"
 	"github.com/moby/buildkit/util/apicaps"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/earthly/earthly/ast/spec"
 	"github.com/earthly/earthly/buildcontext"
@@ -21,8 +25,18 @@ import (
 	"github.com/earthly/earthly/domain"
 	"github.com/earthly/earthly/features"
 	"github.com/earthly/earthly/states"
+	"github.com/earthly/earthly/states/dedup"
+	"github.com/earthly/earthly/tracing"
+	"github.com/earthly/earthly/util/cachemount"
+	"github.com/earthly/earthly/util/explaincache"
+	"github.com/earthly/earthly/util/lastbuild"
+	"github.com/earthly/earthly/util/ociartifact"
+	"github.com/earthly/earthly/util/provenance"
+	"github.com/earthly/earthly/util/saveartifactlocally"
+	"github.com/earthly/earthly/util/sbom"
 	"github.com/earthly/earthly/util/syncutil/semutil"
 	"github.com/earthly/earthly/util/syncutil/serrgroup"
+	"github.com/earthly/earthly/util/watchutil"
 	"github.com/earthly/earthly/variables"
 )
 
@@ -59,7 +73,8 @@ type ConvertOpt struct {
 	BuildContextProvider *provider.BuildContextProvider
 	// MetaResolver is the image meta resolver to use for resolving image metadata.
 	MetaResolver llb.ImageMetaResolver
-	// CacheImports is a set of docker tags that can be used to import cache. Note that this
+	// CacheImports is a set of docker tags, or local and S3 remote cache specs (see
+	// llbutil.ParseRemoteCache), that can be used to import cache. Note that this
 	// set is modified by the converter if InlineCache is enabled.
 	CacheImports *states.CacheImports
 	// UseInlineCache enables the inline caching feature (use any SAVE IMAGE --push declaration as
@@ -113,6 +128,45 @@ type ConvertOpt struct {
 	Parallelism semutil.Semaphore
 	// ErrorGroup is a serrgroup used to submit parallel conversion jobs.
 	ErrorGroup *serrgroup.Group
+	// InvocationRecorder records the results of the target invocations (the initial target and any targets
+	// referenced via BUILD), such that failed ones can be re-run later.
+	InvocationRecorder *lastbuild.Recorder
+	// WatchSet records the local files used by the build (Earthfiles and the build context files
+	// referenced via COPY), such that they can be watched for changes.
+	WatchSet *watchutil.Set
+	// CacheMountRecorder records the cache mounts used by the build (via CACHE and RUN --mount type=cache),
+	// such that they can be attributed to their targets by the earthly cache commands.
+	CacheMountRecorder *cachemount.Recorder
+	// ExplainCacheRecorder records the ARG values, base images and local COPY sources of the targets, such
+	// that the cache misses of the next build can be explained.
+	ExplainCacheRecorder *explaincache.Recorder
+	// Registry configures the access to the registries used to push and pull OCI artifacts.
+	Registry ociartifact.Registry
+	// ImageOutputDir is the OCI image layout dir which all output images are written into,
+	// instead of being loaded into the container frontend.
+	ImageOutputDir string
+	// OutputRoot is the dir which all the SAVE ARTIFACT ... AS LOCAL destinations are rebased under, if set.
+	// The destinations outside of the Earthfile dir are then allowed without --force.
+	OutputRoot string
+	// SBOMFormat is the format of the SBOMs to generate for all the output images, if any.
+	SBOMFormat string
+	// SBOMCollector collects the SBOMs generated for images.
+	SBOMCollector *sbom.Collector
+	// ProvenanceCollector collects the provenance information of the build, if provenance is generated.
+	ProvenanceCollector *provenance.Collector
+	// SigningKey is the key used to sign the images saved via SAVE IMAGE --sign, if configured.
+	SigningKey crypto.Signer
+	// SigningKeyErr is the error which occurred loading the signing key, if any.
+	SigningKeyErr error
+	// SourceDateEpoch enables the reproducible mode, if set. It is either a unix timestamp, or
+	// SourceDateEpochGit for the git commit timestamp of each Earthfile.
+	SourceDateEpoch string
+	// invocation identifies the target invocation that the current conversion is part of.
+	invocation dedup.TargetInput
+
+	// KeepGoing, when true, prevents the failure of a target from cancelling the independent targets
+	// that are being built in parallel. All the failures are reported at the end.
+	KeepGoing bool
 
 	// FeatureFlagOverrides is used to override feature flags that are defined in specific Earthfiles
 	FeatureFlagOverrides string
@@ -149,6 +203,9 @@ type ConvertOpt struct {
 	// TempEarthlyOutDir is a path to a temp dir where artifacts are temporarily saved
 	TempEarthlyOutDir func() (string, error)
 
+	// OutputLock is the lock held while writing local outputs, shared by the whole build.
+	OutputLock *saveartifactlocally.ProcessOutputLock
+
 	// LLBCaps indicates that builder's capabilities
 	LLBCaps *apicaps.CapSet
 }
@@ -166,12 +223,22 @@ func Earthfile2LLB(ctx context.Context, target domain.Target, opt ConvertOpt, in
 	}
 	egWait := false
 	if opt.ErrorGroup == nil {
-		opt.ErrorGroup, ctx = serrgroup.WithContext(ctx)
+		if opt.KeepGoing {
+			opt.ErrorGroup, ctx = serrgroup.WithContextKeepGoing(ctx)
+		} else {
+			opt.ErrorGroup, ctx = serrgroup.WithContext(ctx)
+		}
 		egWait = true
 		defer func() {
 			if retErr == nil {
 				return
 			}
+			if egWait && opt.KeepGoing {
+				// Let the independent targets finish, and report all the failures.
+				opt.ErrorGroup.Wait()
+				retErr = newFailedTargetsError(append([]error{newTargetError(target.String(), retErr)}, opt.ErrorGroup.Errs()...)...)
+				return
+			}
 			if egWait {
 				// We haven't waited for the ErrorGroup yet. The ErrorGroup will
 				// return the very first error encountered, which may be
@@ -188,11 +255,21 @@ func Earthfile2LLB(ctx context.Context, target domain.Target, opt ConvertOpt, in
 			}
 		}()
 	}
+	if initialCall {
+		opt.invocation = opt.InvocationRecorder.Start(target, opt.PlatformResolver, opt.AllowPrivileged, opt.OverridingVars, true)
+	}
+	if !target.IsRemote() {
+		// Recorded before resolving, such that a fix to an Earthfile that fails to parse is picked up too.
+		opt.WatchSet.AddFile(filepath.Join(target.GetLocalPath(), "Earthfile"))
+	}
 	// Resolve build context.
 	bc, err := opt.Resolver.Resolve(ctx, opt.GwClient, opt.PlatformResolver, target)
 	if err != nil {
 		return nil, errors.Wrapf(err, "resolve build context for target %s", target.String())
 	}
+	if !target.IsRemote() {
+		opt.WatchSet.AddFile(bc.BuildFilePath)
+	}
 
 	opt.Features = bc.Features
 	if initialCall && !bc.Features.ReferencedSaveOnly {
@@ -203,7 +280,7 @@ func Earthfile2LLB(ctx context.Context, target domain.Target, opt ConvertOpt, in
 
 	wbWait := false
 	if opt.waitBlock == nil {
-		opt.waitBlock = newWaitBlock()
+		opt.waitBlock = newWaitBlock(opt.KeepGoing)
 
 		// we must call opt.waitBlock.wait(), since we are the creator.
 		// unfortunately this must be done before opt.ErrorGroup.Wait() is called (rather than here via a defer),
@@ -216,6 +293,7 @@ func Earthfile2LLB(ctx context.Context, target domain.Target, opt ConvertOpt, in
 	if err != nil {
 		return nil, err
 	}
+	opt.InvocationRecorder.AddTarget(opt.invocation, sts.ID)
 	if found {
 		if opt.DoSaves {
 			// Set the do saves flag, in case it was not set before.
@@ -227,6 +305,13 @@ func Earthfile2LLB(ctx context.Context, target domain.Target, opt ConvertOpt, in
 			Visited: opt.Visited,
 		}, nil
 	}
+	ctx, span := tracing.Start(ctx, "convert", trace.WithAttributes(
+		attribute.String("earthly.target", targetWithMetadata.String()),
+		attribute.String("earthly.platform", opt.PlatformResolver.Current().String()),
+	))
+	defer func() {
+		tracing.End(span, retErr)
+	}()
 	converter, err := NewConverter(ctx, targetWithMetadata, bc, sts, opt)
 	if err != nil {
 		return nil, err
@@ -242,19 +327,25 @@ func Earthfile2LLB(ctx context.Context, target domain.Target, opt ConvertOpt, in
 		return nil, err
 	}
 
+	var waitErr error
 	if wbWait {
-		err = opt.waitBlock.wait(ctx)
-		if err != nil {
-			return nil, err
+		waitErr = opt.waitBlock.wait(ctx)
+		if waitErr != nil && !opt.KeepGoing {
+			return nil, waitErr
 		}
 	}
 
 	if egWait {
 		egWait = false
 		err := opt.ErrorGroup.Wait()
+		if opt.KeepGoing {
+			err = newFailedTargetsError(append([]error{waitErr}, opt.ErrorGroup.Errs()...)...)
+		}
 		if err != nil {
 			return nil, err
 		}
+	} else if waitErr != nil {
+		return nil, waitErr
 	}
 	return mts, nil
 }
@@ -62,11 +62,15 @@ type copyOpts struct {
 }
 
 type saveArtifactOpts struct {
-	KeepTs          bool `long:"keep-ts" description:"Keep created time file timestamps"`
-	KeepOwn         bool `long:"keep-own" description:"Keep owner info"`
-	IfExists        bool `long:"if-exists" description:"Do not fail if the artifact does not exist"`
-	SymlinkNoFollow bool `long:"symlink-no-follow" description:"Do not follow symlinks"`
-	Force           bool `long:"force" description:"Force artifact to be saved, even if it means overwriting files or directories outside of the relative directory"`
+	KeepTs          bool   `long:"keep-ts" description:"Keep created time file timestamps"`
+	KeepOwn         bool   `long:"keep-own" description:"Keep owner info"`
+	IfExists        bool   `long:"if-exists" description:"Do not fail if the artifact does not exist"`
+	SymlinkNoFollow bool   `long:"symlink-no-follow" description:"Do not follow symlinks"`
+	Force           bool   `long:"force" description:"Force artifact to be saved, even if it means overwriting files or directories outside of the relative directory"`
+	Archive         string `long:"archive" description:"Save the artifact locally as a single archive file; one of tar, tar.gz or zip"`
+	MediaType       string `long:"media-type" description:"The media type of the layers of an artifact pushed via AS OCI"`
+	SyncDelete      bool   `long:"sync-delete" description:"Delete the files of the AS LOCAL destination directory which are not part of the artifact"`
+	Checksum        string `long:"checksum" description:"Write a sidecar file with the checksums of the files saved via AS LOCAL; one of sha256 or sha512"`
 }
 
 type saveImageOpts struct {
@@ -75,6 +79,16 @@ type saveImageOpts struct {
 	Insecure       bool     `long:"insecure" description:"Use unencrypted connection for the push"`
 	NoManifestList bool     `long:"no-manifest-list" description:"Do not include a manifest list (specifying the platform) in the creation of the image"`
 	CacheFrom      []string `long:"cache-from" description:"Declare additional cache import as a Docker tag"`
+	OCITar         string   `long:"oci-tar" description:"Write the image to the host as an OCI tarball at the given path, instead of loading it into the container frontend"`
+	SBOM           string   `long:"sbom" optional:"true" optional-value:"spdx" description:"Generate an SBOM for the image, in the given format (spdx or cyclonedx)"`
+	Sign           bool     `long:"sign" description:"Sign the image with the configured signing key once it has been pushed"`
+	TagFromFile    string   `long:"tag-from-file" description:"Tag the image with the tags listed in the given artifact, one per line"`
+	MaxSize        string   `long:"max-size" description:"Fail the build if the uncompressed size of the image exceeds the given size, e.g. 500MB"`
+	MaxLayers      int      `long:"max-layers" description:"Fail the build if the image has more than the given number of layers"`
+	WarnOnly       bool     `long:"warn-only" description:"Only warn, rather than fail the build, if the image exceeds its --max-size or --max-layers"`
+	Squash         bool     `long:"squash" description:"Collapse the layers of the image into a single layer"`
+	SquashFrom     string   `long:"squash-from" description:"Collapse the layers of the image on top of the given base image into a single layer, keeping the layers of the base image"`
+	OCILabels      bool     `long:"oci-labels" description:"Add the standard OCI labels and annotations, derived from the git metadata and the target, to the image"`
 }
 
 type buildOpts struct {
@@ -16,12 +16,17 @@ import (
 	debuggercommon "github.com/earthly/earthly/debugger/common"
 	"github.com/earthly/earthly/domain"
 	"github.com/earthly/earthly/util/flagutil"
+	"github.com/earthly/earthly/util/imagebudget"
+	"github.com/earthly/earthly/util/ociartifact"
 	"github.com/earthly/earthly/util/platutil"
+	"github.com/earthly/earthly/util/saveartifactlocally"
+	"github.com/earthly/earthly/util/sbom"
 	"github.com/earthly/earthly/util/shell"
 	"github.com/earthly/earthly/variables"
 
 	"github.com/docker/go-connections/nat"
 	flags "github.com/jessevdk/go-flags"
+	"github.com/moby/buildkit/client/llb"
 	"github.com/pkg/errors"
 )
 
@@ -185,6 +190,7 @@ func (i *Interpreter) handleStatement(ctx context.Context, stmt spec.Statement)
 func (i *Interpreter) handleCommand(ctx context.Context, cmd spec.Command) (err error) {
 	// The AST should not be modified by any operation. This is a consistency check.
 	argsCopy := getArgsCopy(cmd)
+	mainOutput := i.converter.mainOutput()
 	defer func() {
 		if err != nil {
 			return
@@ -199,6 +205,7 @@ func (i *Interpreter) handleCommand(ctx context.Context, cmd spec.Command) (err
 				return
 			}
 		}
+		i.recordLayerSource(cmd, mainOutput)
 	}()
 
 	analytics.Count("cmd", cmd.Name)
@@ -500,7 +507,7 @@ func (i *Interpreter) handleTry(ctx context.Context, tryStmt spec.TryStatement)
 			if err != nil {
 				return i.wrapError(err, cmd.Command.SourceLocation, "invalid SAVE ARTIFACT arguments %v", cmd.Command.Args)
 			}
-			if opts.KeepTs || opts.KeepOwn || opts.SymlinkNoFollow || opts.Force {
+			if opts.KeepTs || opts.KeepOwn || opts.SymlinkNoFollow || opts.Force || opts.Archive != "" || opts.MediaType != "" || opts.SyncDelete || opts.Checksum != "" {
 				return i.wrapError(err, cmd.Command.SourceLocation, "only the SAVE ARTIFACT --if-exists option is allowed in a TRY/FINALLY block: %v", cmd.Command.Args)
 			}
 			saveFrom, _, saveAsLocalTo, ok := parseSaveArtifactArgs(args)
@@ -548,6 +555,34 @@ func (i *Interpreter) handleTry(ctx context.Context, tryStmt spec.TryStatement)
 
 // Commands -------------------------------------------------------------------
 
+// recordLayerSource records cmd as the source of the layer it added to the main state, if any. The sources
+// are used for the per-layer breakdown of SAVE IMAGE --max-size and --max-layers.
+func (i *Interpreter) recordLayerSource(cmd spec.Command, before llb.Output) {
+	ls := imagebudget.LayerSource{Command: cmd.Name}
+	if len(cmd.Args) > 0 {
+		ls.Command = fmt.Sprintf("%s %s", cmd.Name, strings.Join(cmd.Args, " "))
+	}
+	if len(ls.Command) > 80 {
+		ls.Command = ls.Command[:77] + "..."
+	}
+	if cmd.SourceLocation != nil {
+		ls.SourceLocation = fmt.Sprintf("%s:%d", cmd.SourceLocation.File, cmd.SourceLocation.StartLine)
+	}
+	switch cmd.Name {
+	case "FROM", "FROM DOCKERFILE", "LOCALLY":
+		if len(i.converter.mts.Final.MainLayerSources) == 0 {
+			ls.Base = true
+			i.converter.addLayerSource(ls)
+		}
+	case "DO":
+		// The commands of the function record their own layers.
+	default:
+		if i.converter.mainOutput() != before {
+			i.converter.addLayerSource(ls)
+		}
+	}
+}
+
 func (i *Interpreter) handleFrom(ctx context.Context, cmd spec.Command) error {
 	if i.pushOnlyAllowed {
 		return i.pushOnlyErr(cmd.SourceLocation)
@@ -883,6 +918,26 @@ func (i *Interpreter) handleCopy(ctx context.Context, cmd spec.Command) error {
 		return i.wrapError(err, cmd.SourceLocation, "parse platform %s", expandedPlatform)
 	}
 
+	if len(srcs) == 1 {
+		expandedSrc, err := i.expandArgs(ctx, srcs[0], false, false)
+		if err != nil {
+			return i.wrapError(err, cmd.SourceLocation, "failed to expand COPY src %s", srcs[0])
+		}
+		if strings.HasPrefix(expandedSrc, ociartifact.Scheme) {
+			if i.local {
+				return i.errorf(cmd.SourceLocation, "COPY %s is not implemented under LOCALLY targets", ociartifact.Scheme)
+			}
+			if len(expandedBuildArgs) != 0 || opts.IsDirCopy || opts.IfExists || opts.SymlinkNoFollow {
+				return i.errorf(cmd.SourceLocation, "COPY %s does not support build args, --dir, --if-exists or --symlink-no-follow: %v", ociartifact.Scheme, cmd.Args)
+			}
+			err = i.converter.CopyOCI(ctx, strings.TrimPrefix(expandedSrc, ociartifact.Scheme), dest, opts.KeepTs, opts.KeepOwn, expandedChown, fileModeParsed)
+			if err != nil {
+				return i.wrapError(err, cmd.SourceLocation, "copy oci artifact")
+			}
+			return nil
+		}
+	}
+
 	allClassical := true
 	allArtifacts := true
 	for index, src := range srcs {
@@ -980,6 +1035,14 @@ func (i *Interpreter) handleCopy(ctx context.Context, cmd spec.Command) error {
 	return nil
 }
 
+// parseSaveArtifactOCIArgs splits a trailing AS OCI <ref> off the SAVE ARTIFACT args.
+func parseSaveArtifactOCIArgs(args []string) ([]string, string) {
+	if len(args) >= 4 && strings.Join(args[len(args)-3:len(args)-1], " ") == "AS OCI" {
+		return args[:len(args)-3], args[len(args)-1]
+	}
+	return args, ""
+}
+
 func parseSaveArtifactArgs(args []string) (string, string, string, bool) {
 	saveAsLocalTo := ""
 	saveTo := "./"
@@ -1014,8 +1077,9 @@ func (i *Interpreter) handleSaveArtifact(ctx context.Context, cmd spec.Command)
 	if len(args) > 5 {
 		return i.errorf(cmd.SourceLocation, "too many arguments provided to the SAVE ARTIFACT command: %v", cmd.Args)
 	}
+	args, saveAsOCI := parseSaveArtifactOCIArgs(args)
 	saveFrom, saveTo, saveAsLocalTo, ok := parseSaveArtifactArgs(args)
-	if !ok {
+	if !ok || (saveAsOCI != "" && saveAsLocalTo != "") {
 		return i.errorf(cmd.SourceLocation, "invalid arguments for SAVE ARTIFACT command: %v", cmd.Args)
 	}
 
@@ -1032,10 +1096,50 @@ func (i *Interpreter) handleSaveArtifact(ctx context.Context, cmd spec.Command)
 		return i.errorf(cmd.SourceLocation, "failed to expand SAVE ARTIFACT local dst: %s", saveAsLocalTo)
 	}
 
+	expandedSaveAsOCI, err := i.expandArgs(ctx, saveAsOCI, false, false)
+	if err != nil {
+		return i.errorf(cmd.SourceLocation, "failed to expand SAVE ARTIFACT oci ref: %s", saveAsOCI)
+	}
+	if opts.MediaType != "" && expandedSaveAsOCI == "" {
+		return i.errorf(cmd.SourceLocation, "SAVE ARTIFACT --media-type requires an AS OCI reference")
+	}
+
+	if opts.SyncDelete {
+		if expandedSaveAsLocalTo == "" {
+			return i.errorf(cmd.SourceLocation, "SAVE ARTIFACT --sync-delete requires an AS LOCAL destination")
+		}
+		if opts.Archive != "" {
+			return i.errorf(cmd.SourceLocation, "SAVE ARTIFACT --sync-delete cannot be used with --archive")
+		}
+	}
+
+	if opts.Checksum != "" {
+		if expandedSaveAsLocalTo == "" {
+			return i.errorf(cmd.SourceLocation, "SAVE ARTIFACT --checksum requires an AS LOCAL destination")
+		}
+		err = saveartifactlocally.ValidateChecksumAlgorithm(opts.Checksum)
+		if err != nil {
+			return i.wrapError(err, cmd.SourceLocation, "invalid SAVE ARTIFACT --checksum")
+		}
+	}
+
+	if opts.Archive != "" {
+		if expandedSaveAsLocalTo == "" {
+			return i.errorf(cmd.SourceLocation, "SAVE ARTIFACT --archive requires an AS LOCAL destination")
+		}
+		err = saveartifactlocally.ValidateArchiveFormat(opts.Archive)
+		if err != nil {
+			return i.wrapError(err, cmd.SourceLocation, "invalid SAVE ARTIFACT --archive")
+		}
+	}
+
 	if i.local {
 		if expandedSaveAsLocalTo != "" {
 			return i.errorf(cmd.SourceLocation, "SAVE ARTIFACT AS LOCAL is not implemented under LOCALLY targets")
 		}
+		if expandedSaveAsOCI != "" {
+			return i.errorf(cmd.SourceLocation, "SAVE ARTIFACT AS OCI is not implemented under LOCALLY targets")
+		}
 		err = i.converter.SaveArtifactFromLocal(ctx, saveFrom, expandedSaveTo, opts.KeepTs, opts.IfExists, "")
 		if err != nil {
 			return i.wrapError(err, cmd.SourceLocation, "apply SAVE ARTIFACT")
@@ -1043,7 +1147,13 @@ func (i *Interpreter) handleSaveArtifact(ctx context.Context, cmd spec.Command)
 		return nil
 	}
 
-	err = i.converter.SaveArtifact(ctx, saveFrom, expandedSaveTo, expandedSaveAsLocalTo, opts.KeepTs, opts.KeepOwn, opts.IfExists, opts.SymlinkNoFollow, opts.Force, i.pushOnlyAllowed)
+	err = i.converter.SaveArtifact(ctx, saveFrom, expandedSaveTo, expandedSaveAsLocalTo, opts.KeepTs, opts.KeepOwn, opts.IfExists, opts.SymlinkNoFollow, opts.Force, i.pushOnlyAllowed, SaveArtifactOpt{
+		SaveAsOCI:  expandedSaveAsOCI,
+		Archive:    opts.Archive,
+		SyncDelete: opts.SyncDelete,
+		Checksum:   opts.Checksum,
+		MediaType:  opts.MediaType,
+	})
 	if err != nil {
 		return i.wrapError(err, cmd.SourceLocation, "apply SAVE ARTIFACT")
 	}
@@ -1063,9 +1173,12 @@ func (i *Interpreter) handleSaveImage(ctx context.Context, cmd spec.Command) err
 		}
 		opts.CacheFrom[index] = expandedCacheFrom
 	}
-	if opts.Push && len(args) == 0 {
+	if opts.Push && len(args) == 0 && opts.TagFromFile == "" {
 		return i.errorf(cmd.SourceLocation, "invalid number of arguments for SAVE IMAGE --push: %v", cmd.Args)
 	}
+	if opts.Sign && !opts.Push {
+		return i.errorf(cmd.SourceLocation, "SAVE IMAGE --sign requires --push: %v", cmd.Args)
+	}
 
 	imageNames := args
 	for index, img := range imageNames {
@@ -1073,13 +1186,79 @@ func (i *Interpreter) handleSaveImage(ctx context.Context, cmd spec.Command) err
 		if err != nil {
 			return i.wrapError(err, cmd.SourceLocation, "failed to expand SAVE IMAGE img: %s", img)
 		}
+		if isTagTemplate(expandedImageName) {
+			expandedImageName, err = i.converter.expandTagTemplate(expandedImageName)
+			if err != nil {
+				return i.wrapError(err, cmd.SourceLocation, "failed to expand SAVE IMAGE img template: %s", img)
+			}
+		}
 		imageNames[index] = expandedImageName
 	}
+	if opts.TagFromFile != "" {
+		tagFile, err := i.expandArgs(ctx, opts.TagFromFile, true, false)
+		if err != nil {
+			return i.wrapError(err, cmd.SourceLocation, "failed to expand SAVE IMAGE tag-from-file: %s", opts.TagFromFile)
+		}
+		tags, err := i.converter.ReadTagsFromArtifact(ctx, tagFile)
+		if err != nil {
+			return i.wrapError(err, cmd.SourceLocation, "read SAVE IMAGE tags from %s", tagFile)
+		}
+		imageNames = applyTags(imageNames, tags)
+	}
+	if opts.OCITar != "" {
+		if len(imageNames) != 1 {
+			return i.errorf(cmd.SourceLocation, "SAVE IMAGE --oci-tar requires exactly one image name: %v", cmd.Args)
+		}
+		opts.OCITar, err = i.expandArgs(ctx, opts.OCITar, false, false)
+		if err != nil {
+			return i.wrapError(err, cmd.SourceLocation, "failed to expand SAVE IMAGE oci-tar: %s", opts.OCITar)
+		}
+	}
+	if opts.SBOM != "" {
+		err = sbom.ValidateFormat(opts.SBOM)
+		if err != nil {
+			return i.wrapError(err, cmd.SourceLocation, "invalid SAVE IMAGE --sbom")
+		}
+	}
+	var budget imagebudget.Budget
+	if opts.MaxSize != "" {
+		maxSize, err := i.expandArgs(ctx, opts.MaxSize, false, false)
+		if err != nil {
+			return i.wrapError(err, cmd.SourceLocation, "failed to expand SAVE IMAGE max-size: %s", opts.MaxSize)
+		}
+		budget.MaxSize, err = imagebudget.ParseSize(maxSize)
+		if err != nil {
+			return i.wrapError(err, cmd.SourceLocation, "invalid SAVE IMAGE --max-size")
+		}
+	}
+	if opts.MaxLayers < 0 {
+		return i.errorf(cmd.SourceLocation, "SAVE IMAGE --max-layers must not be negative: %v", cmd.Args)
+	}
+	budget.MaxLayers = opts.MaxLayers
+	budget.WarnOnly = opts.WarnOnly
+	if budget.WarnOnly && !budget.Enabled() {
+		return i.errorf(cmd.SourceLocation, "SAVE IMAGE --warn-only requires --max-size or --max-layers: %v", cmd.Args)
+	}
+	if opts.SquashFrom != "" {
+		opts.SquashFrom, err = i.expandArgs(ctx, opts.SquashFrom, false, false)
+		if err != nil {
+			return i.wrapError(err, cmd.SourceLocation, "failed to expand SAVE IMAGE squash-from: %s", opts.SquashFrom)
+		}
+		opts.Squash = true
+	}
 	if len(imageNames) == 0 && !opts.CacheHint && len(opts.CacheFrom) == 0 {
 		fmt.Fprintf(os.Stderr, "Deprecation: using SAVE IMAGE with no arguments is no longer necessary and can be safely removed\n")
 		return nil
 	}
-	err = i.converter.SaveImage(ctx, imageNames, opts.Push, opts.Insecure, opts.CacheHint, opts.CacheFrom, opts.NoManifestList)
+	err = i.converter.SaveImage(ctx, imageNames, opts.Push, opts.Insecure, opts.CacheHint, opts.CacheFrom, opts.NoManifestList, SaveImageOpt{
+		OCITar:     opts.OCITar,
+		SBOMFormat: opts.SBOM,
+		Sign:       opts.Sign,
+		Budget:     budget,
+		Squash:     opts.Squash,
+		SquashFrom: opts.SquashFrom,
+		OCILabels:  opts.OCILabels,
+	})
 	if err != nil {
 		return i.wrapError(err, cmd.SourceLocation, "save image")
 	}
@@ -10,6 +10,7 @@ import (
 	"github.com/earthly/earthly/util/inodeutil"
 	"github.com/earthly/earthly/util/llbutil/llbfactory"
 	"github.com/earthly/earthly/util/llbutil/pllb"
+	"github.com/earthly/earthly/util/watchutil"
 )
 
 // LocalStateCache provides caching of local States
@@ -92,3 +93,17 @@ func addIncludePathAndSharedKeyHint(factory llbfactory.Factory, src []string) ll
 		WithInclude(includePatterns).
 		WithSharedKeyHint(sharedKey)
 }
+
+// watchLocalFactory records the local files which are used via the factory, such that they can be watched
+// for changes. A nil src means that the entire local dir is used.
+func watchLocalFactory(ws *watchutil.Set, factory llbfactory.Factory, src []string) {
+	localFactory, ok := factory.(*llbfactory.LocalFactory)
+	if !ok {
+		return
+	}
+	if src == nil {
+		ws.AddDir(localFactory.GetName(), localFactory.GetExcludePatterns())
+		return
+	}
+	ws.AddIncludes(localFactory.GetName(), createIncludePatterns(src), localFactory.GetExcludePatterns())
+}
@@ -0,0 +1,65 @@
+package earthfile2llb
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/earthly/earthly/states/image"
+)
+
+// The standard OCI annotation keys, see https://github.com/opencontainers/image-spec/blob/main/annotations.md.
+const (
+	ociLabelCreated  = "org.opencontainers.image.created"
+	ociLabelSource   = "org.opencontainers.image.source"
+	ociLabelRevision = "org.opencontainers.image.revision"
+	ociLabelVersion  = "org.opencontainers.image.version"
+	ociLabelBranch   = "dev.earthly.git.branch"
+	ociLabelTarget   = "dev.earthly.target"
+)
+
+// ociLabels returns the standard OCI labels describing the image, derived from the git metadata and the
+// target.
+func (c *Converter) ociLabels() map[string]string {
+	labels := map[string]string{
+		ociLabelTarget: c.target.StringCanonical(),
+	}
+	created := c.sourceDateEpoch
+	if c.gitMeta != nil {
+		if c.gitMeta.GitURL != "" {
+			labels[ociLabelSource] = "https://" + c.gitMeta.GitURL
+		}
+		if c.gitMeta.Hash != "" {
+			labels[ociLabelRevision] = c.gitMeta.Hash
+		}
+		if len(c.gitMeta.Tags) > 0 {
+			labels[ociLabelVersion] = c.gitMeta.Tags[0]
+		}
+		if len(c.gitMeta.Branch) > 0 {
+			labels[ociLabelBranch] = c.gitMeta.Branch[0]
+		}
+		if sec, err := strconv.ParseInt(c.gitMeta.Timestamp, 10, 64); err == nil && created == nil {
+			t := time.Unix(sec, 0).UTC()
+			created = &t
+		}
+	}
+	if created != nil {
+		labels[ociLabelCreated] = created.UTC().Format(time.RFC3339)
+	}
+	return labels
+}
+
+// applyOCILabels adds the standard OCI labels to the image config, and returns them to be used as the
+// annotations of the image. Labels which have already been set via LABEL take precedence, such that each
+// project can override them.
+func (c *Converter) applyOCILabels(img *image.Image) map[string]string {
+	annotations := make(map[string]string)
+	for k, v := range c.ociLabels() {
+		if existing, ok := img.Config.Labels[k]; ok {
+			v = existing
+		} else {
+			img.Config.Labels[k] = v
+		}
+		annotations[k] = v
+	}
+	return annotations
+}
@@ -0,0 +1,41 @@
+package earthfile2llb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/earthly/earthly/domain"
+	"github.com/earthly/earthly/states/image"
+	"github.com/earthly/earthly/util/gitutil"
+)
+
+func TestApplyOCILabels(t *testing.T) {
+	c := &Converter{
+		target: domain.Target{GitURL: "github.com/earthly/earthly", Target: "docker"},
+		gitMeta: &gitutil.GitMetadata{
+			GitURL:    "github.com/earthly/earthly",
+			Hash:      "41cb56668d1a5c9fd29fd2ac6f0b96b2c1ee7c48",
+			Branch:    []string{"main"},
+			Tags:      []string{"v1.2.3"},
+			Timestamp: "1626881847",
+		},
+	}
+	img := image.NewImage()
+	img.Config.Labels[ociLabelSource] = "https://example.com/fork"
+
+	annotations := c.applyOCILabels(img)
+	want := map[string]string{
+		ociLabelCreated:  "2021-07-21T15:37:27Z",
+		ociLabelSource:   "https://example.com/fork",
+		ociLabelRevision: "41cb56668d1a5c9fd29fd2ac6f0b96b2c1ee7c48",
+		ociLabelVersion:  "v1.2.3",
+		ociLabelBranch:   "main",
+		ociLabelTarget:   "github.com/earthly/earthly+docker",
+	}
+	if !reflect.DeepEqual(annotations, want) {
+		t.Errorf("expected annotations %v, got %v", want, annotations)
+	}
+	if !reflect.DeepEqual(img.Config.Labels, want) {
+		t.Errorf("expected labels %v, got %v", want, img.Config.Labels)
+	}
+}
@@ -145,6 +145,7 @@ func (c *Converter) parseMount(mount string) ([]llb.RunOption, error) {
 			return nil, err
 		}
 		cachePath := path.Join("/run/cache", key, mountID)
+		c.opt.CacheMountRecorder.Record(cachePath, c.target.StringCanonical(), mountTarget)
 		mountOpts = append(mountOpts, llb.AsPersistentCacheDir(cachePath, sharingMode))
 		state = c.cacheContext
 		return []llb.RunOption{pllb.AddMount(mountTarget, state, mountOpts...)}, nil
@@ -0,0 +1,151 @@
+package earthfile2llb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/earthly/earthly/domain"
+	"github.com/earthly/earthly/util/llbutil"
+	"github.com/earthly/earthly/variables"
+
+	"github.com/pkg/errors"
+)
+
+// tagTemplateData is the data which templated SAVE IMAGE tags, such as myimg:{{.Git.ShortHash}}, are
+// resolved against.
+type tagTemplateData struct {
+	Git struct {
+		Hash      string
+		ShortHash string
+		Branch    string
+		Tag       string
+		Timestamp time.Time
+	}
+	Target struct {
+		Name    string
+		Tag     string
+		Project string
+	}
+	Platform string
+	Args     map[string]string
+}
+
+var tagTemplateFuncs = template.FuncMap{
+	"docker_safe": llbutil.DockerTagSafe,
+	"lower":       strings.ToLower,
+	"upper":       strings.ToUpper,
+	"trunc": func(n int, s string) string {
+		if len(s) > n {
+			return s[:n]
+		}
+		return s
+	},
+}
+
+// isTagTemplate returns whether the image name contains template expressions.
+func isTagTemplate(imageName string) bool {
+	return strings.Contains(imageName, "{{")
+}
+
+// expandTagTemplate resolves the template expressions of the image name, using the git metadata, the target,
+// the platform and the args of the current target.
+func (c *Converter) expandTagTemplate(imageName string) (string, error) {
+	var data tagTemplateData
+	if c.gitMeta != nil {
+		data.Git.Hash = c.gitMeta.Hash
+		data.Git.ShortHash = c.gitMeta.ShortHash
+		if len(c.gitMeta.Branch) > 0 {
+			data.Git.Branch = c.gitMeta.Branch[0]
+		}
+		if len(c.gitMeta.Tags) > 0 {
+			data.Git.Tag = c.gitMeta.Tags[0]
+		}
+		if sec, err := strconv.ParseInt(c.gitMeta.Timestamp, 10, 64); err == nil {
+			data.Git.Timestamp = time.Unix(sec, 0).UTC()
+		}
+	}
+	data.Target.Name = c.target.Target
+	data.Target.Tag = c.target.Tag
+	data.Target.Project = c.target.ProjectCanonical()
+	data.Platform = c.platr.Materialize(c.platr.Current()).String()
+
+	// The builtin args are available even if they have not been declared via ARG.
+	data.Args = variables.BuiltinArgs(c.target, c.platr, c.gitMeta, c.opt.BuiltinArgs, c.ftrs, c.opt.DoPushes).AllValueMap()
+	for _, name := range c.varCollection.SortedActiveVariables() {
+		v, _ := c.varCollection.GetActive(name)
+		data.Args[name] = v
+	}
+
+	now := time.Now().UTC()
+	if c.sourceDateEpoch != nil {
+		now = *c.sourceDateEpoch
+	}
+	funcs := template.FuncMap{
+		"date": func(layout string) string {
+			return now.Format(layout)
+		},
+	}
+	tmpl, err := template.New("tag").Option("missingkey=error").Funcs(tagTemplateFuncs).Funcs(funcs).Parse(imageName)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse image name template %s", imageName)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", errors.Wrapf(err, "execute image name template %s", imageName)
+	}
+	return buf.String(), nil
+}
+
+// ReadTagsFromArtifact reads the image tags listed in the given artifact, one per line.
+func (c *Converter) ReadTagsFromArtifact(ctx context.Context, artifactName string) ([]string, error) {
+	artifact, err := domain.ParseArtifact(artifactName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse artifact %s", artifactName)
+	}
+	mts, err := c.buildTarget(ctx, artifact.Target.String(), c.platr.Current(), false, nil, false, saveImageCmd)
+	if err != nil {
+		return nil, err
+	}
+	dt, err := c.readArtifact(ctx, mts, artifact)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	scanner := bufio.NewScanner(bytes.NewReader(dt))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tags = append(tags, line)
+	}
+	if len(tags) == 0 {
+		return nil, errors.Errorf("no tags found in %s", artifactName)
+	}
+	return tags, nil
+}
+
+// applyTags returns the image names obtained by tagging each of the given image names with each of the tags.
+// If no image names are given, the tags are expected to be full image names themselves.
+func applyTags(imageNames []string, tags []string) []string {
+	if len(imageNames) == 0 {
+		return tags
+	}
+	var ret []string
+	for _, imageName := range imageNames {
+		repo := imageName
+		if i := strings.LastIndex(imageName, ":"); i != -1 && !strings.Contains(imageName[i:], "/") {
+			repo = imageName[:i]
+		}
+		for _, tag := range tags {
+			ret = append(ret, repo+":"+tag)
+		}
+	}
+	return ret
+}
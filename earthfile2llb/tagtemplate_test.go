@@ -0,0 +1,67 @@
+package earthfile2llb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/earthly/earthly/domain"
+	"github.com/earthly/earthly/features"
+	"github.com/earthly/earthly/util/gitutil"
+	"github.com/earthly/earthly/util/platutil"
+	"github.com/earthly/earthly/variables"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestExpandTagTemplate(t *testing.T) {
+	target := domain.Target{LocalPath: "./app", Target: "docker"}
+	gitMeta := &gitutil.GitMetadata{ShortHash: "41cb5666", Branch: []string{"john/work"}, Timestamp: "1626881847"}
+	platr := platutil.NewResolver(specs.Platform{OS: "linux", Architecture: "amd64"})
+	ftrs := &features.Features{}
+	c := &Converter{
+		target:  target,
+		gitMeta: gitMeta,
+		platr:   platr,
+		ftrs:    ftrs,
+		varCollection: variables.NewCollection(variables.NewCollectionOpt{
+			Target:           target,
+			PlatformResolver: platr,
+			GitMeta:          gitMeta,
+			OverridingVars:   variables.NewScope(),
+			Features:         ftrs,
+		}),
+	}
+	c.varCollection.SetArg("VERSION", "1.2")
+
+	tests := []struct {
+		tmpl    string
+		want    string
+		wantErr bool
+	}{
+		{tmpl: `myimg:{{.Git.Branch | docker_safe}}-{{.Git.ShortHash}}`, want: "myimg:john_work-41cb5666"},
+		{tmpl: `myimg:{{.Args.VERSION}}-{{.Git.Timestamp.Format "20060102"}}`, want: "myimg:1.2-20210721"},
+		{tmpl: `myimg:{{.Target.Name}}-{{.Args.EARTHLY_GIT_SHORT_HASH}}`, want: "myimg:docker-41cb5666"},
+		{tmpl: `myimg:{{.Args.UNDEFINED}}`, wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := c.expandTagTemplate(test.tmpl)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error, got nil", test.tmpl)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", test.tmpl, err)
+		} else if got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.tmpl, test.want, got)
+		}
+	}
+}
+
+func TestApplyTags(t *testing.T) {
+	got := applyTags([]string{"a:latest", "localhost:5000/b"}, []string{"1", "2"})
+	want := []string{"a:1", "a:2", "localhost:5000/b:1", "localhost:5000/b:2"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,98 @@
+package earthfile2llb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var _ error = &TargetError{}
+var _ error = &FailedTargetsError{}
+
+// TargetError is an error which occurred while building a specific target.
+type TargetError struct {
+	Target string
+	cause  error
+}
+
+func newTargetError(target string, cause error) *TargetError {
+	return &TargetError{
+		Target: target,
+		cause:  cause,
+	}
+}
+
+func (te *TargetError) Error() string {
+	return fmt.Sprintf("%s: %s", te.Target, te.cause.Error())
+}
+
+// Unwrap returns the cause of the error.
+func (te *TargetError) Unwrap() error {
+	return te.cause
+}
+
+// FailedTargetsError is returned in keep-going mode, when more than one independent
+// target has failed.
+type FailedTargetsError struct {
+	Errs []error
+}
+
+// newFailedTargetsError combines the given errors (ignoring nil ones). It returns nil if there are
+// no errors, and the error itself if there is just one.
+func newFailedTargetsError(errs ...error) error {
+	var flat []error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		var fte *FailedTargetsError
+		if errors.As(err, &fte) {
+			flat = append(flat, fte.Errs...)
+			continue
+		}
+		flat = append(flat, err)
+	}
+	// Cancellations are a side effect of other failures (or of the user interrupting the build);
+	// only report them if there is nothing else to report.
+	var filtered []error
+	for _, err := range flat {
+		if !errors.Is(err, context.Canceled) {
+			filtered = append(filtered, err)
+		}
+	}
+	if len(filtered) == 0 && len(flat) > 0 {
+		filtered = flat[:1]
+	}
+	switch len(filtered) {
+	case 0:
+		return nil
+	case 1:
+		return filtered[0]
+	default:
+		return &FailedTargetsError{Errs: filtered}
+	}
+}
+
+func (fte *FailedTargetsError) Error() string {
+	msgs := make([]string, 0, len(fte.Errs))
+	for _, err := range fte.Errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d targets failed:\n%s", len(fte.Errs), strings.Join(msgs, "\n"))
+}
+
+// Unwrap returns the first of the errors.
+func (fte *FailedTargetsError) Unwrap() error {
+	return fte.Errs[0]
+}
+
+// GetFailedTargetsError finds the first FailedTargetsError in the wrap chain and returns it.
+func GetFailedTargetsError(err error) (*FailedTargetsError, bool) {
+	var fte *FailedTargetsError
+	if errors.As(err, &fte) {
+		return fte, true
+	}
+	return nil, false
+}
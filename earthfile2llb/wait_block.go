@@ -6,15 +6,19 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/earthly/earthly/conslogging"
 	"github.com/earthly/earthly/domain"
 	"github.com/earthly/earthly/states"
 	"github.com/earthly/earthly/util/dockerutil"
 	"github.com/earthly/earthly/util/gatewaycrafter"
+	"github.com/earthly/earthly/util/imagebudget"
 	"github.com/earthly/earthly/util/llbutil"
 	"github.com/earthly/earthly/util/llbutil/pllb"
+	"github.com/earthly/earthly/util/ociartifact"
 	"github.com/earthly/earthly/util/saveartifactlocally"
+	"github.com/earthly/earthly/util/sbom"
 	"github.com/earthly/earthly/util/syncutil/semutil"
 	"github.com/earthly/earthly/util/syncutil/serrgroup"
 
@@ -46,10 +50,29 @@ type waitItem interface {
 type waitBlock struct {
 	items []waitItem
 	mu    sync.Mutex
+
+	// keepGoing, when true, causes a failure of one item to not cancel the others.
+	keepGoing bool
+}
+
+func newWaitBlock(keepGoing bool) *waitBlock {
+	return &waitBlock{
+		keepGoing: keepGoing,
+	}
 }
 
-func newWaitBlock() *waitBlock {
-	return &waitBlock{}
+func (wb *waitBlock) newErrGroup(ctx context.Context) (*serrgroup.Group, context.Context) {
+	if wb.keepGoing {
+		return serrgroup.WithContextKeepGoing(ctx)
+	}
+	return serrgroup.WithContext(ctx)
+}
+
+func (wb *waitBlock) groupErr(errGroup *serrgroup.Group, err error) error {
+	if wb.keepGoing {
+		return newFailedTargetsError(errGroup.Errs()...)
+	}
+	return err
 }
 
 func (wb *waitBlock) addSaveImage(si states.SaveImage, c *Converter, push, localExport bool) {
@@ -91,7 +114,7 @@ func (wb *waitBlock) wait(ctx context.Context) error {
 	wb.mu.Lock()
 	defer wb.mu.Unlock()
 
-	errGroup, ctx := serrgroup.WithContext(ctx)
+	errGroup, ctx := wb.newErrGroup(ctx)
 	errGroup.Go(func() error {
 		return wb.saveImages(ctx)
 	})
@@ -101,7 +124,7 @@ func (wb *waitBlock) wait(ctx context.Context) error {
 	errGroup.Go(func() error {
 		return wb.waitStates(ctx)
 	})
-	return errGroup.Wait()
+	return wb.groupErr(errGroup, errGroup.Wait())
 }
 
 func (wb *waitBlock) saveImages(ctx context.Context) error {
@@ -195,15 +218,96 @@ func (wb *waitBlock) saveImages(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
+		gwCrafter.AddImageAnnotations(refPrefix, item.si.Annotations)
 		refID++
 
-		if item.localExport {
+		if item.si.SBOM != "" && item.si.DockerTag != "" {
+			var sbomPlatform string
+			if isMultiPlatform[item.si.DockerTag] {
+				sbomPlatform = item.si.Platform.String()
+			}
+			var localPath, workDir string
+			if item.localExport {
+				localPath = sbom.LocalPath(item.c.target.LocalPath, item.si.OCITar, item.si.DockerTag, sbomPlatform, item.si.SBOM)
+			}
+			created := time.Now()
+			if item.si.Image != nil {
+				workDir = item.si.Image.Config.WorkingDir
+				if item.si.Image.Created != nil {
+					// Reproducible mode: use the source date epoch, as for the image itself.
+					created = *item.si.Image.Created
+				}
+			}
+			err = item.c.opt.SBOMCollector.AddImage(ctx, sbom.GenerateOpt{
+				GwClient:         item.c.opt.GwClient,
+				Ref:              ref,
+				State:            item.si.State,
+				PlatformResolver: item.c.platr,
+				Name:             item.si.DockerTag,
+				Format:           item.si.SBOM,
+				WorkDir:          workDir,
+				Created:          created,
+			}, sbom.Entry{
+				Target:    item.c.target.StringCanonical(),
+				Salt:      item.c.mts.Final.ID,
+				DockerTag: item.si.DockerTag,
+				Platform:  sbomPlatform,
+				LocalPath: localPath,
+				Push:      item.push,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "generate sbom of %s", item.si.DockerTag)
+			}
+		}
+
+		var budget imagebudget.Budget
+		if item.si.DockerTag != "" && (item.localExport || item.push) {
+			budget = item.si.Budget
+			budget.DockerTag = item.si.DockerTag
+			if isMultiPlatform[item.si.DockerTag] {
+				budget.Platform = item.si.Platform.String()
+			}
+		}
+		if budget.Enabled() && !item.localExport {
+			// Images which are output locally are measured on their existing export. Images which are only
+			// pushed are never available locally, so a tarball of them (of the manifest list, for multi-platform
+			// images) is exported in addition to the push, just for the budget check.
+			gwCrafter.AddMeta(fmt.Sprintf("%s/export-image", refPrefix), []byte("true"))
+			exportCoordinator.AddImageBudget(item.si.DockerTag, budget, true)
+		}
+
+		ociOutput := item.si.OCITar != "" || item.c.opt.ImageOutputDir != ""
+		if item.localExport && ociOutput {
+			imageName := item.si.DockerTag
+			if isMultiPlatform[item.si.DockerTag] {
+				// The platforms are combined into a manifest list once they have all been exported.
+				refPrefix, err = gwCrafter.AddPushImageEntry(ref, refID, platformImgName, false, false, item.si.Image, nil)
+				if err != nil {
+					return err
+				}
+				gwCrafter.AddImageAnnotations(refPrefix, item.si.Annotations)
+				refID++
+				imageName = platformImgName
+			}
+			exportCoordinator.AddOCIOutput(imageName, gatewaycrafter.OCIOutputEntry{
+				DockerTag:     item.si.DockerTag,
+				MultiPlatform: isMultiPlatform[item.si.DockerTag],
+				TarPath:       item.si.OCITar,
+				Dir:           item.c.opt.ImageOutputDir,
+			})
+			gwCrafter.AddMeta(fmt.Sprintf("%s/export-image", refPrefix), []byte("true"))
+			if budget.Enabled() {
+				exportCoordinator.AddImageBudget(imageName, budget, false)
+			}
+			exportCoordinator.AddLocalOutputSummary(item.c.target.String(), item.si.DockerTag, item.c.mts.Final.ID)
+		} else if item.localExport {
 			if isMultiPlatform[item.si.DockerTag] {
 				// local docker instance does not support multi-platform images, so we must create a new entry and set it to the platformImgName
 				refPrefix, err := gwCrafter.AddPushImageEntry(ref, refID, platformImgName, false, false, item.si.Image, nil)
 				if err != nil {
 					return err
 				}
+				gwCrafter.AddImageAnnotations(refPrefix, item.si.Annotations)
 
 				exportCoordinatorImageID := exportCoordinator.AddImage(sessionID, item.si.DockerTag, &dockerutil.Manifest{
 					ImageName: platformImgName,
@@ -218,6 +322,9 @@ func (wb *waitBlock) saveImages(ctx context.Context) error {
 					tarImagesInWaitBlockRefPrefixes = append(tarImagesInWaitBlockRefPrefixes, refPrefix)
 					tarImagesInWaitBlock = append(tarImagesInWaitBlock, exportCoordinatorImageID)
 				}
+				if budget.Enabled() {
+					exportCoordinator.AddImageBudget(platformImgName, budget, false)
+				}
 				refID++
 			} else {
 				if item.c.opt.UseLocalRegistry {
@@ -226,6 +333,9 @@ func (wb *waitBlock) saveImages(ctx context.Context) error {
 				} else {
 					gwCrafter.AddMeta(fmt.Sprintf("%s/export-image", refPrefix), []byte("true"))
 				}
+				if budget.Enabled() {
+					exportCoordinator.AddImageBudget(item.si.DockerTag, budget, false)
+				}
 			}
 			exportCoordinator.AddLocalOutputSummary(item.c.target.String(), item.si.DockerTag, item.c.mts.Final.ID)
 		}
@@ -251,6 +361,37 @@ func (wb *waitBlock) saveImages(ctx context.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to SAVE IMAGE")
 	}
+	return signImages(ctx, imageWaitItems)
+}
+
+// signImages signs the images of SAVE IMAGE --sign commands, once they have been pushed.
+func signImages(ctx context.Context, items []*saveImageWaitItem) error {
+	signed := make(map[string]bool) // the platforms of multi-platform images share a single signature
+	for _, item := range items {
+		if !item.push || !item.si.Sign || signed[item.si.DockerTag] {
+			continue
+		}
+		signed[item.si.DockerTag] = true
+		if item.c.opt.SigningKeyErr != nil {
+			return errors.Wrapf(item.c.opt.SigningKeyErr, "cannot sign image %s", item.si.DockerTag)
+		}
+		if item.c.opt.SigningKey == nil {
+			return errors.Errorf("cannot sign image %s: no signing key is configured (set global.signing_key or EARTHLY_SIGNING_KEY)", item.si.DockerTag)
+		}
+		reg := item.c.opt.Registry
+		if item.si.InsecurePush {
+			var err error
+			reg, err = reg.WithPlainHTTP(item.si.DockerTag)
+			if err != nil {
+				return err
+			}
+		}
+		dgst, err := ociartifact.Sign(ctx, item.si.DockerTag, item.c.opt.SigningKey, reg)
+		if err != nil {
+			return errors.Wrapf(err, "failed to sign image %s", item.si.DockerTag)
+		}
+		item.c.opt.Console.Printf("Signed image %s (%s)\n", item.si.DockerTag, dgst)
+	}
 	return nil
 }
 
@@ -277,7 +418,7 @@ func (wb *waitBlock) waitStates(ctx context.Context) error {
 	// even if parallelism is completely starved.
 	sem := semutil.NewMultiSem(sharedParallelism, semutil.NewWeighted(1))
 
-	errGroup, ctx := serrgroup.WithContext(ctx)
+	errGroup, ctx := wb.newErrGroup(ctx)
 	for _, item := range stateItems {
 		item := item // must create a new instance here for use in the threaded function
 		errGroup.Go(func() error {
@@ -286,10 +427,17 @@ func (wb *waitBlock) waitStates(ctx context.Context) error {
 				return errors.Wrapf(err, "acquiring parallelism semaphore during waitStates for %s", item.c.target.String())
 			}
 			defer rel()
-			return item.c.forceExecution(ctx, *item.state, item.c.platr)
+			err = item.c.forceExecution(ctx, *item.state, item.c.platr)
+			if err != nil {
+				item.c.opt.InvocationRecorder.Finish(item.c.opt.invocation, err)
+			}
+			if err != nil && wb.keepGoing {
+				return newTargetError(item.c.target.String(), err)
+			}
+			return err
 		})
 	}
-	return errGroup.Wait()
+	return wb.groupErr(errGroup, errGroup.Wait())
 }
 
 type saveArtifactLocalEntry struct {
@@ -297,7 +445,10 @@ type saveArtifactLocalEntry struct {
 	artifactDir string
 	destPath    string
 	ifExists    bool
+	ociRef      string
+	mediaType   string
 	salt        string
+	opt         saveartifactlocally.SaveOpt
 }
 
 func (wb *waitBlock) saveArtifactLocal(ctx context.Context) error {
@@ -306,6 +457,8 @@ func (wb *waitBlock) saveArtifactLocal(ctx context.Context) error {
 	var gatewayClient gwclient.Client
 	var console conslogging.ConsoleLogger
 	var exportCoordinator *gatewaycrafter.ExportCoordinator
+	var registry ociartifact.Registry
+	var outputLock *saveartifactlocally.ProcessOutputLock
 	artifacts := []saveArtifactLocalEntry{}
 
 	for refID, item := range wb.items {
@@ -336,7 +489,11 @@ func (wb *waitBlock) saveArtifactLocal(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
-		c.opt.LocalArtifactWhiteList.Add(saveLocalItem.saveLocal.DestPath)
+		if saveLocalItem.saveLocal.OCIRef == "" {
+			c.opt.LocalArtifactWhiteList.Add(saveLocalItem.saveLocal.DestPath)
+		}
+		registry = c.opt.Registry
+		outputLock = c.opt.OutputLock
 
 		outDir, err := c.opt.TempEarthlyOutDir()
 		if err != nil {
@@ -347,7 +504,15 @@ func (wb *waitBlock) saveArtifactLocal(ctx context.Context) error {
 			artifactDir: filepath.Join(outDir, fmt.Sprintf("index-%s", dirID)),
 			destPath:    saveLocalItem.saveLocal.DestPath,
 			ifExists:    saveLocalItem.saveLocal.IfExists,
+			ociRef:      saveLocalItem.saveLocal.OCIRef,
+			mediaType:   saveLocalItem.saveLocal.MediaType,
 			salt:        c.mts.Final.ID,
+			opt: saveartifactlocally.SaveOpt{
+				Archive:    saveLocalItem.saveLocal.Archive,
+				KeepTs:     saveLocalItem.saveLocal.KeepTs,
+				SyncDelete: saveLocalItem.saveLocal.SyncDelete,
+				Checksum:   saveLocalItem.saveLocal.Checksum,
+			},
 		})
 
 	}
@@ -368,9 +533,22 @@ func (wb *waitBlock) saveArtifactLocal(ctx context.Context) error {
 		return err
 	}
 
+	// Prevent concurrent earthly invocations from interleaving their writes to the local outputs.
+	err = outputLock.Lock(ctx, console)
+	if err != nil {
+		return err
+	}
+
 	for _, entry := range artifacts {
+		if entry.ociRef != "" {
+			err = ociartifact.PushArtifact(ctx, console, entry.artifact, entry.artifactDir, entry.ociRef, entry.mediaType, entry.ifExists, registry)
+			if err != nil {
+				return err
+			}
+			continue
+		}
 		err = saveartifactlocally.SaveArtifactLocally(
-			ctx, exportCoordinator, console, entry.artifact, entry.artifactDir, entry.destPath, entry.salt, entry.ifExists)
+			ctx, exportCoordinator, console, entry.artifact, entry.artifactDir, entry.destPath, entry.salt, entry.ifExists, entry.opt)
 		if err != nil {
 			return err
 		}
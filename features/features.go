@@ -42,6 +42,7 @@ type Features struct {
 	WaitBlock                  bool `long:"wait-block" description:"enable WITH/END feature, also allows RUN --push mixed with non-push commands"`
 	UseProjectSecrets          bool `long:"use-project-secrets" description:"enable project-based secret resolution"`
 	UsePipelines               bool `long:"use-pipelines" description:"enable the PIPELINE and TRIGGER commands"`
+	MergeLocalArtifacts        bool `long:"merge-local-artifacts" description:"merge directory artifacts saved AS LOCAL into the existing destination, instead of replacing it"`
 
 	Major int
 	Minor int
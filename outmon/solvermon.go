@@ -10,8 +10,13 @@ import (
 
 	"github.com/dustin/go-humanize"
 	"github.com/earthly/earthly/conslogging"
+	"github.com/earthly/earthly/tracing"
+	"github.com/earthly/earthly/util/explaincache"
 	"github.com/moby/buildkit/client"
 	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -41,6 +46,8 @@ type SolverMonitor struct {
 	noOutputTicker              *time.Ticker
 	noOutputTick                time.Duration
 	errVertex                   *vertexMonitor
+	explainCache                *explaincache.Recorder
+	targetFailures              TargetFailureRecorder
 
 	mu      sync.Mutex
 	ongoing bool
@@ -52,8 +59,15 @@ type timingKey struct {
 	salt           string
 }
 
-// NewSolverMonitor retuns a new solver monitor.
-func NewSolverMonitor(console conslogging.ConsoleLogger, verbose bool, disableNoOutputUpdates bool) *SolverMonitor {
+// TargetFailureRecorder records the targets whose vertices fail during a solve.
+type TargetFailureRecorder interface {
+	// FailTarget records the failure of a vertex of the target with the given ID (see VertexMeta.TargetID).
+	FailTarget(targetID string, err error)
+}
+
+// NewSolverMonitor retuns a new solver monitor. The vertices of the solves are recorded into explainCache,
+// and their failures into targetFailures, if not nil.
+func NewSolverMonitor(console conslogging.ConsoleLogger, verbose bool, disableNoOutputUpdates bool, explainCache *explaincache.Recorder, targetFailures TargetFailureRecorder) *SolverMonitor {
 	noOutputTick := durationBetweenNoOutputUpdatesNoAnsi
 	if ansiSupported {
 		noOutputTick = durationBetweenNoOutputUpdates
@@ -68,6 +82,8 @@ func NewSolverMonitor(console conslogging.ConsoleLogger, verbose bool, disableNo
 		startTime:              time.Now(),
 		noOutputTicker:         time.NewTicker(noOutputTick),
 		noOutputTick:           noOutputTick,
+		explainCache:           explainCache,
+		targetFailures:         targetFailures,
 	}
 }
 
@@ -85,7 +101,7 @@ Loop:
 			if !ok {
 				break Loop
 			}
-			err := sm.processStatus(ss)
+			err := sm.processStatus(ctx, ss)
 			if err != nil {
 				return "", err
 			}
@@ -115,7 +131,7 @@ Loop:
 	return failedVertexOutput, nil
 }
 
-func (sm *SolverMonitor) processStatus(ss *client.SolveStatus) error {
+func (sm *SolverMonitor) processStatus(ctx context.Context, ss *client.SolveStatus) error {
 	sm.msgMu.Lock()
 	defer sm.msgMu.Unlock()
 	for _, vertex := range ss.Vertexes {
@@ -136,6 +152,16 @@ func (sm *SolverMonitor) processStatus(ss *client.SolveStatus) error {
 			sm.vertices[vertex.Digest] = vm
 		}
 		vm.vertex = vertex
+		sm.explainCache.RecordVertex(explaincache.Vertex{
+			Digest:    vertex.Digest,
+			Inputs:    vertex.Inputs,
+			Target:    vm.meta.TargetName,
+			Platform:  vm.meta.Platform,
+			Operation: vm.operation,
+			Internal:  vm.meta.Internal,
+			Cached:    vertex.Cached,
+			Ran:       !vertex.Cached && vertex.Started != nil,
+		})
 		if !vm.headerPrinted &&
 			((!vm.meta.Internal && (vertex.Cached || vertex.Started != nil)) || vertex.Error != "") {
 			sm.printHeader(vm)
@@ -149,6 +175,9 @@ func (sm *SolverMonitor) processStatus(ss *client.SolveStatus) error {
 					sm.noOutputTicker.Reset(sm.noOutputTick)
 				}
 			} else {
+				if sm.targetFailures != nil && vm.meta.TargetID != "" {
+					sm.targetFailures.FailTarget(vm.meta.TargetID, errors.New(vertex.Error))
+				}
 				vm.isError = vm.printError()
 				if sm.errVertex == nil && vm.isError {
 					sm.errVertex = vm
@@ -162,6 +191,10 @@ func (sm *SolverMonitor) processStatus(ss *client.SolveStatus) error {
 			sm.noOutputTicker.Reset(sm.noOutputTick)
 		}
 
+		if vertex.Completed != nil && !vm.spanRecorded {
+			sm.recordSpan(ctx, vm)
+		}
+
 		vm.reportStatusToConsole()
 		vm.reportResultToConsole()
 	}
@@ -199,6 +232,28 @@ func (sm *SolverMonitor) processStatus(ss *client.SolveStatus) error {
 	return nil
 }
 
+// recordSpan records a trace span for the completed vertex, using the timings reported by buildkit.
+func (sm *SolverMonitor) recordSpan(ctx context.Context, vm *vertexMonitor) {
+	vm.spanRecorded = true
+	started := vm.vertex.Completed
+	if vm.vertex.Started != nil {
+		started = vm.vertex.Started
+	}
+	_, span := tracing.Start(ctx, "solve", trace.WithTimestamp(*started), trace.WithAttributes(
+		attribute.String("earthly.vertex.digest", vm.vertex.Digest.String()),
+		attribute.String("earthly.vertex.operation", vm.operation),
+		attribute.String("earthly.target", vm.meta.TargetName),
+		attribute.String("earthly.platform", vm.meta.Platform),
+		attribute.Bool("earthly.vertex.cached", vm.vertex.Cached),
+		attribute.Bool("earthly.vertex.internal", vm.meta.Internal),
+	))
+	var err error
+	if vm.vertex.Error != "" {
+		err = errors.New(vm.vertex.Error)
+	}
+	tracing.End(span, err, trace.WithTimestamp(*vm.vertex.Completed))
+}
+
 func (sm *SolverMonitor) processNoOutputTick(ctx context.Context, bkClient *client.Client) error {
 	ongoingCons := sm.console.WithPrefix("ongoing")
 	sm.msgMu.Lock()
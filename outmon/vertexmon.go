@@ -24,6 +24,7 @@ type vertexMonitor struct {
 	headerPrinted  bool
 	isError        bool
 	isCanceled     bool
+	spanRecorded   bool
 	tailOutput     *circbuf.Buffer
 	// Line of output that has not yet been terminated with a \n.
 	openLine            []byte
@@ -2,7 +2,8 @@ package states
 
 import "sync"
 
-// CacheImports is a synchronized set of cache imports.
+// CacheImports is a synchronized set of cache imports. Each import is either a docker tag, or the spec
+// of a local or S3 remote cache, as parsed by llbutil.ParseRemoteCache.
 type CacheImports struct {
 	mu    sync.RWMutex
 	slice []string
@@ -1,6 +1,8 @@
 package image
 
 import (
+	"time"
+
 	"github.com/earthly/earthly/util/llbutil"
 	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
@@ -9,9 +11,10 @@ import (
 // Image is a partial of the standard Image struct defined as part of the image opencontainers spec
 // at https://github.com/opencontainers/image-spec/blob/master/specs-go/v1/config.go#L82
 type Image struct {
-	Architecture string `json:"architecture"`
-	OS           string `json:"os"`
-	Config       Config `json:"config"`
+	Created      *time.Time `json:"created,omitempty"`
+	Architecture string     `json:"architecture"`
+	OS           string     `json:"os"`
+	Config       Config     `json:"config"`
 }
 
 // NewImage returns a new image.
@@ -35,6 +38,7 @@ func (img *Image) Clone() *Image {
 		return NewImage()
 	}
 	clone := &Image{
+		Created:      img.Created,
 		Architecture: img.Architecture,
 		OS:           img.OS,
 		Config: Config{
@@ -7,6 +7,7 @@ import (
 	"github.com/earthly/earthly/domain"
 	"github.com/earthly/earthly/states/dedup"
 	"github.com/earthly/earthly/states/image"
+	"github.com/earthly/earthly/util/imagebudget"
 	"github.com/earthly/earthly/util/llbutil/pllb"
 	"github.com/earthly/earthly/util/platutil"
 	"github.com/earthly/earthly/variables"
@@ -37,11 +38,13 @@ func (mts *MultiTarget) All() []*SingleTarget {
 // SingleTarget holds LLB states representing an earthly target.
 type SingleTarget struct {
 	// ID is a random unique string.
-	ID                     string
-	Target                 domain.Target
-	PlatformResolver       *platutil.Resolver
-	MainImage              *image.Image
-	MainState              pllb.State
+	ID               string
+	Target           domain.Target
+	PlatformResolver *platutil.Resolver
+	MainImage        *image.Image
+	MainState        pllb.State
+	// MainLayerSources are the commands which created the layers of MainState, from the bottom to the top.
+	MainLayerSources       []imagebudget.LayerSource
 	ArtifactsState         pllb.State
 	SeparateArtifactsState []pllb.State
 	SaveLocals             []SaveLocal
@@ -258,6 +261,21 @@ type SaveLocal struct {
 	Index int
 	// IfExists allows the artifact to be optional.
 	IfExists bool
+	// Archive is the archive format (tar, tar.gz or zip) to save the artifact as. When empty,
+	// the artifact files are saved as they are.
+	Archive string
+	// KeepTs keeps the file timestamps within the archive.
+	KeepTs bool
+	// SyncDelete removes the files of the destination directory which are not part of the artifact.
+	SyncDelete bool
+	// Checksum is the algorithm (sha256 or sha512) of the checksum sidecar file to write next to the
+	// artifact, if any.
+	Checksum string
+	// OCIRef is the registry reference to push the artifact to, as an OCI artifact, instead of
+	// saving it to local disk.
+	OCIRef string
+	// MediaType is the media type of the layers of the OCI artifact.
+	MediaType string
 }
 
 // SaveImage is a docker image to be saved.
@@ -285,6 +303,19 @@ type SaveImage struct {
 	HasPlatform bool // true when the --platform value was set (either on cli, or via FROM --platform=..., or BUILD --platform=...)
 
 	SkipBuilder bool // for use with WAIT/END
+
+	// OCITar is the host path of an OCI tarball to write the image to, instead of loading it
+	// into the container frontend.
+	OCITar string
+	// SBOM is the format of the SBOM to generate for the image, if any.
+	SBOM string
+	// Sign is true if the image should be signed once it has been pushed.
+	Sign bool
+	// Budget is the maximum size and number of layers of the image, along with the commands which created
+	// its layers.
+	Budget imagebudget.Budget
+	// Annotations are added to the manifest of the image.
+	Annotations map[string]string
 }
 
 // RunPush is a series of RUN --push commands to be run after the build has been deemed as
@@ -0,0 +1,50 @@
+#!/bin/bash
+# Note: Most of this test runs as Earthly-in-Earthly so that we can easily send local cache to a tmpfs; however it
+# must be started outside of earthly, next to a MinIO instance which stands in for S3.
+#
+# To run this test directly: ./test.sh --build-arg DOCKERHUB_AUTH=false
+
+set -uxe
+set -o pipefail
+
+cd "$(dirname "$0")"
+
+earthly=${earthly-"../../build/linux/amd64/earthly"}
+
+# Cleanup previous run.
+docker stop minio || true
+docker rm minio || true
+
+# Run MinIO.
+docker run --rm -d \
+    -e MINIO_ROOT_USER=minioadmin \
+    -e MINIO_ROOT_PASSWORD=minioadmin \
+    --name minio minio/minio server /data
+
+export MINIO_IP="$(docker inspect -f {{range.NetworkSettings.Networks}}{{.IPAddress}}{{end}} minio)"
+export MINIO_ENDPOINT="$MINIO_IP:9000"
+
+# Create the bucket.
+for i in $(seq 1 10); do
+    if docker run --rm --entrypoint sh minio/mc -c \
+        "mc alias set minio http://$MINIO_ENDPOINT minioadmin minioadmin && mc mb --ignore-existing minio/earthly-cache"; then
+        break
+    fi
+    sleep 1
+done
+
+# Test.
+set +e
+"$earthly" --allow-privileged \
+    --no-output \
+    --strict \
+    --build-arg MINIO_ENDPOINT \
+    "$@" \
+    +all
+exit_code="$?"
+set -e
+
+# Cleanup.
+docker stop minio
+
+exit "$exit_code"
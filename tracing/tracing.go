@@ -0,0 +1,179 @@
+// Package tracing exports OpenTelemetry traces of earthly invocations via OTLP.
+package tracing
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ProtocolGRPC exports spans using OTLP over gRPC.
+	ProtocolGRPC = "grpc"
+	// ProtocolHTTP exports spans using OTLP over HTTP (protobuf encoded).
+	ProtocolHTTP = "http/protobuf"
+
+	instrumentationName = "github.com/earthly/earthly"
+	serviceName         = "earthly"
+	tracesURLPath       = "/v1/traces"
+)
+
+// Opt contains the settings used to initialize tracing.
+type Opt struct {
+	// Endpoint is the OTLP collector endpoint, either as host:port or as a URL.
+	// When empty, the standard OTEL_EXPORTER_OTLP_* env vars are used.
+	Endpoint string
+	// Protocol is either grpc or http/protobuf. When empty, the standard
+	// OTEL_EXPORTER_OTLP_*PROTOCOL env vars are used, defaulting to grpc.
+	Protocol string
+	// Insecure disables TLS when connecting to the collector.
+	Insecure bool
+	// Version is the earthly version reported as part of the service resource.
+	Version string
+}
+
+// Init sets up the global tracer provider. Tracing is only enabled if an endpoint
+// has been configured, either via opt or via the OTEL_* env vars; otherwise
+// the spans created via Start are no-ops. The returned shutdown func flushes
+// any pending spans and must be called before exiting.
+func Init(ctx context.Context, opt Opt) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+	if !enabled(opt) {
+		return noop, nil
+	}
+	protocol := opt.Protocol
+	if protocol == "" {
+		protocol = firstEnv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	endpoint, urlPath, insecure, err := parseEndpoint(opt.Endpoint)
+	if err != nil {
+		return noop, err
+	}
+	insecure = insecure || opt.Insecure
+
+	var client otlptrace.Client
+	switch protocol {
+	case "", ProtocolGRPC:
+		if urlPath != "" {
+			return noop, errors.Errorf("otel endpoint %s contains a path, which is only supported by the %s protocol", opt.Endpoint, ProtocolHTTP)
+		}
+		var grpcOpts []otlptracegrpc.Option
+		if endpoint != "" {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithEndpoint(endpoint))
+		}
+		if insecure {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithInsecure())
+		}
+		client = otlptracegrpc.NewClient(grpcOpts...)
+	case ProtocolHTTP, "http":
+		var httpOpts []otlptracehttp.Option
+		if endpoint != "" {
+			httpOpts = append(httpOpts, otlptracehttp.WithEndpoint(endpoint))
+		}
+		if urlPath != "" {
+			httpOpts = append(httpOpts, otlptracehttp.WithURLPath(urlPath))
+		}
+		if insecure {
+			httpOpts = append(httpOpts, otlptracehttp.WithInsecure())
+		}
+		client = otlptracehttp.NewClient(httpOpts...)
+	default:
+		return noop, errors.Errorf("unsupported otel protocol %q; valid options are %s and %s", protocol, ProtocolGRPC, ProtocolHTTP)
+	}
+
+	// The exporter connects lazily; it does not block when the collector is unavailable.
+	exporter, err := otlptrace.New(ctx, client)
+	if err != nil {
+		return noop, errors.Wrap(err, "create otlp trace exporter")
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(serviceName),
+			semconv.ServiceVersionKey.String(opt.Version),
+		),
+		resource.WithFromEnv(), // allow OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES to override
+	)
+	if err != nil {
+		return noop, errors.Wrap(err, "create otel resource")
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+// Start creates a span and a context containing it. When tracing has not been
+// initialized, the span is a no-op.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End completes the span, marking it as failed if err is not nil.
+func End(span trace.Span, err error, opts ...trace.SpanEndOption) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(opts...)
+}
+
+func enabled(opt Opt) bool {
+	if opt.Endpoint != "" {
+		return true
+	}
+	if v, ok := os.LookupEnv("OTEL_SDK_DISABLED"); ok && strings.EqualFold(v, "true") {
+		return false
+	}
+	return firstEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT") != ""
+}
+
+// parseEndpoint converts the configured endpoint into the host:port form expected by the
+// exporters, along with the URL path of the traces (if the endpoint has one); a http:// scheme
+// implies an insecure connection. As for OTEL_EXPORTER_OTLP_ENDPOINT, the path is the base
+// path of the collector, to which /v1/traces is appended, unless it is already present.
+func parseEndpoint(endpoint string) (string, string, bool, error) {
+	if endpoint == "" || !strings.Contains(endpoint, "://") {
+		return endpoint, "", false, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", false, errors.Wrapf(err, "parse otel endpoint %s", endpoint)
+	}
+	urlPath := strings.TrimSuffix(u.Path, "/")
+	if urlPath != "" && !strings.HasSuffix(urlPath, tracesURLPath) {
+		urlPath += tracesURLPath
+	}
+	switch u.Scheme {
+	case "http":
+		return u.Host, urlPath, true, nil
+	case "https":
+		return u.Host, urlPath, false, nil
+	default:
+		return "", "", false, errors.Errorf("unsupported otel endpoint scheme %s", u.Scheme)
+	}
+}
+
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
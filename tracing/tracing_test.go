@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	. "github.com/stretchr/testify/assert"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestExportHTTP(t *testing.T) {
+	var mu sync.Mutex
+	var spanNames []string
+	var serviceNames []string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/otel/v1/traces" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var req coltracepb.ExportTraceServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, attr := range rs.GetResource().GetAttributes() {
+				if attr.Key == "service.name" {
+					serviceNames = append(serviceNames, attr.GetValue().GetStringValue())
+				}
+			}
+			for _, ils := range rs.InstrumentationLibrarySpans {
+				for _, s := range ils.Spans {
+					spanNames = append(spanNames, s.Name)
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	ctx := context.Background()
+	shutdown, err := Init(ctx, Opt{
+		Endpoint: collector.URL + "/otel",
+		Protocol: ProtocolHTTP,
+		Version:  "test",
+	})
+	NoError(t, err)
+
+	ctx, parent := Start(ctx, "parent")
+	_, child := Start(ctx, "child")
+	End(child, nil)
+	End(parent, nil)
+
+	NoError(t, shutdown(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	ElementsMatch(t, []string{"parent", "child"}, spanNames)
+	Contains(t, serviceNames, "earthly")
+}
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		host     string
+		urlPath  string
+		insecure bool
+	}{
+		{"", "", "", false},
+		{"localhost:4317", "localhost:4317", "", false},
+		{"http://localhost:4318", "localhost:4318", "", true},
+		{"https://collector.example.com/", "collector.example.com", "", false},
+		{"https://collector.example.com/otel", "collector.example.com", "/otel/v1/traces", false},
+		{"https://collector.example.com/otel/v1/traces", "collector.example.com", "/otel/v1/traces", false},
+	}
+	for _, tt := range tests {
+		host, urlPath, insecure, err := parseEndpoint(tt.endpoint)
+		NoError(t, err)
+		Equal(t, tt.host, host)
+		Equal(t, tt.urlPath, urlPath)
+		Equal(t, tt.insecure, insecure)
+	}
+	_, _, _, err := parseEndpoint("ftp://localhost")
+	Error(t, err)
+}
+
+func TestInitRejectsGRPCEndpointPath(t *testing.T) {
+	_, err := Init(context.Background(), Opt{
+		Endpoint: "https://collector.example.com/otel",
+		Protocol: ProtocolGRPC,
+	})
+	Error(t, err)
+}
@@ -0,0 +1,249 @@
+// Package cachemount keeps track of the cache mounts used by builds (via CACHE and RUN --mount type=cache),
+// such that the cache mount records of buildkit can be attributed to the targets which use them.
+package cachemount
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/earthly/earthly/util/fileutil"
+
+	"github.com/moby/buildkit/client"
+	"github.com/pkg/errors"
+)
+
+// maxEntries is the maximum number of entries kept in the index; the least recently used ones are dropped.
+const maxEntries = 1000
+
+// Entry is a cache mount used by a build.
+type Entry struct {
+	ID          string    `json:"id"` // e.g. /run/cache/<target-key>/<mount-id>
+	Target      string    `json:"target"`
+	MountTarget string    `json:"mountTarget"`
+	LastUsed    time.Time `json:"lastUsed"`
+}
+
+// Index is the persisted list of the cache mounts used by builds.
+type Index struct {
+	Entries []Entry `json:"entries"`
+}
+
+// Load reads the index from the given path. A missing index is empty.
+func Load(path string) (*Index, error) {
+	dt, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Index{}, nil
+		}
+		return nil, errors.Wrapf(err, "read %s", path)
+	}
+	var idx Index
+	err = json.Unmarshal(dt, &idx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", path)
+	}
+	return &idx, nil
+}
+
+// Save writes the index to the given path.
+func Save(path string, idx *Index) error {
+	dt, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "serialize cache mount index")
+	}
+	return fileutil.WriteFileAtomic(path, dt)
+}
+
+// Update adds the given entries to the index, replacing the existing entries with the same IDs.
+func (idx *Index) Update(entries []Entry) {
+	byID := make(map[string]int, len(idx.Entries))
+	for i, e := range idx.Entries {
+		byID[e.ID] = i
+	}
+	for _, e := range entries {
+		if i, ok := byID[e.ID]; ok {
+			idx.Entries[i] = e
+			continue
+		}
+		byID[e.ID] = len(idx.Entries)
+		idx.Entries = append(idx.Entries, e)
+	}
+	sort.SliceStable(idx.Entries, func(i, j int) bool {
+		return idx.Entries[i].LastUsed.After(idx.Entries[j].LastUsed)
+	})
+	if len(idx.Entries) > maxEntries {
+		idx.Entries = idx.Entries[:maxEntries]
+	}
+}
+
+// Remove removes the entries with the given IDs from the index.
+func (idx *Index) Remove(ids ...string) {
+	remove := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+	entries := idx.Entries[:0]
+	for _, e := range idx.Entries {
+		if !remove[e.ID] {
+			entries = append(entries, e)
+		}
+	}
+	idx.Entries = entries
+}
+
+// Recorder records the cache mounts used by a build in a concurrent-safe way.
+// A nil *Recorder is valid and records nothing.
+type Recorder struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+// NewRecorder returns a new Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		entries: make(map[string]Entry),
+	}
+}
+
+// Record records the use of the cache mount id, mounted at mountTarget by target.
+func (r *Recorder) Record(id, target, mountTarget string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[id] = Entry{
+		ID:          id,
+		Target:      target,
+		MountTarget: mountTarget,
+		LastUsed:    time.Now().UTC(),
+	}
+}
+
+// Entries returns the recorded cache mounts.
+func (r *Recorder) Entries() []Entry {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ret := make([]Entry, 0, len(r.entries))
+	for _, e := range r.entries {
+		ret = append(ret, e)
+	}
+	return ret
+}
+
+// Mount is a cache mount record of buildkit, along with the index entry it has been attributed to, if any.
+// When the attribution is ambiguous, Entry is nil, and Candidates lists the entries it could be attributed to.
+type Mount struct {
+	Record     *client.UsageInfo
+	Entry      *Entry
+	Candidates []Entry
+}
+
+// MountTargetOf returns the mount target of a cache mount record, from its description, which is of the
+// form "cached mount <mount-target> from exec <command>".
+func MountTargetOf(description string) string {
+	s := strings.TrimPrefix(description, "cached mount ")
+	if s == description {
+		return ""
+	}
+	if i := strings.Index(s, " from "); i != -1 {
+		s = s[:i]
+	}
+	return s
+}
+
+// Match returns the cache mount records among the given buildkit records, most recently used first, and
+// attributes each of them to an index entry. Since buildkit does not expose the ID of a cache mount, records
+// are attributed by their mount target, and only when that is unambiguous, i.e. when a single record and a
+// single entry have the mount target. Otherwise, the entries with the mount target are kept as Candidates.
+func Match(records []*client.UsageInfo, entries []Entry) []Mount {
+	var mounts []Mount
+	numRecords := make(map[string]int) // mount target -> number of records
+	for _, r := range records {
+		if r.RecordType == client.UsageRecordTypeCacheMount {
+			mounts = append(mounts, Mount{Record: r})
+			numRecords[MountTargetOf(r.Description)]++
+		}
+	}
+	sort.SliceStable(mounts, func(i, j int) bool {
+		return LastUsed(mounts[i].Record).After(LastUsed(mounts[j].Record))
+	})
+	byMountTarget := make(map[string][]Entry)
+	for _, e := range entries {
+		byMountTarget[e.MountTarget] = append(byMountTarget[e.MountTarget], e)
+	}
+	for mi := range mounts {
+		mountTarget := MountTargetOf(mounts[mi].Record.Description)
+		candidates := byMountTarget[mountTarget]
+		if len(candidates) == 1 && numRecords[mountTarget] == 1 {
+			e := candidates[0]
+			mounts[mi].Entry = &e
+			continue
+		}
+		mounts[mi].Candidates = candidates
+	}
+	return mounts
+}
+
+// LastUsed returns the time the record was last used, or its creation time if it has never been used.
+func LastUsed(r *client.UsageInfo) time.Time {
+	if r.LastUsedAt != nil {
+		return *r.LastUsedAt
+	}
+	return r.CreatedAt
+}
+
+// Select returns the mounts which were last used before the given time, if set, and which are larger than
+// the given size, if set.
+func Select(mounts []Mount, usedBefore time.Time, largerThan int64) []Mount {
+	var ret []Mount
+	for _, m := range mounts {
+		if !usedBefore.IsZero() && !LastUsed(m.Record).Before(usedBefore) {
+			continue
+		}
+		if largerThan > 0 && m.Record.Size <= largerThan {
+			continue
+		}
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+// Find returns the mount with the given buildkit record ID, or record ID prefix, or cache mount ID. A cache
+// mount ID which cannot be attributed to a single record is refused, such that the mount of another target is
+// never picked instead.
+func Find(mounts []Mount, id string) (Mount, error) {
+	var found []Mount
+	ambiguous := false
+	for _, m := range mounts {
+		if m.Record.ID == id || (m.Entry != nil && m.Entry.ID == id) {
+			return m, nil
+		}
+		if strings.HasPrefix(m.Record.ID, id) {
+			found = append(found, m)
+		}
+		for _, e := range m.Candidates {
+			if e.ID == id {
+				ambiguous = true
+			}
+		}
+	}
+	if len(found) == 0 && ambiguous {
+		return Mount{}, errors.Errorf("cache mount %s cannot be told apart from the other cache mounts with the same mount path; use the id of its record instead", id)
+	}
+	switch len(found) {
+	case 0:
+		return Mount{}, errors.Errorf("cache mount %s not found", id)
+	case 1:
+		return found[0], nil
+	default:
+		return Mount{}, errors.Errorf("cache mount id %s is ambiguous", id)
+	}
+}
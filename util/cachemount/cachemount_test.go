@@ -0,0 +1,81 @@
+package cachemount
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/moby/buildkit/client"
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+	records := []*client.UsageInfo{
+		{ID: "a", RecordType: client.UsageRecordTypeCacheMount, Description: "cached mount /root/.cache from exec /bin/sh -c go build", LastUsedAt: at(time.Hour), Size: 100},
+		{ID: "b", RecordType: client.UsageRecordTypeCacheMount, Description: "cached mount /root/.cache from exec /bin/sh -c go test", LastUsedAt: at(time.Minute), Size: 200},
+		{ID: "c", RecordType: client.UsageRecordTypeCacheMount, Description: "cached mount /var/cache/apt from exec /bin/sh -c apt-get update", LastUsedAt: at(48 * time.Hour), Size: 300},
+		{ID: "d", RecordType: client.UsageRecordTypeRegular, Description: "mount / from exec /bin/sh -c ls"},
+		{ID: "e", RecordType: client.UsageRecordTypeCacheMount, Description: "cached mount /go/pkg from exec /bin/sh -c go mod download", LastUsedAt: at(2 * time.Hour), Size: 400},
+	}
+	entries := []Entry{
+		{ID: "/run/cache/k1/root/.cache", Target: "+build", MountTarget: "/root/.cache", LastUsed: now.Add(-time.Hour)},
+		{ID: "/run/cache/k2/root/.cache", Target: "+test", MountTarget: "/root/.cache", LastUsed: now.Add(-time.Minute)},
+		{ID: "/run/cache/k1/go/pkg", Target: "+deps", MountTarget: "/go/pkg", LastUsed: now.Add(-2 * time.Hour)},
+	}
+	mounts := Match(records, entries)
+	if !Len(t, mounts, 4) {
+		return
+	}
+	// The records of the same mount target cannot be told apart.
+	Equal(t, "b", mounts[0].Record.ID)
+	Nil(t, mounts[0].Entry)
+	Len(t, mounts[0].Candidates, 2)
+	Equal(t, "a", mounts[1].Record.ID)
+	Nil(t, mounts[1].Entry)
+	Len(t, mounts[1].Candidates, 2)
+	Equal(t, "e", mounts[2].Record.ID)
+	Equal(t, "+deps", mounts[2].Entry.Target)
+	Equal(t, "c", mounts[3].Record.ID)
+	Nil(t, mounts[3].Entry)
+	Empty(t, mounts[3].Candidates)
+
+	Len(t, Select(mounts, now.Add(-24*time.Hour), 0), 1)
+	Len(t, Select(mounts, time.Time{}, 150), 3)
+
+	m, err := Find(mounts, "/run/cache/k1/go/pkg")
+	NoError(t, err)
+	Equal(t, "e", m.Record.ID)
+	m, err = Find(mounts, "a")
+	NoError(t, err)
+	Equal(t, "a", m.Record.ID)
+	_, err = Find(mounts, "/run/cache/k1/root/.cache")
+	Error(t, err)
+	_, err = Find(mounts, "x")
+	Error(t, err)
+}
+
+func TestIndex(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "cache-mounts.json")
+	idx, err := Load(p)
+	if !NoError(t, err) {
+		return
+	}
+	r := NewRecorder()
+	r.Record("/run/cache/k1/a", "+a", "/a")
+	r.Record("/run/cache/k1/b", "+a", "/b")
+	idx.Update(r.Entries())
+	idx.Remove("/run/cache/k1/a")
+	NoError(t, Save(p, idx))
+	idx, err = Load(p)
+	if !NoError(t, err) {
+		return
+	}
+	if Len(t, idx.Entries, 1) {
+		Equal(t, "/run/cache/k1/b", idx.Entries[0].ID)
+	}
+}
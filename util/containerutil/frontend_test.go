@@ -386,6 +386,8 @@ func TestFrontendImageInfo(t *testing.T) {
 
 			assert.Contains(t, info[tC.refList[0]].Tags, tC.refList[0])
 			assert.Contains(t, info[tC.refList[1]].Tags, tC.refList[1])
+			assert.NotEmpty(t, info[tC.refList[0]].Layers)
+			assert.NotZero(t, info[tC.refList[0]].Size)
 		})
 	}
 }
@@ -229,15 +229,21 @@ func (sf *shellFrontend) ImageInfo(ctx context.Context, refs ...string) (map[str
 
 	// Anonymous struct to just pick out what we need
 	images := []struct {
-		ID   string   `json:"Id"`
-		Tags []string `json:"RepoTags"`
+		ID     string   `json:"Id"`
+		Tags   []string `json:"RepoTags"`
+		Size   uint64   `json:"Size"`
+		RootFS struct {
+			Layers []string `json:"Layers"`
+		} `json:"RootFS"`
 	}{}
 	json.Unmarshal([]byte(output.stdout.String()), &images)
 
 	for i, image := range images {
 		infos[refs[i]] = &ImageInfo{
-			ID:   image.ID,
-			Tags: image.Tags,
+			ID:     image.ID,
+			Tags:   image.Tags,
+			Size:   image.Size,
+			Layers: image.RootFS.Layers,
 		}
 	}
 
@@ -61,10 +61,14 @@ type FrontendInfo struct {
 	ServerAddress    string
 }
 
-// ImageInfo contains information about a given image ref, including all relevant tags.
+// ImageInfo contains information about a given image ref, including all relevant tags, its size and its layers.
 type ImageInfo struct {
 	ID   string
 	Tags []string
+	// Size is the uncompressed size of the image, in bytes.
+	Size uint64
+	// Layers are the digests of the uncompressed layers of the image, from the bottom to the top.
+	Layers []string
 }
 
 // VolumeInfo contains information about a given volume, including its name, where its mounted from, and the size of the volume.
@@ -0,0 +1,265 @@
+package explaincache
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Explanation explains why a vertex of a build has not been cached.
+type Explanation struct {
+	Target    string
+	Platform  string
+	Operation string
+	Reason    string
+}
+
+func (e Explanation) String() string {
+	if e.Platform == "" {
+		return fmt.Sprintf("%s %s: %s", e.Target, e.Operation, e.Reason)
+	}
+	return fmt.Sprintf("%s(%s) %s: %s", e.Target, e.Platform, e.Operation, e.Reason)
+}
+
+type vertexKey struct {
+	target    string
+	platform  string
+	operation string
+	n         int // the occurrence of the same operation within the target
+}
+
+type index struct {
+	build    *Build
+	byDigest map[digest.Digest]*Vertex
+	byKey    map[vertexKey]*Vertex
+	keys     map[digest.Digest]vertexKey
+	targets  map[targetKey]*Target
+}
+
+func newIndex(b *Build) *index {
+	idx := &index{
+		build:    b,
+		byDigest: make(map[digest.Digest]*Vertex),
+		byKey:    make(map[vertexKey]*Vertex),
+		keys:     make(map[digest.Digest]vertexKey),
+		targets:  make(map[targetKey]*Target),
+	}
+	if b == nil {
+		return idx
+	}
+	for _, v := range b.Vertices {
+		idx.byDigest[v.Digest] = v
+		key := vertexKey{target: v.Target, platform: v.Platform, operation: v.Operation}
+		for {
+			if _, ok := idx.byKey[key]; !ok {
+				break
+			}
+			key.n++
+		}
+		idx.byKey[key] = v
+		idx.keys[v.Digest] = key
+	}
+	for _, t := range b.Targets {
+		idx.targets[targetKey{name: t.Name, platform: t.Platform}] = t
+	}
+	return idx
+}
+
+func (idx *index) target(v *Vertex) *Target {
+	return idx.targets[targetKey{name: v.Target, platform: v.Platform}]
+}
+
+// Explain returns, for every vertex of the current build which has been executed instead of cached, the
+// first input which differs from the previous build.
+func Explain(prev, cur *Build) []Explanation {
+	if cur == nil {
+		return nil
+	}
+	p := newIndex(prev)
+	c := newIndex(cur)
+	var ret []Explanation
+	for _, v := range cur.Vertices {
+		if !v.Ran || v.Internal || v.isLocalSource() {
+			continue
+		}
+		ret = append(ret, Explanation{
+			Target:    v.Target,
+			Platform:  v.Platform,
+			Operation: v.Operation,
+			Reason:    explainVertex(p, c, v),
+		})
+	}
+	return ret
+}
+
+func explainVertex(p, c *index, v *Vertex) string {
+	old, ok := p.byKey[c.keys[v.Digest]]
+	if !ok {
+		return "new step, or its command changed"
+	}
+	for _, in := range v.Inputs {
+		parent, ok := c.byDigest[in]
+		if ok && parent.Ran && !parent.Internal && !parent.isLocalSource() {
+			return fmt.Sprintf("parent step missed the cache: %s", parent)
+		}
+	}
+	oldTarget, curTarget := p.target(old), c.target(v)
+	if old.Digest == v.Digest {
+		// The definition of the step did not change, hence its cache key differs by the contents of its
+		// local inputs, or its cache has been pruned since.
+		if usesLocalSource(c, v) && oldTarget != nil && curTarget != nil {
+			if f, ok := changedFile(oldTarget, curTarget); ok {
+				return f
+			}
+			return "local files changed"
+		}
+		return "previous cache no longer available (pruned)"
+	}
+	if img, ok := imageChange(p, c, v); ok {
+		return img
+	}
+	if oldTarget != nil && curTarget != nil {
+		if img, ok := changedBaseImage(oldTarget, curTarget, v); ok {
+			return img
+		}
+		if arg, ok := changedArg(oldTarget, curTarget, v); ok {
+			return arg
+		}
+	}
+	oldInputs := make(map[digest.Digest]bool)
+	for _, in := range old.Inputs {
+		oldInputs[in] = true
+	}
+	for _, in := range v.Inputs {
+		if oldInputs[in] {
+			continue
+		}
+		parent, ok := c.byDigest[in]
+		if !ok || parent.isLocalSource() {
+			continue
+		}
+		return fmt.Sprintf("input step changed: %s", parent)
+	}
+	return "the command changed"
+}
+
+func usesLocalSource(c *index, v *Vertex) bool {
+	for _, in := range v.Inputs {
+		if parent, ok := c.byDigest[in]; ok && parent.isLocalSource() {
+			return true
+		}
+	}
+	return strings.HasPrefix(v.Operation, "COPY ")
+}
+
+func changedFile(old, cur *Target) (string, bool) {
+	paths := make(map[string]bool)
+	for p := range old.Files {
+		paths[p] = true
+	}
+	for p := range cur.Files {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+	for _, p := range sorted {
+		of, inOld := old.Files[p]
+		cf, inCur := cur.Files[p]
+		switch {
+		case !inOld:
+			return fmt.Sprintf("local file %s added", p), true
+		case !inCur:
+			return fmt.Sprintf("local file %s removed", p), true
+		case of.Digest != cf.Digest:
+			return fmt.Sprintf("local file %s changed", p), true
+		}
+	}
+	return "", false
+}
+
+// imageChange explains an image pull vertex, which is named after the image rather than after a target.
+func imageChange(p, c *index, v *Vertex) (string, bool) {
+	for _, t := range c.build.Targets {
+		cd, ok := t.BaseImages[v.Target]
+		if !ok {
+			continue
+		}
+		old, ok := p.targets[targetKey{name: t.Name, platform: t.Platform}]
+		if !ok {
+			continue
+		}
+		if od, ok := old.BaseImages[v.Target]; ok && od != cd {
+			return fmt.Sprintf("base image %s changed from %s to %s", v.Target, od, cd), true
+		}
+	}
+	return "", false
+}
+
+func changedBaseImage(old, cur *Target, v *Vertex) (string, bool) {
+	names := make([]string, 0, len(cur.BaseImages))
+	for name := range cur.BaseImages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// Prefer the image referenced by the step itself, as in FROM <image>.
+	sort.SliceStable(names, func(i, j int) bool {
+		return strings.Contains(v.Operation, names[i]) && !strings.Contains(v.Operation, names[j])
+	})
+	for _, name := range names {
+		od, ok := old.BaseImages[name]
+		if ok && od != cur.BaseImages[name] {
+			return fmt.Sprintf("base image %s changed from %s to %s", name, od, cur.BaseImages[name]), true
+		}
+	}
+	return "", false
+}
+
+var argRefRegexp = regexp.MustCompile(`\$\{?([a-zA-Z_][a-zA-Z0-9_]*)`)
+
+func changedArg(old, cur *Target, v *Vertex) (string, bool) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range argRefRegexp.FindAllStringSubmatch(v.Operation, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	var rest []string
+	for name := range old.Args {
+		if !seen[name] {
+			seen[name] = true
+			rest = append(rest, name)
+		}
+	}
+	for name := range cur.Args {
+		if !seen[name] {
+			seen[name] = true
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	// Prefer the ARGs referenced by the step itself. Only the digests of the values are recorded, hence the
+	// values are not reported.
+	for _, name := range append(names, rest...) {
+		ov, inOld := old.Args[name]
+		cv, inCur := cur.Args[name]
+		switch {
+		case !inOld && !inCur:
+			continue
+		case !inOld:
+			return fmt.Sprintf("ARG %s added", name), true
+		case !inCur:
+			return fmt.Sprintf("ARG %s removed", name), true
+		case ov != cv:
+			return fmt.Sprintf("ARG %s changed", name), true
+		}
+	}
+	return "", false
+}
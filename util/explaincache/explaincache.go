@@ -0,0 +1,234 @@
+// Package explaincache records the vertices of a build, along with the inputs of its targets (ARG values,
+// base images and local files), such that the cache misses of the next build of the same target can be
+// explained.
+package explaincache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/tonistiigi/fsutil"
+
+	"github.com/earthly/earthly/util/fileutil"
+	"github.com/earthly/earthly/util/reproducible"
+)
+
+// Vertex is a vertex of a build, as reported by buildkit.
+type Vertex struct {
+	Digest    digest.Digest   `json:"digest"`
+	Inputs    []digest.Digest `json:"inputs,omitempty"`
+	Target    string          `json:"target"`
+	Platform  string          `json:"platform,omitempty"`
+	Operation string          `json:"operation"`
+	Internal  bool            `json:"internal,omitempty"`
+	Cached    bool            `json:"cached,omitempty"`
+	// Ran is set if the vertex has been executed, as opposed to having been cached or skipped.
+	Ran bool `json:"ran,omitempty"`
+}
+
+func (v *Vertex) String() string {
+	return fmt.Sprintf("%s %s", v.Target, v.Operation)
+}
+
+// isLocalSource returns whether the vertex transfers a local build context. Such vertices are executed on
+// every build; whether their contents changed is only known from the vertices which use them.
+func (v *Vertex) isLocalSource() bool {
+	return v.Target == "context" && strings.HasPrefix(v.Operation, "local context")
+}
+
+// Target holds the inputs of a target of a build.
+type Target struct {
+	Name     string `json:"name"`
+	Platform string `json:"platform,omitempty"`
+	// Args are the digests of the ARG values, such that no secret value (e.g. a token) is persisted.
+	Args       map[string]string `json:"args,omitempty"`
+	BaseImages map[string]string `json:"baseImages,omitempty"` // image name -> resolved digest
+	ContextDir string            `json:"contextDir,omitempty"`
+	// Files are the files copied from the local build context, by their path relative to ContextDir.
+	Files reproducible.Snapshot `json:"files,omitempty"`
+}
+
+// Build holds the vertices and the targets of a build.
+type Build struct {
+	Vertices []*Vertex `json:"vertices"`
+	Targets  []*Target `json:"targets"`
+}
+
+// Load reads the build stored at the given path. It returns nil if there is none.
+func Load(p string) (*Build, error) {
+	dt, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "read %s", p)
+	}
+	var b Build
+	err = json.Unmarshal(dt, &b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", p)
+	}
+	return &b, nil
+}
+
+// Save writes the build to the given path.
+func Save(p string, b *Build) error {
+	dt, err := json.Marshal(b)
+	if err != nil {
+		return errors.Wrap(err, "serialize build")
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return errors.Wrapf(err, "create dir for %s", p)
+	}
+	return fileutil.WriteFileAtomic(p, dt)
+}
+
+type targetKey struct {
+	name     string
+	platform string
+}
+
+// Recorder records the vertices and the target inputs of a build in a concurrent-safe way.
+// A nil *Recorder is valid and records nothing.
+type Recorder struct {
+	mu       sync.Mutex
+	vertices []*Vertex
+	byDigest map[digest.Digest]*Vertex
+	targets  []*Target
+	byKey    map[targetKey]*Target
+}
+
+// NewRecorder returns a new Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		byDigest: make(map[digest.Digest]*Vertex),
+		byKey:    make(map[targetKey]*Target),
+	}
+}
+
+// RecordVertex records the latest status of a vertex.
+func (r *Recorder) RecordVertex(v Vertex) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.byDigest[v.Digest]; ok {
+		*existing = v
+		return
+	}
+	r.byDigest[v.Digest] = &v
+	r.vertices = append(r.vertices, &v)
+}
+
+// target returns the target with the given name and platform, creating it if needed. The lock must be held.
+func (r *Recorder) target(name, platform string) *Target {
+	key := targetKey{name: name, platform: platform}
+	t, ok := r.byKey[key]
+	if !ok {
+		t = &Target{Name: name, Platform: platform}
+		r.byKey[key] = t
+		r.targets = append(r.targets, t)
+	}
+	return t
+}
+
+// RecordArgs records the ARG values of a target, by their digest.
+func (r *Recorder) RecordArgs(name, platform string, args map[string]string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.target(name, platform)
+	if t.Args == nil {
+		t.Args = make(map[string]string)
+	}
+	for k, v := range args {
+		t.Args[k] = digest.FromString(v).String()
+	}
+}
+
+// RecordBaseImage records the digest an image used by a target has been resolved to.
+func (r *Recorder) RecordBaseImage(name, platform, imageName string, dgst digest.Digest) {
+	if r == nil || dgst == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.target(name, platform)
+	if t.BaseImages == nil {
+		t.BaseImages = make(map[string]string)
+	}
+	t.BaseImages[imageName] = dgst.String()
+}
+
+// RecordCopy records the files of the local build context of a target which are copied by a COPY command.
+// The files are selected by the include patterns of the COPY sources and the exclude patterns of the build
+// context (e.g. from .earthlyignore), in the same way as the local source transfers them, and are snapshotted
+// right away, i.e. before the build runs.
+func (r *Recorder) RecordCopy(ctx context.Context, name, platform, contextDir string, includes, excludes []string) {
+	if r == nil {
+		return
+	}
+	files := snapshotFiles(ctx, contextDir, includes, excludes)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.target(name, platform)
+	t.ContextDir = contextDir
+	if t.Files == nil {
+		t.Files = make(reproducible.Snapshot)
+	}
+	for p, f := range files {
+		t.Files[p] = f
+	}
+}
+
+// Build returns the recorded build.
+func (r *Recorder) Build() *Build {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := &Build{}
+	for _, v := range r.vertices {
+		vc := *v
+		b.Vertices = append(b.Vertices, &vc)
+	}
+	for _, t := range r.targets {
+		tc := *t
+		b.Targets = append(b.Targets, &tc)
+	}
+	return b
+}
+
+// snapshotFiles snapshots the files of contextDir matched by the include patterns and not by the exclude
+// patterns. Files which cannot be read are skipped.
+func snapshotFiles(ctx context.Context, contextDir string, includes, excludes []string) reproducible.Snapshot {
+	ret := make(reproducible.Snapshot)
+	opt := &fsutil.WalkOpt{
+		IncludePatterns: includes,
+		ExcludePatterns: excludes,
+	}
+	_ = fsutil.Walk(ctx, contextDir, opt, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return nil
+		}
+		f, err := reproducible.SnapshotFile(filepath.Join(contextDir, p), fi)
+		if err != nil {
+			return nil
+		}
+		ret[filepath.ToSlash(p)] = f
+		return nil
+	})
+	return ret
+}
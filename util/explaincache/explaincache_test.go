@@ -0,0 +1,71 @@
+package explaincache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	dir := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644))
+	NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module x"), 0644))
+	NoError(t, os.WriteFile(filepath.Join(dir, "gen.go"), []byte("package main"), 0644))
+
+	record := func(alpine, version, runDigest string) *Build {
+		r := NewRecorder()
+		r.RecordVertex(Vertex{Digest: digest.Digest("sha256:from" + alpine), Target: "+build", Operation: "FROM alpine:3.13", Ran: true})
+		r.RecordVertex(Vertex{Digest: "sha256:ctx", Target: "context", Operation: "local context .", Ran: true})
+		r.RecordVertex(Vertex{Digest: "sha256:copy", Inputs: []digest.Digest{digest.Digest("sha256:from" + alpine), "sha256:ctx"}, Target: "+build", Operation: "COPY *.go ./", Ran: true})
+		r.RecordVertex(Vertex{Digest: digest.Digest("sha256:run" + runDigest), Inputs: []digest.Digest{"sha256:copy"}, Target: "+build", Operation: "RUN echo $VERSION", Ran: true})
+		r.RecordBaseImage("+build", "", "alpine:3.13", digest.Digest("sha256:"+alpine))
+		r.RecordArgs("+build", "", map[string]string{"VERSION": version})
+		r.RecordCopy(context.Background(), "+build", "", dir, []string{"*.go"}, []string{"gen.go"})
+		return r.Build()
+	}
+
+	p := filepath.Join(t.TempDir(), "build.json")
+	prev, err := Load(p)
+	NoError(t, err)
+	Nil(t, prev)
+	NoError(t, Save(p, record("a", "1", "1")))
+	prev, err = Load(p)
+	if !NoError(t, err) {
+		return
+	}
+	// The excluded files are not recorded, and neither are the ARG values.
+	Len(t, prev.Targets[0].Files, 1)
+	Equal(t, digest.FromString("1").String(), prev.Targets[0].Args["VERSION"])
+
+	// Only the ARG changed.
+	cur := record("a", "2", "2")
+	cur.Vertices[0].Ran = false
+	cur.Vertices[2].Ran = false
+	expl := Explain(prev, cur)
+	if Len(t, expl, 1) {
+		Equal(t, "RUN echo $VERSION", expl[0].Operation)
+		Equal(t, "ARG VERSION changed", expl[0].Reason)
+	}
+
+	// A local file changed; excluded files are ignored.
+	NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main // changed"), 0644))
+	NoError(t, os.WriteFile(filepath.Join(dir, "gen.go"), []byte("package main // changed"), 0644))
+	cur = record("a", "1", "1")
+	cur.Vertices[0].Ran = false
+	expl = Explain(prev, cur)
+	if Len(t, expl, 2) {
+		Equal(t, "local file main.go changed", expl[0].Reason)
+		Equal(t, "parent step missed the cache: +build COPY *.go ./", expl[1].Reason)
+	}
+
+	// The base image changed.
+	cur = record("b", "1", "1")
+	expl = Explain(prev, cur)
+	if Len(t, expl, 3) {
+		Equal(t, "base image alpine:3.13 changed from sha256:a to sha256:b", expl[0].Reason)
+	}
+}
@@ -0,0 +1,32 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// WriteFileAtomic writes data to the file at path via a temp file in the same dir, which is then renamed
+// over path. Concurrent readers (and writers) hence never see a partially written file.
+func WriteFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "create temp file for %s", path)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return errors.Wrapf(err, "write %s", f.Name())
+	}
+	err = f.Close()
+	if err != nil {
+		return errors.Wrapf(err, "close %s", f.Name())
+	}
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return errors.Wrapf(err, "rename %s to %s", f.Name(), path)
+	}
+	return nil
+}
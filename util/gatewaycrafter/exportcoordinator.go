@@ -5,7 +5,9 @@ import (
 	"sort"
 	"sync"
 
+	"github.com/docker/distribution/reference"
 	"github.com/earthly/earthly/util/dockerutil"
+	"github.com/earthly/earthly/util/imagebudget"
 )
 
 // ExportCoordinator is a thread-safe data-store used for coordinating the export
@@ -17,6 +19,8 @@ type ExportCoordinator struct {
 	artifactOutputSummary []ArtifactOutputSummaryEntry
 	pushedImageSummary    []PushedImageSummaryEntry
 	imgIndex              int
+	ociOutputs            map[string]OCIOutputEntry
+	imageBudgets          map[string]*imageBudgetEntry
 }
 
 type imageEntry struct {
@@ -24,6 +28,11 @@ type imageEntry struct {
 	localImage string
 }
 
+type imageBudgetEntry struct {
+	budgets   []imagebudget.Budget
+	checkOnly bool
+}
+
 // LocalOutputSummaryEntry contains a summary of output images
 type LocalOutputSummaryEntry struct {
 	Target    string
@@ -41,15 +50,27 @@ type PushedImageSummaryEntry struct {
 
 // ArtifactOutputSummaryEntry contains a summary of output artifacts
 type ArtifactOutputSummaryEntry struct {
-	Target string
-	Path   string
-	Salt   string
+	Target  string
+	Path    string
+	Salt    string
+	Changes string // a summary of the files written, if saved incrementally
+}
+
+// OCIOutputEntry describes an image which is written to the host as an OCI image layout or tarball,
+// instead of being loaded into the container frontend.
+type OCIOutputEntry struct {
+	DockerTag     string // the name of the (possibly multi-platform) image
+	MultiPlatform bool   // whether the exported image is one of the platforms of DockerTag
+	TarPath       string // the path of the tarball to write, if any (SAVE IMAGE --oci-tar)
+	Dir           string // the OCI layout dir to write the image into, if any (--image-output=oci-dir:)
 }
 
 // NewExportCoordinator returns a new ExportCoordinator
 func NewExportCoordinator() *ExportCoordinator {
 	return &ExportCoordinator{
 		imageEntries: map[string]imageEntry{},
+		ociOutputs:   map[string]OCIOutputEntry{},
+		imageBudgets: map[string]*imageBudgetEntry{},
 	}
 }
 
@@ -75,14 +96,69 @@ func (ec *ExportCoordinator) AddImage(sessionID, localImage string, manifest *do
 	return k
 }
 
+// AddOCIOutput registers the exported image imageName to be written as an OCI image layout or tarball.
+func (ec *ExportCoordinator) AddOCIOutput(imageName string, entry OCIOutputEntry) {
+	ec.m.Lock()
+	defer ec.m.Unlock()
+	ec.ociOutputs[normalizeImageName(imageName)] = entry
+}
+
+// GetOCIOutput returns the OCI output entry of the exported image imageName, or false if the image
+// should be loaded into the container frontend.
+func (ec *ExportCoordinator) GetOCIOutput(imageName string) (OCIOutputEntry, bool) {
+	ec.m.Lock()
+	defer ec.m.Unlock()
+	entry, ok := ec.ociOutputs[normalizeImageName(imageName)]
+	return entry, ok
+}
+
+// AddImageBudget registers the exported image imageName to be checked against the budget, either as it is
+// streamed as a tarball, or once it has been pulled from the local registry. If checkOnly is set, the image
+// is streamed only for the check, and is not loaded into the container frontend.
+func (ec *ExportCoordinator) AddImageBudget(imageName string, budget imagebudget.Budget, checkOnly bool) {
+	ec.m.Lock()
+	defer ec.m.Unlock()
+	key := normalizeImageName(imageName)
+	entry, ok := ec.imageBudgets[key]
+	if !ok {
+		entry = &imageBudgetEntry{checkOnly: checkOnly}
+		ec.imageBudgets[key] = entry
+	}
+	entry.budgets = append(entry.budgets, budget)
+	entry.checkOnly = entry.checkOnly && checkOnly
+}
+
+// GetImageBudgets returns the budgets which the exported image imageName is checked against, and whether
+// the image is exported only for the check.
+func (ec *ExportCoordinator) GetImageBudgets(imageName string) ([]imagebudget.Budget, bool) {
+	ec.m.Lock()
+	defer ec.m.Unlock()
+	entry, ok := ec.imageBudgets[normalizeImageName(imageName)]
+	if !ok {
+		return nil, false
+	}
+	return entry.budgets, entry.checkOnly
+}
+
+// normalizeImageName returns the fully-qualified form of the image name, which is how buildkit refers
+// to exported images.
+func normalizeImageName(imageName string) string {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return imageName
+	}
+	return reference.TagNameOnly(named).String()
+}
+
 // AddArtifactSummary adds an entry of a local target and docker tag, which is used to output a summary text at the end of earthly execution
-func (ec *ExportCoordinator) AddArtifactSummary(target, path, salt string) {
+func (ec *ExportCoordinator) AddArtifactSummary(target, path, salt, changes string) {
 	ec.m.Lock()
 	defer ec.m.Unlock()
 	ec.artifactOutputSummary = append(ec.artifactOutputSummary, ArtifactOutputSummaryEntry{
-		Target: target,
-		Path:   path,
-		Salt:   salt,
+		Target:  target,
+		Path:    path,
+		Salt:    salt,
+		Changes: changes,
 	})
 }
 
@@ -55,6 +55,13 @@ func (gc *GatewayCrafter) AddPushImageEntry(ref gwclient.Reference, refID int, i
 	return refPrefix, nil // TODO once all earthlyoutput-metadata-related code is moved into saveimageutil, change to "return err" only
 }
 
+// AddImageAnnotations adds the annotations to the manifest of the image entry at refPrefix
+func (gc *GatewayCrafter) AddImageAnnotations(refPrefix string, annotations map[string]string) {
+	for k, v := range annotations {
+		gc.AddMeta(fmt.Sprintf("%s/annotation.%s", refPrefix, k), []byte(v))
+	}
+}
+
 // AddSaveArtifactLocal adds ref and metadata required to trigger an artifact export to the local host
 func (gc *GatewayCrafter) AddSaveArtifactLocal(ref gwclient.Reference, refID int, artifact, srcPath, destPath string) (string, error) {
 	refKey := fmt.Sprintf("dir-%d", refID)
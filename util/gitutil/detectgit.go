@@ -114,6 +114,15 @@ func Metadata(ctx context.Context, dir string) (*GitMetadata, error) {
 	}, retErr
 }
 
+// BaseDir returns the root dir of the git repository which contains dir.
+func BaseDir(ctx context.Context, dir string) (string, error) {
+	err := detectGitBinary(ctx)
+	if err != nil {
+		return "", err
+	}
+	return detectGitBaseDir(ctx, dir)
+}
+
 // Clone returns a copy of the GitMetadata object.
 func (gm *GitMetadata) Clone() *GitMetadata {
 	return &GitMetadata{
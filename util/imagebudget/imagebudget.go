@@ -0,0 +1,285 @@
+package imagebudget
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/dustin/go-humanize"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// maxJSONBlobSize is the size above which blobs of the image tarball are not considered to be manifests or configs.
+const maxJSONBlobSize = 4 << 20
+
+// LayerSource is the Earthfile command which created one or more layers of an image.
+type LayerSource struct {
+	Command        string // e.g. RUN go build ./...
+	SourceLocation string // e.g. ./app/Earthfile:12
+	// Base is set for the FROM command of a base image, which created all the layers below it.
+	Base bool
+}
+
+func (ls LayerSource) String() string {
+	if ls.SourceLocation == "" {
+		return ls.Command
+	}
+	return fmt.Sprintf("%s (%s)", ls.Command, ls.SourceLocation)
+}
+
+// Budget is the maximum size and number of layers of an image, as set via SAVE IMAGE --max-size and --max-layers.
+type Budget struct {
+	DockerTag string
+	Platform  string
+	MaxSize   uint64 // in bytes, uncompressed; 0 if unlimited
+	MaxLayers int    // 0 if unlimited
+	WarnOnly  bool
+	// Sources are the commands which created the layers of the image, from the bottom to the top.
+	Sources []LayerSource
+}
+
+// Enabled returns whether the budget sets any limit.
+func (b Budget) Enabled() bool {
+	return b.MaxSize > 0 || b.MaxLayers > 0
+}
+
+// ParseSize parses a human-readable size such as 500MB or 1.5GiB.
+func ParseSize(s string) (uint64, error) {
+	size, err := humanize.ParseBytes(s)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parse size %s", s)
+	}
+	return size, nil
+}
+
+// Layer is a layer of an image.
+type Layer struct {
+	Digest         digest.Digest
+	Size           uint64 // uncompressed
+	CompressedSize uint64
+	Source         string
+}
+
+// Report holds the layers of an image, checked against its budget.
+type Report struct {
+	Budget     Budget
+	Layers     []Layer // from the bottom to the top
+	Size       uint64
+	Violations []string
+	// LayerSizesUnknown is set when only the size of the whole image is known.
+	LayerSizesUnknown bool
+}
+
+// Check reads an image tarball, as produced by buildkit's docker and oci exporters, and checks the image it
+// contains against the budget.
+func Check(r io.Reader, budget Budget) (*Report, error) {
+	reports, err := CheckAll(r, []Budget{budget})
+	if err != nil {
+		return nil, err
+	}
+	return reports[0], nil
+}
+
+// CheckAll reads an image tarball and checks the image it contains against each of the budgets. If the tarball
+// contains a manifest list, each budget is checked against the manifest of its platform.
+func CheckAll(r io.Reader, budgets []Budget) ([]*Report, error) {
+	var index ocispec.Index
+	var hasIndex bool
+	jsonBlobs := make(map[digest.Digest][]byte)
+	sizes := make(map[digest.Digest]uint64)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read image tar")
+		}
+		name := path.Clean(hdr.Name)
+		switch {
+		case name == "index.json":
+			err = json.NewDecoder(tr).Decode(&index)
+			if err != nil {
+				return nil, errors.Wrap(err, "decode index.json")
+			}
+			hasIndex = true
+		case hdr.Typeflag == tar.TypeReg && strings.HasPrefix(name, "blobs/"):
+			parts := strings.Split(name, "/")
+			if len(parts) != 3 {
+				continue
+			}
+			dgst := digest.NewDigestFromEncoded(digest.Algorithm(parts[1]), parts[2])
+			if hdr.Size <= maxJSONBlobSize {
+				dt, err := io.ReadAll(tr)
+				if err != nil {
+					return nil, errors.Wrapf(err, "read blob %s", dgst)
+				}
+				jsonBlobs[dgst] = dt
+				sizes[dgst], err = uncompressedSize(bytes.NewReader(dt), uint64(len(dt)))
+				if err != nil {
+					return nil, errors.Wrapf(err, "read blob %s", dgst)
+				}
+				continue
+			}
+			sizes[dgst], err = uncompressedSize(tr, uint64(hdr.Size))
+			if err != nil {
+				return nil, errors.Wrapf(err, "read blob %s", dgst)
+			}
+		}
+	}
+	if !hasIndex || len(index.Manifests) == 0 {
+		return nil, errors.New("image tar does not contain an index.json")
+	}
+
+	reports := make([]*Report, 0, len(budgets))
+	for _, budget := range budgets {
+		manifest, err := findManifest(jsonBlobs, index.Manifests[0].Digest, budget.Platform)
+		if err != nil {
+			return nil, err
+		}
+		report := &Report{Budget: budget}
+		sources := attribute(len(manifest.Layers), budget.Sources)
+		for i, l := range manifest.Layers {
+			size, ok := sizes[l.Digest]
+			if !ok {
+				size = uint64(l.Size)
+			}
+			report.Layers = append(report.Layers, Layer{
+				Digest:         l.Digest,
+				Size:           size,
+				CompressedSize: uint64(l.Size),
+				Source:         sources[i],
+			})
+			report.Size += size
+		}
+		report.checkLimits()
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// CheckLayers checks an image which is not available as a tarball, such as one loaded into the container
+// frontend, against the budget, given its uncompressed size and the digests of its layers. The size of each
+// layer is not known.
+func CheckLayers(budget Budget, size uint64, layers []digest.Digest) *Report {
+	report := &Report{Budget: budget, Size: size, LayerSizesUnknown: true}
+	sources := attribute(len(layers), budget.Sources)
+	for i, l := range layers {
+		report.Layers = append(report.Layers, Layer{
+			Digest: l,
+			Source: sources[i],
+		})
+	}
+	report.checkLimits()
+	return report
+}
+
+func (r *Report) checkLimits() {
+	if r.Budget.MaxSize > 0 && r.Size > r.Budget.MaxSize {
+		r.Violations = append(r.Violations, fmt.Sprintf("size %s exceeds --max-size=%s", humanize.Bytes(r.Size), humanize.Bytes(r.Budget.MaxSize)))
+	}
+	if r.Budget.MaxLayers > 0 && len(r.Layers) > r.Budget.MaxLayers {
+		r.Violations = append(r.Violations, fmt.Sprintf("%d layers exceed --max-layers=%d", len(r.Layers), r.Budget.MaxLayers))
+	}
+}
+
+// findManifest decodes the manifest dgst. If it is a manifest list, the manifest of the platform is returned.
+func findManifest(jsonBlobs map[digest.Digest][]byte, dgst digest.Digest, platform string) (*ocispec.Manifest, error) {
+	var manifest struct {
+		ocispec.Manifest
+		Manifests []ocispec.Descriptor `json:"manifests,omitempty"`
+	}
+	err := json.Unmarshal(jsonBlobs[dgst], &manifest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decode manifest %s", dgst)
+	}
+	if len(manifest.Manifests) == 0 {
+		return &manifest.Manifest, nil
+	}
+	if platform == "" {
+		return nil, errors.Errorf("manifest list %s requires a platform", dgst)
+	}
+	p, err := platforms.Parse(platform)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse platform %s", platform)
+	}
+	matcher := platforms.OnlyStrict(p)
+	for _, desc := range manifest.Manifests {
+		if desc.Platform != nil && matcher.Match(*desc.Platform) {
+			return findManifest(jsonBlobs, desc.Digest, "")
+		}
+	}
+	return nil, errors.Errorf("manifest list %s has no manifest for platform %s", dgst, platform)
+}
+
+// uncompressedSize returns the uncompressed size of a blob, which is its own size unless it is gzip-compressed.
+func uncompressedSize(r io.Reader, size uint64) (uint64, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	if len(magic) != 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		_, err := io.Copy(io.Discard, br)
+		return size, err
+	}
+	gr, err := gzip.NewReader(br)
+	if err != nil {
+		return 0, err
+	}
+	defer gr.Close()
+	n, err := io.Copy(io.Discard, gr)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(n), nil
+}
+
+// attribute returns the source of each of the n layers of an image, from the bottom to the top. The sources
+// are matched to the layers from the top; the layers below the topmost base source are attributed to it.
+func attribute(n int, sources []LayerSource) []string {
+	ret := make([]string, n)
+	j := len(sources) - 1
+	for i := n - 1; i >= 0; i-- {
+		switch {
+		case j < 0:
+			ret[i] = "base image"
+		case sources[j].Base:
+			ret[i] = sources[j].String()
+		default:
+			ret[i] = sources[j].String()
+			j--
+		}
+	}
+	return ret
+}
+
+// Exceeded returns whether the image exceeds its budget.
+func (r *Report) Exceeded() bool {
+	return len(r.Violations) > 0
+}
+
+// String returns the violations of the budget, followed by the per-layer size breakdown of the image.
+func (r *Report) String() string {
+	var sb strings.Builder
+	name := r.Budget.DockerTag
+	if r.Budget.Platform != "" {
+		name = fmt.Sprintf("%s (%s)", name, r.Budget.Platform)
+	}
+	fmt.Fprintf(&sb, "image %s exceeds its budget: %s\n", name, strings.Join(r.Violations, ", "))
+	for i, l := range r.Layers {
+		if r.LayerSizesUnknown {
+			fmt.Fprintf(&sb, "  layer %d: %s\n", i+1, l.Source)
+			continue
+		}
+		fmt.Fprintf(&sb, "  layer %d: %s (%s compressed) %s\n", i+1, humanize.Bytes(l.Size), humanize.Bytes(l.CompressedSize), l.Source)
+	}
+	return sb.String()
+}
@@ -0,0 +1,154 @@
+package imagebudget
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	. "github.com/stretchr/testify/assert"
+)
+
+type imageTarWriter struct {
+	t  *testing.T
+	tw *tar.Writer
+}
+
+func (w *imageTarWriter) writeFile(name string, dt []byte) {
+	NoError(w.t, w.tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Size: int64(len(dt)), Mode: 0644}))
+	_, err := w.tw.Write(dt)
+	NoError(w.t, err)
+}
+
+func (w *imageTarWriter) writeJSON(v interface{}) ocispec.Descriptor {
+	dt, err := json.Marshal(v)
+	NoError(w.t, err)
+	dgst := digest.FromBytes(dt)
+	w.writeFile("blobs/sha256/"+dgst.Encoded(), dt)
+	return ocispec.Descriptor{Digest: dgst, Size: int64(len(dt))}
+}
+
+func (w *imageTarWriter) writeManifest(layers ...[]byte) ocispec.Descriptor {
+	var manifest ocispec.Manifest
+	for _, l := range layers {
+		var gz bytes.Buffer
+		gw := gzip.NewWriter(&gz)
+		_, err := gw.Write(l)
+		NoError(w.t, err)
+		NoError(w.t, gw.Close())
+		dgst := digest.FromBytes(gz.Bytes())
+		w.writeFile("blobs/sha256/"+dgst.Encoded(), gz.Bytes())
+		manifest.Layers = append(manifest.Layers, ocispec.Descriptor{Digest: dgst, Size: int64(gz.Len())})
+	}
+	return w.writeJSON(manifest)
+}
+
+func (w *imageTarWriter) close(desc ocispec.Descriptor) {
+	dt, err := json.Marshal(ocispec.Index{Manifests: []ocispec.Descriptor{desc}})
+	NoError(w.t, err)
+	w.writeFile("index.json", dt)
+	NoError(w.t, w.tw.Close())
+}
+
+func writeImageTar(t *testing.T, layers ...[]byte) *bytes.Buffer {
+	var buf bytes.Buffer
+	w := &imageTarWriter{t: t, tw: tar.NewWriter(&buf)}
+	w.close(w.writeManifest(layers...))
+	return &buf
+}
+
+func TestCheck(t *testing.T) {
+	budget := Budget{
+		DockerTag: "my-image:latest",
+		MaxSize:   1500,
+		MaxLayers: 2,
+		Sources: []LayerSource{
+			{Command: "FROM alpine", SourceLocation: "Earthfile:2", Base: true},
+			{Command: "RUN make", SourceLocation: "Earthfile:3"},
+		},
+	}
+	report, err := Check(writeImageTar(t, make([]byte, 500), make([]byte, 400), make([]byte, 1000)), budget)
+	if !NoError(t, err) {
+		return
+	}
+	if !Len(t, report.Layers, 3) {
+		return
+	}
+	Equal(t, uint64(1900), report.Size)
+	Equal(t, uint64(1000), report.Layers[2].Size)
+	Less(t, report.Layers[2].CompressedSize, uint64(1000))
+	Equal(t, "RUN make (Earthfile:3)", report.Layers[2].Source)
+	Equal(t, "FROM alpine (Earthfile:2)", report.Layers[0].Source)
+	True(t, report.Exceeded())
+	Len(t, report.Violations, 2)
+	Contains(t, report.String(), "layer 3: 1.0 kB")
+
+	budget.MaxSize = 2000
+	budget.MaxLayers = 0
+	report, err = Check(writeImageTar(t, make([]byte, 500), make([]byte, 400), make([]byte, 1000)), budget)
+	if !NoError(t, err) {
+		return
+	}
+	False(t, report.Exceeded())
+}
+
+func TestCheckAllManifestList(t *testing.T) {
+	var buf bytes.Buffer
+	w := &imageTarWriter{t: t, tw: tar.NewWriter(&buf)}
+	amd64 := w.writeManifest(make([]byte, 500))
+	amd64.Platform = &ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := w.writeManifest(make([]byte, 500), make([]byte, 400))
+	arm64.Platform = &ocispec.Platform{OS: "linux", Architecture: "arm64"}
+	w.close(w.writeJSON(ocispec.Index{Manifests: []ocispec.Descriptor{amd64, arm64}}))
+
+	reports, err := CheckAll(&buf, []Budget{
+		{DockerTag: "my-image:latest", Platform: "linux/amd64", MaxLayers: 1},
+		{DockerTag: "my-image:latest", Platform: "linux/arm64", MaxLayers: 1},
+	})
+	if !NoError(t, err) {
+		return
+	}
+	if !Len(t, reports, 2) {
+		return
+	}
+	False(t, reports[0].Exceeded())
+	True(t, reports[1].Exceeded())
+	Contains(t, reports[1].String(), "image my-image:latest (linux/arm64) exceeds its budget")
+}
+
+func TestCheckLayers(t *testing.T) {
+	budget := Budget{
+		DockerTag: "my-image:latest",
+		MaxSize:   1500,
+		Sources:   []LayerSource{{Command: "RUN make", SourceLocation: "Earthfile:3"}},
+	}
+	report := CheckLayers(budget, 2000, []digest.Digest{digest.FromString("a"), digest.FromString("b")})
+	True(t, report.Exceeded())
+	Equal(t, "base image", report.Layers[0].Source)
+	Contains(t, report.String(), "size 2.0 kB exceeds --max-size=1.5 kB")
+	Contains(t, report.String(), "layer 2: RUN make (Earthfile:3)\n")
+
+	budget.MaxSize = 0
+	budget.MaxLayers = 2
+	False(t, CheckLayers(budget, 2000, []digest.Digest{digest.FromString("a"), digest.FromString("b")}).Exceeded())
+}
+
+func TestAttribute(t *testing.T) {
+	sources := []LayerSource{{Command: "RUN a"}, {Command: "RUN b"}}
+	Equal(t, []string{"base image", "RUN a", "RUN b"}, attribute(3, sources))
+	Equal(t, []string{"RUN b"}, attribute(1, sources))
+}
+
+func TestParseSize(t *testing.T) {
+	size, err := ParseSize("500MB")
+	NoError(t, err)
+	Equal(t, uint64(500000000), size)
+	size, err = ParseSize("1GiB")
+	NoError(t, err)
+	Equal(t, uint64(1<<30), size)
+	_, err = ParseSize("big")
+	Error(t, err)
+}
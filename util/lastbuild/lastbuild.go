@@ -0,0 +1,290 @@
+// Package lastbuild keeps track of the target invocations of a build, along
+// with their results, such that failed invocations can be re-run later.
+package lastbuild
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/earthly/earthly/domain"
+	"github.com/earthly/earthly/states/dedup"
+	"github.com/earthly/earthly/util/fileutil"
+	"github.com/earthly/earthly/util/platutil"
+	"github.com/earthly/earthly/variables"
+	"github.com/earthly/earthly/variables/reserved"
+
+	"github.com/pkg/errors"
+)
+
+// Status is the result of a target invocation.
+type Status string
+
+const (
+	// StatusPending is the status of an invocation which has not completed (yet).
+	StatusPending Status = "pending"
+	// StatusSucceeded is the status of an invocation which has completed successfully.
+	StatusSucceeded Status = "succeeded"
+	// StatusFailed is the status of an invocation which has failed.
+	StatusFailed Status = "failed"
+	// StatusCanceled is the status of an invocation which did not complete, as the build was canceled.
+	StatusCanceled Status = "canceled"
+)
+
+// Invocation is a target invocation of a build, either the target given on the command line (the root),
+// or a target referenced via BUILD.
+type Invocation struct {
+	TargetInput dedup.TargetInput `json:"targetInput"`
+	Root        bool              `json:"root,omitempty"`
+	Status      Status            `json:"status"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// Args returns the build args to pass on the command line to re-run the invocation.
+func (inv Invocation) Args() []string {
+	var args []string
+	for _, bai := range inv.TargetInput.BuildArgs {
+		if reserved.IsBuiltIn(bai.Name) || bai.IsDefaultValue() {
+			continue
+		}
+		args = append(args, fmt.Sprintf("%s=%s", bai.Name, bai.ConstantValue))
+	}
+	return args
+}
+
+// State is the persisted state of a build.
+type State struct {
+	WorkingDir  string       `json:"workingDir"`
+	FinishedAt  time.Time    `json:"finishedAt"`
+	Invocations []Invocation `json:"invocations"`
+}
+
+// ToRerun returns the invocations which need to be re-run in order to redo the failed work. If any BUILD
+// invocation has failed, these are the failed or canceled BUILD invocations. Otherwise, the failure is
+// attributed to the root, which is re-run along with all of its BUILD invocations.
+func (s *State) ToRerun() []Invocation {
+	var ret []Invocation
+	var root *Invocation
+	anyFailed := false
+	for i, inv := range s.Invocations {
+		if inv.Status != StatusFailed && inv.Status != StatusCanceled {
+			continue
+		}
+		if inv.Root {
+			root = &s.Invocations[i]
+			continue
+		}
+		anyFailed = anyFailed || inv.Status == StatusFailed
+		ret = append(ret, inv)
+	}
+	if !anyFailed && root != nil {
+		return []Invocation{*root}
+	}
+	return ret
+}
+
+// Load reads the state from the given path.
+func Load(path string) (*State, error) {
+	dt, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", path)
+	}
+	var s State
+	err = json.Unmarshal(dt, &s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", path)
+	}
+	return &s, nil
+}
+
+// Save writes the state to the given path.
+func Save(path string, s *State) error {
+	dt, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "serialize build state")
+	}
+	return fileutil.WriteFileAtomic(path, dt)
+}
+
+// Recorder records the target invocations of a build in a concurrent-safe way.
+// A nil *Recorder is valid and records nothing.
+type Recorder struct {
+	mu          sync.Mutex
+	invocations []*Invocation
+	byHash      map[string]*Invocation
+	byTargetID  map[string][]*Invocation
+}
+
+// NewRecorder returns a new Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		byHash:     make(map[string]*Invocation),
+		byTargetID: make(map[string][]*Invocation),
+	}
+}
+
+// Start records a new pending invocation and returns its target input, which is used to identify it
+// when calling Finish.
+func (r *Recorder) Start(target domain.Target, platr *platutil.Resolver, allowPrivileged bool, overridingVars *variables.Scope, root bool) dedup.TargetInput {
+	ti := dedup.TargetInput{
+		TargetCanonical: target.StringCanonical(),
+		Platform:        platr.Materialize(platr.Current()).String(),
+		AllowPrivileged: allowPrivileged,
+	}
+	if overridingVars != nil {
+		for _, key := range overridingVars.SortedAny() {
+			value, _ := overridingVars.GetAny(key)
+			ti = ti.WithBuildArgInput(dedup.BuildArgInput{ConstantValue: value, Name: key})
+		}
+	}
+	if r == nil {
+		return ti
+	}
+	hash, err := ti.Hash()
+	if err != nil {
+		return ti
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if inv, ok := r.byHash[hash]; ok {
+		inv.Root = inv.Root || root
+		return ti
+	}
+	inv := &Invocation{
+		TargetInput: ti,
+		Root:        root,
+		Status:      StatusPending,
+	}
+	r.byHash[hash] = inv
+	r.invocations = append(r.invocations, inv)
+	return ti
+}
+
+// AddTarget records that the target with the given ID (as in the vertex metadata) is built as part of the
+// invocation ti, such that the failures of its vertices during the solve are attributed to the invocation.
+func (r *Recorder) AddTarget(ti dedup.TargetInput, targetID string) {
+	if r == nil {
+		return
+	}
+	hash, err := ti.Hash()
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	inv, ok := r.byHash[hash]
+	if !ok {
+		return
+	}
+	for _, existing := range r.byTargetID[targetID] {
+		if existing == inv {
+			return
+		}
+	}
+	r.byTargetID[targetID] = append(r.byTargetID[targetID], inv)
+}
+
+// FailTarget records the failure of a vertex of the target with the given ID during the solve. The
+// invocations which the target is built as part of are marked as failed.
+func (r *Recorder) FailTarget(targetID string, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, inv := range r.byTargetID[targetID] {
+		if inv.Status == StatusFailed {
+			continue
+		}
+		inv.setResult(err)
+	}
+}
+
+// Finish records the result of an invocation. A failure is never overwritten by a later success,
+// as the same invocation may be reported by multiple stages of the build. The invocations of BUILD
+// targets are only finished by this if their conversion fails; otherwise, they remain pending until
+// the solve either fails one of their targets (see FailTarget) or completes (see FinishRoot).
+func (r *Recorder) Finish(ti dedup.TargetInput, err error) {
+	if r == nil {
+		return
+	}
+	hash, hashErr := ti.Hash()
+	if hashErr != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	inv, ok := r.byHash[hash]
+	if !ok || inv.Status == StatusFailed {
+		return
+	}
+	inv.setResult(err)
+}
+
+// FinishRoot records the result of an entire build. Any pending root invocation takes the result of
+// the build. If the build has succeeded, then the other pending invocations are marked as successful;
+// otherwise, they are marked as canceled.
+func (r *Recorder) FinishRoot(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, inv := range r.invocations {
+		if inv.Status != StatusPending {
+			continue
+		}
+		switch {
+		case inv.Root:
+			inv.setResult(err)
+		case err == nil:
+			inv.setResult(nil)
+		default:
+			inv.Status = StatusCanceled
+		}
+	}
+}
+
+// Len returns the number of recorded invocations.
+func (r *Recorder) Len() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.invocations)
+}
+
+// State returns the state of the build so far.
+func (r *Recorder) State(workingDir string) *State {
+	s := &State{
+		WorkingDir: workingDir,
+		FinishedAt: time.Now().UTC(),
+	}
+	if r == nil {
+		return s
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, inv := range r.invocations {
+		s.Invocations = append(s.Invocations, *inv)
+	}
+	return s
+}
+
+func (inv *Invocation) setResult(err error) {
+	switch {
+	case err == nil:
+		inv.Status = StatusSucceeded
+		inv.Error = ""
+	case errors.Is(err, context.Canceled):
+		inv.Status = StatusCanceled
+		inv.Error = ""
+	default:
+		inv.Status = StatusFailed
+		inv.Error = err.Error()
+	}
+}
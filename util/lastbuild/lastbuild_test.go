@@ -0,0 +1,133 @@
+package lastbuild
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/earthly/earthly/domain"
+	"github.com/earthly/earthly/util/platutil"
+	"github.com/earthly/earthly/variables"
+
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	. "github.com/stretchr/testify/assert"
+)
+
+func mustParseTarget(t *testing.T, s string) domain.Target {
+	target, err := domain.ParseTarget(s)
+	NoError(t, err)
+	return target
+}
+
+func TestRecorder(t *testing.T) {
+	platr := platutil.NewResolver(specs.Platform{OS: "linux", Architecture: "amd64"})
+	vars := variables.NewScope()
+	vars.AddInactive("FOO", "bar")
+
+	r := NewRecorder()
+	root := r.Start(mustParseTarget(t, "./+all"), platr, false, nil, true)
+	a := r.Start(mustParseTarget(t, "./a+test"), platr, false, vars, false)
+	b := r.Start(mustParseTarget(t, "./b+test"), platr, false, nil, false)
+	r.Start(mustParseTarget(t, "./c+test"), platr, false, nil, false)
+	Equal(t, 4, r.Len())
+
+	r.Finish(a, errors.New("exit code 1"))
+	r.Finish(a, nil) // a failure is never overwritten
+	r.Finish(b, nil)
+	r.FinishRoot(errors.Wrap(context.Canceled, "build"))
+
+	s := r.State("/work")
+	Equal(t, "/work", s.WorkingDir)
+	statuses := map[string]Status{}
+	for _, inv := range s.Invocations {
+		statuses[inv.TargetInput.TargetCanonical] = inv.Status
+	}
+	Equal(t, StatusCanceled, statuses[root.TargetCanonical])
+	Equal(t, StatusFailed, statuses[a.TargetCanonical])
+	Equal(t, StatusSucceeded, statuses[b.TargetCanonical])
+	Equal(t, StatusCanceled, statuses["./c+test"])
+
+	var rerun []string
+	for _, inv := range s.ToRerun() {
+		rerun = append(rerun, inv.TargetInput.TargetCanonical)
+		Equal(t, "linux/amd64", inv.TargetInput.Platform)
+	}
+	Equal(t, []string{"./a+test", "./c+test"}, rerun)
+	Equal(t, []string{"FOO=bar"}, s.Invocations[1].Args())
+}
+
+func TestRecorderSolveFailure(t *testing.T) {
+	platr := platutil.NewResolver(specs.Platform{OS: "linux", Architecture: "amd64"})
+	statuses := func(r *Recorder) map[string]Status {
+		ret := map[string]Status{}
+		for _, inv := range r.State("/work").Invocations {
+			ret[inv.TargetInput.TargetCanonical] = inv.Status
+		}
+		return ret
+	}
+	rerun := func(r *Recorder) []string {
+		var ret []string
+		for _, inv := range r.State("/work").ToRerun() {
+			ret = append(ret, inv.TargetInput.TargetCanonical)
+		}
+		return ret
+	}
+
+	// The BUILD targets have been converted successfully; a RUN of +fail (or of its FROM +base) fails
+	// during the solve.
+	r := NewRecorder()
+	root := r.Start(mustParseTarget(t, "+all"), platr, false, nil, true)
+	ok := r.Start(mustParseTarget(t, "+ok"), platr, false, nil, false)
+	fail := r.Start(mustParseTarget(t, "+fail"), platr, false, nil, false)
+	r.AddTarget(root, "all-id")
+	r.AddTarget(ok, "ok-id")
+	r.AddTarget(fail, "fail-id")
+	r.AddTarget(fail, "base-id")
+	r.FailTarget("base-id", errors.New("exit code 1"))
+	r.FinishRoot(errors.New("build failed"))
+	Equal(t, map[string]Status{"+all": StatusFailed, "+ok": StatusCanceled, "+fail": StatusFailed}, statuses(r))
+	Equal(t, []string{"+ok", "+fail"}, rerun(r))
+
+	// A RUN of the root target itself fails.
+	r = NewRecorder()
+	root = r.Start(mustParseTarget(t, "+all"), platr, false, nil, true)
+	ok = r.Start(mustParseTarget(t, "+ok"), platr, false, nil, false)
+	r.AddTarget(root, "all-id")
+	r.AddTarget(ok, "ok-id")
+	r.FailTarget("all-id", errors.New("exit code 1"))
+	r.FinishRoot(errors.New("build failed"))
+	Equal(t, map[string]Status{"+all": StatusFailed, "+ok": StatusCanceled}, statuses(r))
+	Equal(t, []string{"+all"}, rerun(r))
+}
+
+func TestToRerunRoot(t *testing.T) {
+	s := &State{
+		Invocations: []Invocation{
+			{Root: true, Status: StatusFailed},
+			{Status: StatusSucceeded},
+		},
+	}
+	rerun := s.ToRerun()
+	Equal(t, 1, len(rerun))
+	True(t, rerun[0].Root)
+
+	s.Invocations[0].Status = StatusSucceeded
+	Empty(t, s.ToRerun())
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last-build.json")
+	r := NewRecorder()
+	ti := r.Start(mustParseTarget(t, "+build"), platutil.NewResolver(specs.Platform{OS: "linux", Architecture: "arm64"}), true, nil, true)
+	r.FinishRoot(errors.New("boom"))
+	NoError(t, Save(path, r.State("/work")))
+
+	s, err := Load(path)
+	NoError(t, err)
+	Equal(t, 1, len(s.Invocations))
+	Equal(t, ti.TargetCanonical, s.Invocations[0].TargetInput.TargetCanonical)
+	True(t, s.Invocations[0].TargetInput.AllowPrivileged)
+	Equal(t, StatusFailed, s.Invocations[0].Status)
+	Equal(t, "boom", s.Invocations[0].Error)
+}
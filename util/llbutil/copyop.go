@@ -15,8 +15,9 @@ import (
 	"github.com/pkg/errors"
 )
 
-// CopyOp is a simplified llb copy operation.
-func CopyOp(srcState pllb.State, srcs []string, destState pllb.State, dest string, allowWildcard bool, isDir bool, keepTs bool, chown string, chmod *fs.FileMode, ifExists, symlinkNoFollow, merge bool, opts ...llb.ConstraintsOpt) pllb.State {
+// CopyOp is a simplified llb copy operation. If createdTime is set, it is used as the timestamp of all the
+// copied files, regardless of keepTs.
+func CopyOp(srcState pllb.State, srcs []string, destState pllb.State, dest string, allowWildcard bool, isDir bool, keepTs bool, createdTime *time.Time, chown string, chmod *fs.FileMode, ifExists, symlinkNoFollow, merge bool, opts ...llb.ConstraintsOpt) pllb.State {
 	destAdjusted := dest
 	if dest == "." || dest == "" || len(srcs) > 1 {
 		destAdjusted += string("/") // TODO: needs to be the containers platform, not the earthly hosts platform. For now, this is always Linux.
@@ -26,7 +27,9 @@ func CopyOp(srcState pllb.State, srcs []string, destState pllb.State, dest strin
 		baseCopyOpts = append(baseCopyOpts, llb.WithUser(chown))
 	}
 	var fa *pllb.FileAction
-	if !keepTs {
+	if createdTime != nil {
+		baseCopyOpts = append(baseCopyOpts, llb.WithCreatedTime(*createdTime))
+	} else if !keepTs {
 		baseCopyOpts = append(baseCopyOpts, llb.WithCreatedTime(*defaultTs()))
 	}
 	for _, src := range srcs {
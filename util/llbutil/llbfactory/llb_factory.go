@@ -1,6 +1,8 @@
 package llbfactory
 
 import (
+	"encoding/json"
+
 	"github.com/earthly/earthly/util/llbutil/pllb"
 
 	"github.com/moby/buildkit/client/llb"
@@ -72,6 +74,21 @@ func (f *LocalFactory) GetSharedKey() string {
 	return f.sharedKeyHint
 }
 
+// GetExcludePatterns returns the exclude patterns of the pllb.Local state that will
+// eventually be created
+func (f *LocalFactory) GetExcludePatterns() []string {
+	li := &llb.LocalInfo{}
+	for _, o := range f.opts {
+		o.SetLocalOption(li)
+	}
+	if li.ExcludePatterns == "" {
+		return nil
+	}
+	var patterns []string
+	_ = json.Unmarshal([]byte(li.ExcludePatterns), &patterns) // empty on error
+	return patterns
+}
+
 // WithInclude adds include patterns to the factory's llb options
 func (f *LocalFactory) WithInclude(patterns []string) *LocalFactory {
 	f = f.Copy()
@@ -0,0 +1,198 @@
+package llbutil
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// Remote cache types.
+const (
+	RemoteCacheRegistry = "registry"
+	RemoteCacheLocal    = "local"
+	RemoteCacheS3       = "s3"
+)
+
+// defaultS3Region is the region used for S3-compatible stores which do not require one, such as MinIO.
+const defaultS3Region = "us-east-1"
+
+// remoteCacheKeys are the keys accepted in the spec of each remote cache type.
+var remoteCacheKeys = map[string]map[string]bool{
+	RemoteCacheRegistry: {"ref": true},
+	RemoteCacheLocal:    {"dest": true, "src": true, "digest": true},
+	RemoteCacheS3: {
+		"bucket": true, "region": true, "endpoint": true, "prefix": true, "name": true, "use_path_style": true,
+		"access_key_id": true, "secret_access_key": true,
+	},
+}
+
+// RemoteCache is a remote cache, as specified via --remote-cache, --cache-from or SAVE IMAGE --cache-from.
+// Its spec is either a registry image ref, or a comma-separated list of key=value pairs, such as
+// type=local,dest=/mnt/cache or type=s3,bucket=cache,endpoint=http://minio:9000.
+type RemoteCache struct {
+	Type  string
+	Attrs map[string]string
+}
+
+// ParseRemoteCache parses the spec of a remote cache.
+func ParseRemoteCache(spec string) (RemoteCache, error) {
+	if !strings.Contains(spec, "=") {
+		// Image refs never contain '='.
+		return RemoteCache{Type: RemoteCacheRegistry, Attrs: map[string]string{"ref": spec}}, nil
+	}
+	rc := RemoteCache{Attrs: make(map[string]string)}
+	for _, kv := range strings.Split(spec, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return RemoteCache{}, errors.Errorf("invalid remote cache %s: expected key=value, got %s", spec, kv)
+		}
+		if parts[0] == "type" {
+			rc.Type = parts[1]
+			continue
+		}
+		rc.Attrs[parts[0]] = parts[1]
+	}
+	keys, ok := remoteCacheKeys[rc.Type]
+	if !ok {
+		return RemoteCache{}, errors.Errorf("invalid remote cache %s: type must be one of registry, local or s3", spec)
+	}
+	for k := range rc.Attrs {
+		if !keys[k] {
+			return RemoteCache{}, errors.Errorf("invalid remote cache %s: unknown key %s for type %s", spec, k, rc.Type)
+		}
+	}
+	switch rc.Type {
+	case RemoteCacheRegistry:
+		if rc.Attrs["ref"] == "" {
+			return RemoteCache{}, errors.Errorf("invalid remote cache %s: ref is required", spec)
+		}
+	case RemoteCacheLocal:
+		if rc.Dir() == "" {
+			return RemoteCache{}, errors.Errorf("invalid remote cache %s: dest is required", spec)
+		}
+	case RemoteCacheS3:
+		if rc.Attrs["bucket"] == "" {
+			return RemoteCache{}, errors.Errorf("invalid remote cache %s: bucket is required", spec)
+		}
+	}
+	return rc, nil
+}
+
+// String returns the spec of the remote cache.
+func (rc RemoteCache) String() string {
+	if rc.Type == RemoteCacheRegistry {
+		return rc.Attrs["ref"]
+	}
+	keys := make([]string, 0, len(rc.Attrs))
+	for k := range rc.Attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{"type=" + rc.Type}
+	for _, k := range keys {
+		parts = append(parts, k+"="+rc.Attrs[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// Dir returns the directory of a local remote cache.
+func (rc RemoteCache) Dir() string {
+	if dir := rc.Attrs["dest"]; dir != "" {
+		return dir
+	}
+	return rc.Attrs["src"]
+}
+
+// WithLocalDigest returns a local remote cache which imports the latest cache exported to its directory.
+// Buildkit requires the digest of local cache imports to be resolved on the client. It returns false if
+// no cache has been exported to the directory yet.
+func (rc RemoteCache) WithLocalDigest() (RemoteCache, bool, error) {
+	if rc.Type != RemoteCacheLocal || rc.Attrs["digest"] != "" {
+		return rc, true, nil
+	}
+	dt, err := os.ReadFile(filepath.Join(rc.Dir(), "index.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return rc, false, nil
+		}
+		return RemoteCache{}, false, errors.Wrapf(err, "read local cache index in %s", rc.Dir())
+	}
+	var idx ocispec.Index
+	err = json.Unmarshal(dt, &idx)
+	if err != nil {
+		return RemoteCache{}, false, errors.Wrapf(err, "parse local cache index in %s", rc.Dir())
+	}
+	for _, m := range idx.Manifests {
+		if m.Annotations[ocispec.AnnotationRefName] == "latest" {
+			ret := RemoteCache{Type: rc.Type, Attrs: map[string]string{"digest": m.Digest.String()}}
+			for k, v := range rc.Attrs {
+				ret.Attrs[k] = v
+			}
+			return ret, true, nil
+		}
+	}
+	return rc, false, nil
+}
+
+// ImportAttrs returns the attributes of the buildkit cache importer.
+func (rc RemoteCache) ImportAttrs() map[string]string {
+	switch rc.Type {
+	case RemoteCacheLocal:
+		attrs := map[string]string{"src": rc.Dir()}
+		if rc.Attrs["digest"] != "" {
+			attrs["digest"] = rc.Attrs["digest"]
+		}
+		return attrs
+	case RemoteCacheS3:
+		return rc.s3Attrs()
+	default:
+		return map[string]string{"ref": rc.Attrs["ref"]}
+	}
+}
+
+// ExportAttrs returns the attributes of the buildkit cache exporter. The max mode exports the cache of all
+// the intermediate steps, instead of only the ones of the final image.
+func (rc RemoteCache) ExportAttrs(max bool) map[string]string {
+	var attrs map[string]string
+	switch rc.Type {
+	case RemoteCacheLocal:
+		attrs = map[string]string{"dest": rc.Dir()}
+	case RemoteCacheS3:
+		attrs = rc.s3Attrs()
+	default:
+		attrs = map[string]string{"ref": rc.Attrs["ref"]}
+	}
+	if max {
+		attrs["mode"] = "max"
+	}
+	return attrs
+}
+
+func (rc RemoteCache) s3Attrs() map[string]string {
+	attrs := map[string]string{"region": defaultS3Region}
+	for k, v := range rc.Attrs {
+		switch k {
+		case "endpoint":
+			attrs["endpoint_url"] = v
+			if _, ok := rc.Attrs["use_path_style"]; !ok {
+				// S3-compatible stores, such as MinIO, typically do not support virtual-hosted-style buckets.
+				attrs["use_path_style"] = "true"
+			}
+		default:
+			attrs[k] = v
+		}
+	}
+	// Buildkitd runs in its own container, hence the credentials of the client are passed along.
+	if _, ok := attrs["access_key_id"]; !ok {
+		if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+			attrs["access_key_id"] = id
+			attrs["secret_access_key"] = secret
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,90 @@
+package llbutil
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseRemoteCache(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	var tests = []struct {
+		spec        string
+		typ         string
+		importAttrs map[string]string
+		exportAttrs map[string]string
+	}{
+		{
+			"myregistry.com/cache:latest", RemoteCacheRegistry,
+			map[string]string{"ref": "myregistry.com/cache:latest"},
+			map[string]string{"ref": "myregistry.com/cache:latest", "mode": "max"},
+		},
+		{
+			"type=local,dest=/mnt/cache", RemoteCacheLocal,
+			map[string]string{"src": "/mnt/cache"},
+			map[string]string{"dest": "/mnt/cache", "mode": "max"},
+		},
+		{
+			"type=s3,bucket=cache,endpoint=http://minio:9000", RemoteCacheS3,
+			map[string]string{"bucket": "cache", "region": "us-east-1", "endpoint_url": "http://minio:9000", "use_path_style": "true"},
+			map[string]string{"bucket": "cache", "region": "us-east-1", "endpoint_url": "http://minio:9000", "use_path_style": "true", "mode": "max"},
+		},
+		{
+			"type=s3,bucket=cache,region=eu-west-1,prefix=ci/", RemoteCacheS3,
+			map[string]string{"bucket": "cache", "region": "eu-west-1", "prefix": "ci/"},
+			map[string]string{"bucket": "cache", "region": "eu-west-1", "prefix": "ci/", "mode": "max"},
+		},
+	}
+	for _, tt := range tests {
+		rc, err := ParseRemoteCache(tt.spec)
+		if err != nil {
+			t.Errorf("ParseRemoteCache(%q) failed: %v", tt.spec, err)
+			continue
+		}
+		if rc.Type != tt.typ {
+			t.Errorf("ParseRemoteCache(%q).Type = %q, want %q", tt.spec, rc.Type, tt.typ)
+		}
+		if attrs := rc.ImportAttrs(); !reflect.DeepEqual(attrs, tt.importAttrs) {
+			t.Errorf("ParseRemoteCache(%q).ImportAttrs() = %v, want %v", tt.spec, attrs, tt.importAttrs)
+		}
+		if attrs := rc.ExportAttrs(true); !reflect.DeepEqual(attrs, tt.exportAttrs) {
+			t.Errorf("ParseRemoteCache(%q).ExportAttrs(true) = %v, want %v", tt.spec, attrs, tt.exportAttrs)
+		}
+		rc2, err := ParseRemoteCache(rc.String())
+		if err != nil || !reflect.DeepEqual(rc, rc2) {
+			t.Errorf("ParseRemoteCache(%q) does not round-trip via %q", tt.spec, rc.String())
+		}
+	}
+
+	for _, spec := range []string{"type=gha", "type=local", "type=s3,region=eu-west-1", "type=local,dest=/a,foo=bar", "type=local,dest"} {
+		if _, err := ParseRemoteCache(spec); err == nil {
+			t.Errorf("ParseRemoteCache(%q) should have failed", spec)
+		}
+	}
+}
+
+func TestRemoteCacheWithLocalDigest(t *testing.T) {
+	dir := t.TempDir()
+	rc, err := ParseRemoteCache("type=local,dest=" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := rc.WithLocalDigest(); err != nil || ok {
+		t.Fatalf("WithLocalDigest() of an empty dir = %v, %v, want false, nil", ok, err)
+	}
+	index := `{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.index.v1+json","digest":"sha256:0000000000000000000000000000000000000000000000000000000000000001","size":1,"annotations":{"org.opencontainers.image.ref.name":"latest"}}]}`
+	err = os.WriteFile(filepath.Join(dir, "index.json"), []byte(index), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, ok, err := rc.WithLocalDigest()
+	if err != nil || !ok {
+		t.Fatalf("WithLocalDigest() = %v, %v, want true, nil", ok, err)
+	}
+	want := "sha256:0000000000000000000000000000000000000000000000000000000000000001"
+	if got := rc.ImportAttrs()["digest"]; got != want {
+		t.Errorf("ImportAttrs()[digest] = %q, want %q", got, want)
+	}
+}
@@ -18,9 +18,13 @@ func StateToRef(ctx context.Context, gwClient gwclient.Client, state pllb.State,
 	}
 	var coes []gwclient.CacheOptionsEntry
 	for _, ci := range cacheImports {
+		rc, err := ParseRemoteCache(ci)
+		if err != nil {
+			return nil, err
+		}
 		coe := gwclient.CacheOptionsEntry{
-			Type:  "registry",
-			Attrs: map[string]string{"ref": ci},
+			Type:  rc.Type,
+			Attrs: rc.ImportAttrs(),
 		}
 		coes = append(coes, coe)
 	}
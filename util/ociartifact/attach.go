@@ -0,0 +1,256 @@
+package ociartifact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MediaTypeInToto is the media type of in-toto attestation statements.
+	MediaTypeInToto = "application/vnd.in-toto+json"
+	// AnnotationPredicateType is the layer annotation holding the predicate type of an in-toto statement.
+	AnnotationPredicateType = "in-toto.io/predicate-type"
+	// mediaTypeEmptyJSON is the media type of the empty config of manifests which are not images.
+	mediaTypeEmptyJSON = "application/vnd.oci.empty.v1+json"
+	// inTotoStatementType is the type of in-toto statements.
+	inTotoStatementType = "https://in-toto.io/Statement/v0.1"
+)
+
+// referrerManifest is an image manifest which refers to another manifest, via its subject.
+type referrerManifest struct {
+	specs.Versioned
+	MediaType    string               `json:"mediaType"`
+	ArtifactType string               `json:"artifactType,omitempty"`
+	Config       ocispec.Descriptor   `json:"config"`
+	Layers       []ocispec.Descriptor `json:"layers"`
+	Subject      *ocispec.Descriptor  `json:"subject,omitempty"`
+	Annotations  map[string]string    `json:"annotations,omitempty"`
+}
+
+// InTotoSubject is the subject of an in-toto statement.
+type InTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// InTotoStatement is an in-toto attestation statement.
+type InTotoStatement struct {
+	Type          string          `json:"_type"`
+	PredicateType string          `json:"predicateType"`
+	Subject       []InTotoSubject `json:"subject"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// Attestation is an in-toto predicate to attach to an image.
+type Attestation struct {
+	PredicateType string
+	Predicate     []byte
+	Annotations   map[string]string
+}
+
+// Statement returns the serialized in-toto statement of the predicate about the subjects.
+func Statement(predicateType string, subjects []InTotoSubject, predicate []byte) ([]byte, error) {
+	dt, err := json.Marshal(InTotoStatement{
+		Type:          inTotoStatementType,
+		PredicateType: predicateType,
+		Subject:       subjects,
+		Predicate:     predicate,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal in-toto statement")
+	}
+	return dt, nil
+}
+
+// ResolveImage returns the descriptor of the image ref in the registry. If platform is set and the image
+// is a manifest list, the descriptor of the manifest of that platform is returned.
+func ResolveImage(ctx context.Context, ref string, platform *ocispec.Platform, reg Registry) (ocispec.Descriptor, error) {
+	ref, err := normalizeRef(ref)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	resolver := newResolver(reg)
+	name, desc, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return ocispec.Descriptor{}, errors.Wrapf(err, "resolve %s", ref)
+	}
+	if platform == nil || !images.IsIndexType(desc.MediaType) {
+		return desc, nil
+	}
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return ocispec.Descriptor{}, errors.Wrapf(err, "create fetcher for %s", ref)
+	}
+	dt, err := fetchBlob(ctx, fetcher, desc)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	var index ocispec.Index
+	err = json.Unmarshal(dt, &index)
+	if err != nil {
+		return ocispec.Descriptor{}, errors.Wrapf(err, "parse manifest list of %s", ref)
+	}
+	matcher := platforms.OnlyStrict(*platform)
+	for _, m := range index.Manifests {
+		if m.Platform != nil && matcher.Match(*m.Platform) {
+			return m, nil
+		}
+	}
+	return ocispec.Descriptor{}, errors.Errorf("%s has no manifest for platform %s", ref, platforms.Format(*platform))
+}
+
+// Attach attaches an in-toto attestation to the image ref, which must have already been pushed. The
+// attestation is pushed as a manifest whose subject is the image, and is additionally listed under the
+// referrers tag (sha256-<digest>) of the image, for registries which do not support the referrers API.
+// If platform is set, the attestation is attached to the manifest of that platform. It returns the
+// digest of the attestation manifest.
+func Attach(ctx context.Context, ref string, platform *ocispec.Platform, att Attestation, reg Registry) (digest.Digest, error) {
+	subject, err := ResolveImage(ctx, ref, platform, reg)
+	if err != nil {
+		return "", err
+	}
+	ref, err = normalizeRef(ref)
+	if err != nil {
+		return "", err
+	}
+	repo, err := repoName(ref)
+	if err != nil {
+		return "", err
+	}
+
+	statement, err := Statement(att.PredicateType, []InTotoSubject{{
+		Name:   ref,
+		Digest: map[string]string{subject.Digest.Algorithm().String(): subject.Digest.Encoded()},
+	}}, att.Predicate)
+	if err != nil {
+		return "", err
+	}
+	layer := ocispec.Descriptor{
+		MediaType: MediaTypeInToto,
+		Digest:    digest.FromBytes(statement),
+		Size:      int64(len(statement)),
+		Annotations: map[string]string{
+			AnnotationPredicateType: att.PredicateType,
+		},
+	}
+	config := []byte("{}")
+	manifest := referrerManifest{
+		Versioned:    specs.Versioned{SchemaVersion: 2},
+		MediaType:    ocispec.MediaTypeImageManifest,
+		ArtifactType: MediaTypeInToto,
+		Config: ocispec.Descriptor{
+			MediaType: mediaTypeEmptyJSON,
+			Digest:    digest.FromBytes(config),
+			Size:      int64(len(config)),
+		},
+		Layers: []ocispec.Descriptor{layer},
+		Subject: &ocispec.Descriptor{
+			MediaType: subject.MediaType,
+			Digest:    subject.Digest,
+			Size:      subject.Size,
+		},
+		Annotations: att.Annotations,
+	}
+	manifestDt, err := json.Marshal(manifest)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal attestation manifest")
+	}
+	manifestDesc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(manifestDt),
+		Size:      int64(len(manifestDt)),
+	}
+
+	resolver := newResolver(reg)
+	pusher, err := resolver.Pusher(ctx, repo+"@"+manifestDesc.Digest.String())
+	if err != nil {
+		return "", errors.Wrapf(err, "create pusher for %s", repo)
+	}
+	err = pushBlob(ctx, pusher, layer, bytes.NewReader(statement))
+	if err != nil {
+		return "", err
+	}
+	err = pushBlob(ctx, pusher, manifest.Config, bytes.NewReader(config))
+	if err != nil {
+		return "", err
+	}
+	err = pushBlob(ctx, pusher, manifestDesc, bytes.NewReader(manifestDt))
+	if err != nil {
+		return "", err
+	}
+
+	// Fallback for registries without the referrers API: list the attestation in an index tagged after the subject.
+	referrer := ocispec.Descriptor{
+		MediaType:   manifestDesc.MediaType,
+		Digest:      manifestDesc.Digest,
+		Size:        manifestDesc.Size,
+		Annotations: map[string]string{AnnotationPredicateType: att.PredicateType},
+	}
+	for k, v := range att.Annotations {
+		referrer.Annotations[k] = v
+	}
+	referrersRef := repo + ":" + strings.Replace(subject.Digest.String(), ":", "-", 1)
+	err = addReferrer(ctx, referrersRef, referrer, reg)
+	if err != nil {
+		return "", err
+	}
+	return manifestDesc.Digest, nil
+}
+
+// addReferrer adds the descriptor to the referrers index tagged as ref, creating the index if needed.
+func addReferrer(ctx context.Context, ref string, referrer ocispec.Descriptor, reg Registry) error {
+	resolver := newResolver(reg)
+	index := ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+	}
+	name, desc, err := resolver.Resolve(ctx, ref)
+	switch {
+	case err == nil:
+		fetcher, err := resolver.Fetcher(ctx, name)
+		if err != nil {
+			return errors.Wrapf(err, "create fetcher for %s", ref)
+		}
+		dt, err := fetchBlob(ctx, fetcher, desc)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(dt, &index)
+		if err != nil {
+			return errors.Wrapf(err, "parse referrers index %s", ref)
+		}
+	case errdefs.IsNotFound(err):
+	default:
+		return errors.Wrapf(err, "resolve %s", ref)
+	}
+	for _, m := range index.Manifests {
+		if m.Digest == referrer.Digest {
+			return nil
+		}
+	}
+	index.Manifests = append(index.Manifests, referrer)
+	dt, err := json.Marshal(index)
+	if err != nil {
+		return errors.Wrap(err, "marshal referrers index")
+	}
+	indexDesc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Digest:    digest.FromBytes(dt),
+		Size:      int64(len(dt)),
+	}
+	pusher, err := resolver.Pusher(ctx, ref)
+	if err != nil {
+		return errors.Wrapf(err, "create pusher for %s", ref)
+	}
+	return pushBlob(ctx, pusher, indexDesc, bytes.NewReader(dt))
+}
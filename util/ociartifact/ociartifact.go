@@ -0,0 +1,355 @@
+// Package ociartifact pushes files to, and pulls files from, an OCI registry as OCI artifacts:
+// image manifests whose layers are the plain files, annotated with their names.
+package ociartifact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/earthly/earthly/conslogging"
+	"github.com/earthly/earthly/domain"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/docker/distribution/reference"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/auth"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Scheme is the prefix of the OCI artifact references which can be used as a COPY source.
+	Scheme = "oci://"
+	// DefaultMediaType is the media type of the artifact layers, unless overridden.
+	DefaultMediaType = "application/octet-stream"
+	// ConfigMediaType is the media type of the (empty) config of the artifact manifest.
+	ConfigMediaType = "application/vnd.earthly.artifact.config.v1+json"
+	// AnnotationArtifact is the manifest annotation holding the earthly artifact reference that was pushed.
+	AnnotationArtifact = "dev.earthly.artifact"
+	// annotationFileMode is the layer annotation holding the permissions of the file.
+	annotationFileMode = "dev.earthly.file.mode"
+)
+
+// CredentialsFunc returns the username and secret to use for a registry host.
+type CredentialsFunc func(host string) (string, string, error)
+
+type credentialsProvider interface {
+	Credentials(context.Context, *auth.CredentialsRequest) (*auth.CredentialsResponse, error)
+}
+
+// CredentialsFromAttachables returns the credentials of the registry auth provider among the session
+// attachables; these are the same credentials that are used for pushing images.
+func CredentialsFromAttachables(ctx context.Context, attachables []session.Attachable) CredentialsFunc {
+	for _, a := range attachables {
+		cp, ok := a.(credentialsProvider)
+		if !ok {
+			continue
+		}
+		return func(host string) (string, string, error) {
+			resp, err := cp.Credentials(ctx, &auth.CredentialsRequest{Host: host})
+			if err != nil {
+				return "", "", errors.Wrapf(err, "get credentials for %s", host)
+			}
+			return resp.Username, resp.Secret, nil
+		}
+	}
+	return nil
+}
+
+func normalizeRef(ref string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(strings.TrimPrefix(ref, Scheme))
+	if err != nil {
+		return "", errors.Wrapf(err, "parse reference %s", ref)
+	}
+	return reference.TagNameOnly(named).String(), nil
+}
+
+type file struct {
+	name string // the slash-separated name of the file within the artifact
+	path string // the path on the host
+	mode os.FileMode
+	desc ocispec.Descriptor
+}
+
+// collectFiles walks the given paths and returns the regular files within them, sorted by name.
+// Each path is placed at the root of the artifact, under its base name.
+func collectFiles(paths []string) ([]*file, error) {
+	var files []*file
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		parent := filepath.Dir(p)
+		err := filepath.Walk(p, func(walkPath string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(parent, walkPath)
+			if err != nil {
+				return err
+			}
+			name := filepath.ToSlash(rel)
+			if seen[name] {
+				return nil
+			}
+			seen[name] = true
+			files = append(files, &file{name: name, path: walkPath, mode: fi.Mode().Perm()})
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "walk %s", p)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+	return files, nil
+}
+
+// Push pushes the files within the given paths to ref as an OCI artifact, with one layer per file.
+// It returns the digest of the pushed manifest.
+func Push(ctx context.Context, ref string, paths []string, mediaType string, annotations map[string]string, reg Registry) (digest.Digest, error) {
+	ref, err := normalizeRef(ref)
+	if err != nil {
+		return "", err
+	}
+	if mediaType == "" {
+		mediaType = DefaultMediaType
+	}
+	files, err := collectFiles(paths)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", errors.Errorf("no files to push to %s", ref)
+	}
+	pusher, err := newResolver(reg).Pusher(ctx, ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "create pusher for %s", ref)
+	}
+
+	manifest := ocispec.Manifest{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		MediaType:   ocispec.MediaTypeImageManifest,
+		Annotations: annotations,
+	}
+	for _, f := range files {
+		dgst, size, err := digestFile(f.path)
+		if err != nil {
+			return "", err
+		}
+		f.desc = ocispec.Descriptor{
+			MediaType: mediaType,
+			Digest:    dgst,
+			Size:      size,
+			Annotations: map[string]string{
+				ocispec.AnnotationTitle: f.name,
+				annotationFileMode:      fmt.Sprintf("%#o", f.mode),
+			},
+		}
+		err = pushFile(ctx, pusher, f)
+		if err != nil {
+			return "", err
+		}
+		manifest.Layers = append(manifest.Layers, f.desc)
+	}
+
+	config := []byte("{}")
+	manifest.Config = ocispec.Descriptor{
+		MediaType: ConfigMediaType,
+		Digest:    digest.FromBytes(config),
+		Size:      int64(len(config)),
+	}
+	err = pushBlob(ctx, pusher, manifest.Config, bytes.NewReader(config))
+	if err != nil {
+		return "", err
+	}
+	manifestDt, err := json.Marshal(manifest)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal manifest")
+	}
+	manifestDesc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(manifestDt),
+		Size:      int64(len(manifestDt)),
+	}
+	err = pushBlob(ctx, pusher, manifestDesc, bytes.NewReader(manifestDt))
+	if err != nil {
+		return "", err
+	}
+	return manifestDesc.Digest, nil
+}
+
+func digestFile(p string) (digest.Digest, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "open %s", p)
+	}
+	defer f.Close()
+	digester := digest.Canonical.Digester()
+	size, err := io.Copy(digester.Hash(), f)
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "digest %s", p)
+	}
+	return digester.Digest(), size, nil
+}
+
+func pushFile(ctx context.Context, pusher remotes.Pusher, f *file) error {
+	r, err := os.Open(f.path)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", f.path)
+	}
+	defer r.Close()
+	return pushBlob(ctx, pusher, f.desc, r)
+}
+
+func pushBlob(ctx context.Context, pusher remotes.Pusher, desc ocispec.Descriptor, r io.Reader) error {
+	w, err := pusher.Push(ctx, desc)
+	if err != nil {
+		if errdefs.IsAlreadyExists(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "push %s", desc.Digest)
+	}
+	defer w.Close()
+	_, err = io.Copy(w, r)
+	if err != nil {
+		return errors.Wrapf(err, "push %s", desc.Digest)
+	}
+	err = w.Commit(ctx, desc.Size, desc.Digest)
+	if err != nil && !errdefs.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "commit %s", desc.Digest)
+	}
+	return nil
+}
+
+// Pull fetches the OCI artifact at ref and writes its files into destDir. It returns the digest of the
+// artifact manifest.
+func Pull(ctx context.Context, ref string, destDir string, reg Registry) (digest.Digest, error) {
+	ref, err := normalizeRef(ref)
+	if err != nil {
+		return "", err
+	}
+	resolver := newResolver(reg)
+	name, desc, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "resolve %s", ref)
+	}
+	if desc.MediaType != ocispec.MediaTypeImageManifest {
+		return "", errors.Errorf("%s is not an OCI artifact (media type %s)", ref, desc.MediaType)
+	}
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return "", errors.Wrapf(err, "create fetcher for %s", ref)
+	}
+	manifestDt, err := fetchBlob(ctx, fetcher, desc)
+	if err != nil {
+		return "", err
+	}
+	var manifest ocispec.Manifest
+	err = json.Unmarshal(manifestDt, &manifest)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse manifest of %s", ref)
+	}
+	for _, layer := range manifest.Layers {
+		name := layer.Annotations[ocispec.AnnotationTitle]
+		if name == "" {
+			name = layer.Digest.Encoded()
+		}
+		name = path.Clean(name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return "", errors.Errorf("invalid file name %s in %s", name, ref)
+		}
+		mode := os.FileMode(0644)
+		if m, ok := layer.Annotations[annotationFileMode]; ok {
+			parsed, err := strconv.ParseUint(m, 0, 32)
+			if err == nil {
+				mode = os.FileMode(parsed).Perm()
+			}
+		}
+		err = fetchFile(ctx, fetcher, layer, filepath.Join(destDir, filepath.FromSlash(name)), mode)
+		if err != nil {
+			return "", err
+		}
+	}
+	return desc.Digest, nil
+}
+
+func fetchBlob(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor) ([]byte, error) {
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetch %s", desc.Digest)
+	}
+	defer rc.Close()
+	dt, err := io.ReadAll(io.LimitReader(rc, desc.Size))
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetch %s", desc.Digest)
+	}
+	if digest.FromBytes(dt) != desc.Digest {
+		return nil, errors.Errorf("digest mismatch for %s", desc.Digest)
+	}
+	return dt, nil
+}
+
+func fetchFile(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor, dest string, mode os.FileMode) error {
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return errors.Wrapf(err, "fetch %s", desc.Digest)
+	}
+	defer rc.Close()
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return errors.Wrapf(err, "mkdir all %s", filepath.Dir(dest))
+	}
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return errors.Wrapf(err, "create %s", dest)
+	}
+	defer f.Close()
+	digester := digest.Canonical.Digester()
+	_, err = io.Copy(io.MultiWriter(f, digester.Hash()), io.LimitReader(rc, desc.Size))
+	if err != nil {
+		return errors.Wrapf(err, "write %s", dest)
+	}
+	if digester.Digest() != desc.Digest {
+		return errors.Errorf("digest mismatch for %s", dest)
+	}
+	return f.Close()
+}
+
+// PushArtifact pushes an artifact, which has been exported to indexOutDir, to ref as an OCI artifact.
+func PushArtifact(ctx context.Context, console conslogging.ConsoleLogger, artifact domain.Artifact, indexOutDir string, ref string, mediaType string, ifExists bool, reg Registry) error {
+	fromPattern := filepath.Join(indexOutDir, filepath.FromSlash(artifact.Artifact))
+	fromGlobMatches, err := filepath.Glob(fromPattern)
+	if err != nil {
+		return errors.Wrapf(err, "glob")
+	}
+	if len(fromGlobMatches) == 0 {
+		if ifExists {
+			return nil
+		}
+		return errors.Errorf("cannot push artifact %s, since it does not exist", artifact.StringCanonical())
+	}
+	annotations := map[string]string{
+		AnnotationArtifact: artifact.StringCanonical(),
+	}
+	dgst, err := Push(ctx, ref, fromGlobMatches, mediaType, annotations, reg)
+	if err != nil {
+		return errors.Wrapf(err, "push artifact %s to %s", artifact.StringCanonical(), ref)
+	}
+	console.Printf("Pushed artifact %s to %s@%s\n", artifact.StringCanonical(), ref, dgst)
+	return nil
+}
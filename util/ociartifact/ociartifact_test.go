@@ -0,0 +1,208 @@
+package ociartifact
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	. "github.com/stretchr/testify/assert"
+)
+
+// fakeRegistry is a minimal in-memory stand-in for a registry:2 instance.
+type fakeRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte // by tag and by digest
+}
+
+func (fr *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	p := strings.TrimPrefix(r.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(p, "/blobs/uploads/"):
+		if r.Method == http.MethodPost {
+			w.Header().Set("Location", "/v2/"+p+"upload")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		dt, _ := io.ReadAll(r.Body)
+		fr.blobs[r.URL.Query().Get("digest")] = dt
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(dt).String())
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(p, "/blobs/"):
+		dt, ok := fr.blobs[p[strings.LastIndex(p, "/")+1:]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(dt)))
+		if r.Method == http.MethodGet {
+			w.Write(dt)
+		}
+	case strings.Contains(p, "/manifests/"):
+		key := p[strings.LastIndex(p, "/")+1:]
+		if r.Method == http.MethodPut {
+			dt, _ := io.ReadAll(r.Body)
+			fr.manifests[key] = dt
+			fr.manifests[digest.FromBytes(dt).String()] = dt
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(dt).String())
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		dt, ok := fr.manifests[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(dt).String())
+		w.Header().Set("Content-Length", strconv.Itoa(len(dt)))
+		if r.Method == http.MethodGet {
+			w.Write(dt)
+		}
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func TestPushPull(t *testing.T) {
+	fr := &fakeRegistry{blobs: map[string][]byte{}, manifests: map[string][]byte{}}
+	srv := httptest.NewServer(fr)
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	ref := host + "/tools/cli:v1"
+
+	src := filepath.Join(t.TempDir(), "dist")
+	NoError(t, os.MkdirAll(filepath.Join(src, "bin"), 0755))
+	NoError(t, os.WriteFile(filepath.Join(src, "bin", "cli"), []byte("#!/bin/sh\necho hi\n"), 0755))
+	NoError(t, os.WriteFile(filepath.Join(src, "README.md"), []byte("readme"), 0644))
+
+	ctx := context.Background()
+	dgst, err := Push(ctx, ref, []string{src}, "application/vnd.example.cli", map[string]string{AnnotationArtifact: "+build/dist"}, Registry{})
+	if !NoError(t, err) {
+		return
+	}
+
+	var manifest ocispec.Manifest
+	NoError(t, json.Unmarshal(fr.manifests["v1"], &manifest))
+	Equal(t, "+build/dist", manifest.Annotations[AnnotationArtifact])
+	Equal(t, ConfigMediaType, manifest.Config.MediaType)
+	var titles []string
+	for _, l := range manifest.Layers {
+		Equal(t, "application/vnd.example.cli", l.MediaType)
+		titles = append(titles, l.Annotations[ocispec.AnnotationTitle])
+	}
+	Equal(t, []string{"dist/README.md", "dist/bin/cli"}, titles)
+
+	dest := t.TempDir()
+	pulled, err := Pull(ctx, Scheme+ref, dest, Registry{})
+	if !NoError(t, err) {
+		return
+	}
+	Equal(t, dgst, pulled)
+	dt, err := os.ReadFile(filepath.Join(dest, "dist", "bin", "cli"))
+	NoError(t, err)
+	Equal(t, "#!/bin/sh\necho hi\n", string(dt))
+	fi, err := os.Stat(filepath.Join(dest, "dist", "bin", "cli"))
+	if !NoError(t, err) {
+		return
+	}
+	Equal(t, os.FileMode(0755), fi.Mode().Perm())
+}
+
+func TestAttach(t *testing.T) {
+	fr := &fakeRegistry{blobs: map[string][]byte{}, manifests: map[string][]byte{}}
+	srv := httptest.NewServer(fr)
+	defer srv.Close()
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/app:v1"
+
+	src := filepath.Join(t.TempDir(), "file.txt")
+	NoError(t, os.WriteFile(src, []byte("content"), 0644))
+	ctx := context.Background()
+	subject, err := Push(ctx, ref, []string{src}, "", nil, Registry{})
+	if !NoError(t, err) {
+		return
+	}
+
+	att := Attestation{PredicateType: "https://spdx.dev/Document", Predicate: []byte(`{"spdxVersion":"SPDX-2.3"}`)}
+	dgst, err := Attach(ctx, ref, nil, att, Registry{})
+	if !NoError(t, err) {
+		return
+	}
+	var manifest referrerManifest
+	NoError(t, json.Unmarshal(fr.manifests[dgst.String()], &manifest))
+	if NotNil(t, manifest.Subject) {
+		Equal(t, subject, manifest.Subject.Digest)
+	}
+	var statement InTotoStatement
+	NoError(t, json.Unmarshal(fr.blobs[manifest.Layers[0].Digest.String()], &statement))
+	Equal(t, "https://spdx.dev/Document", statement.PredicateType)
+	Equal(t, subject.Encoded(), statement.Subject[0].Digest["sha256"])
+
+	// Attaching again keeps a single entry in the referrers index.
+	_, err = Attach(ctx, ref, nil, att, Registry{})
+	NoError(t, err)
+	var index ocispec.Index
+	NoError(t, json.Unmarshal(fr.manifests["sha256-"+subject.Encoded()], &index))
+	Len(t, index.Manifests, 1)
+}
+
+func TestSignVerify(t *testing.T) {
+	fr := &fakeRegistry{blobs: map[string][]byte{}, manifests: map[string][]byte{}}
+	srv := httptest.NewServer(fr)
+	defer srv.Close()
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/app:v1"
+
+	src := filepath.Join(t.TempDir(), "file.txt")
+	NoError(t, os.WriteFile(src, []byte("content"), 0644))
+	ctx := context.Background()
+	subject, err := Push(ctx, ref, []string{src}, "", nil, Registry{})
+	if !NoError(t, err) {
+		return
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	NoError(t, err)
+	signer, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil)
+	if !NoError(t, err) {
+		return
+	}
+	_, err = Verify(ctx, ref, signer.Public(), Registry{})
+	Error(t, err)
+
+	signed, err := Sign(ctx, ref, signer, Registry{})
+	NoError(t, err)
+	Equal(t, subject, signed)
+	_, err = Sign(ctx, ref, signer, Registry{})
+	NoError(t, err)
+	var manifest ocispec.Manifest
+	NoError(t, json.Unmarshal(fr.manifests["sha256-"+subject.Encoded()+".sig"], &manifest))
+	Len(t, manifest.Layers, 1)
+
+	verified, err := Verify(ctx, ref, signer.Public(), Registry{})
+	NoError(t, err)
+	Equal(t, subject, verified)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	NoError(t, err)
+	_, err = Verify(ctx, ref, other.Public(), Registry{})
+	Error(t, err)
+}
@@ -0,0 +1,77 @@
+package ociartifact
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/docker/distribution/reference"
+	"github.com/pkg/errors"
+)
+
+// Registry configures how registries are accessed.
+type Registry struct {
+	// Creds returns the credentials of a registry host. It may be nil.
+	Creds CredentialsFunc
+	// PlainHTTP are the registry hosts which are accessed via plain HTTP, in addition to localhost.
+	PlainHTTP []string
+	// SkipVerify are the registry hosts whose TLS certificates are not verified.
+	SkipVerify []string
+}
+
+// WithPlainHTTP returns a copy of the registry config which accesses the registry of the given image
+// reference via plain HTTP, as for SAVE IMAGE --insecure.
+func (r Registry) WithPlainHTTP(ref string) (Registry, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return r, errors.Wrapf(err, "parse reference %s", ref)
+	}
+	r.PlainHTTP = append(append([]string{}, r.PlainHTTP...), reference.Domain(named))
+	return r, nil
+}
+
+func (r Registry) isPlainHTTP(host string) (bool, error) {
+	if containsHost(r.PlainHTTP, host) {
+		return true, nil
+	}
+	return docker.MatchLocalhost(host)
+}
+
+func newResolver(reg Registry) remotes.Resolver {
+	newHosts := func(client *http.Client) docker.RegistryHosts {
+		authOpts := []docker.AuthorizerOpt{docker.WithAuthClient(client)}
+		if reg.Creds != nil {
+			authOpts = append(authOpts, docker.WithAuthCreds(reg.Creds))
+		}
+		return docker.ConfigureDefaultRegistries(
+			docker.WithAuthorizer(docker.NewDockerAuthorizer(authOpts...)),
+			docker.WithPlainHTTP(reg.isPlainHTTP),
+			docker.WithClient(client),
+		)
+	}
+	hosts := newHosts(http.DefaultClient)
+	if len(reg.SkipVerify) == 0 {
+		return docker.NewResolver(docker.ResolverOptions{Hosts: hosts})
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	skipVerifyHosts := newHosts(&http.Client{Transport: transport})
+	return docker.NewResolver(docker.ResolverOptions{
+		Hosts: func(host string) ([]docker.RegistryHost, error) {
+			if containsHost(reg.SkipVerify, host) {
+				return skipVerifyHosts(host)
+			}
+			return hosts(host)
+		},
+	})
+}
+
+func containsHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
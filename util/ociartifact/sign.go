@@ -0,0 +1,285 @@
+package ociartifact
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MediaTypeSimpleSigning is the media type of the layers of cosign signature manifests.
+	MediaTypeSimpleSigning = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// AnnotationSignature is the layer annotation holding the base64-encoded signature of the layer.
+	AnnotationSignature = "dev.cosignproject.cosign/signature"
+	// signatureType is the type of cosign image signature payloads.
+	signatureType = "cosign container image signature"
+	// signatureTagSuffix is the suffix of the tag of the signature manifest of an image, after its digest.
+	signatureTagSuffix = ".sig"
+)
+
+// SignaturePayload is the simple signing payload which is signed for an image, in the format used by cosign.
+type SignaturePayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// signatureConfig is the image config of signature manifests.
+type signatureConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	RootFS       struct {
+		Type    string          `json:"type"`
+		DiffIDs []digest.Digest `json:"diff_ids"`
+	} `json:"rootfs"`
+	Config struct{} `json:"config"`
+}
+
+// SignatureRef returns the tag holding the signatures of the image with the given manifest digest in repo.
+func SignatureRef(repo string, dgst digest.Digest) string {
+	return repo + ":" + strings.Replace(dgst.String(), ":", "-", 1) + signatureTagSuffix
+}
+
+// Sign signs the image ref, which must have already been pushed, with key. The signature is pushed to the
+// same repository in the cosign format, such that it can be verified via cosign or Verify. It returns the
+// digest of the signed image manifest.
+func Sign(ctx context.Context, ref string, key crypto.Signer, reg Registry) (digest.Digest, error) {
+	subject, err := ResolveImage(ctx, ref, nil, reg)
+	if err != nil {
+		return "", err
+	}
+	repo, err := repoName(ref)
+	if err != nil {
+		return "", err
+	}
+	var payload SignaturePayload
+	payload.Critical.Identity.DockerReference = repo
+	payload.Critical.Image.DockerManifestDigest = subject.Digest.String()
+	payload.Critical.Type = signatureType
+	payloadDt, err := json.Marshal(payload)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal signature payload")
+	}
+	sig, err := signPayload(key, payloadDt)
+	if err != nil {
+		return "", err
+	}
+	layer := ocispec.Descriptor{
+		MediaType: MediaTypeSimpleSigning,
+		Digest:    digest.FromBytes(payloadDt),
+		Size:      int64(len(payloadDt)),
+		Annotations: map[string]string{
+			AnnotationSignature: base64.StdEncoding.EncodeToString(sig),
+		},
+	}
+
+	sigRef := SignatureRef(repo, subject.Digest)
+	layers, err := fetchSignatureLayers(ctx, sigRef, reg)
+	if err != nil {
+		return "", err
+	}
+	for _, l := range layers {
+		// Signatures may be randomized; the image is already signed if the same payload was signed with the same key.
+		existing, err := base64.StdEncoding.DecodeString(l.Annotations[AnnotationSignature])
+		if err == nil && l.Digest == layer.Digest && verifyPayload(key.Public(), payloadDt, existing) {
+			return subject.Digest, nil
+		}
+	}
+	layers = append(layers, layer)
+
+	var config signatureConfig
+	config.RootFS.Type = "layers"
+	for _, l := range layers {
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, l.Digest)
+	}
+	configDt, err := json.Marshal(config)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal signature config")
+	}
+	manifest := ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageConfig,
+			Digest:    digest.FromBytes(configDt),
+			Size:      int64(len(configDt)),
+		},
+		Layers: layers,
+	}
+	manifestDt, err := json.Marshal(manifest)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal signature manifest")
+	}
+
+	pusher, err := newResolver(reg).Pusher(ctx, sigRef)
+	if err != nil {
+		return "", errors.Wrapf(err, "create pusher for %s", sigRef)
+	}
+	err = pushBlob(ctx, pusher, layer, bytes.NewReader(payloadDt))
+	if err != nil {
+		return "", err
+	}
+	err = pushBlob(ctx, pusher, manifest.Config, bytes.NewReader(configDt))
+	if err != nil {
+		return "", err
+	}
+	err = pushBlob(ctx, pusher, ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(manifestDt),
+		Size:      int64(len(manifestDt)),
+	}, bytes.NewReader(manifestDt))
+	if err != nil {
+		return "", err
+	}
+	return subject.Digest, nil
+}
+
+// Verify verifies that the image ref has been signed with the private key of pub. It returns the digest of
+// the verified image manifest.
+func Verify(ctx context.Context, ref string, pub crypto.PublicKey, reg Registry) (digest.Digest, error) {
+	subject, err := ResolveImage(ctx, ref, nil, reg)
+	if err != nil {
+		return "", err
+	}
+	repo, err := repoName(ref)
+	if err != nil {
+		return "", err
+	}
+	sigRef := SignatureRef(repo, subject.Digest)
+	resolver := newResolver(reg)
+	name, desc, err := resolver.Resolve(ctx, sigRef)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return "", errors.Errorf("image %s (%s) is not signed", ref, subject.Digest)
+		}
+		return "", errors.Wrapf(err, "resolve %s", sigRef)
+	}
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return "", errors.Wrapf(err, "create fetcher for %s", sigRef)
+	}
+	dt, err := fetchBlob(ctx, fetcher, desc)
+	if err != nil {
+		return "", err
+	}
+	var manifest ocispec.Manifest
+	err = json.Unmarshal(dt, &manifest)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse signature manifest %s", sigRef)
+	}
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != MediaTypeSimpleSigning {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(layer.Annotations[AnnotationSignature])
+		if err != nil {
+			continue
+		}
+		payloadDt, err := fetchBlob(ctx, fetcher, layer)
+		if err != nil {
+			return "", err
+		}
+		if !verifyPayload(pub, payloadDt, sig) {
+			continue
+		}
+		var payload SignaturePayload
+		err = json.Unmarshal(payloadDt, &payload)
+		if err != nil {
+			continue
+		}
+		if payload.Critical.Type == signatureType && payload.Critical.Image.DockerManifestDigest == subject.Digest.String() {
+			return subject.Digest, nil
+		}
+	}
+	return "", errors.Errorf("no valid signature found for image %s (%s)", ref, subject.Digest)
+}
+
+func repoName(ref string) (string, error) {
+	ref, err := normalizeRef(ref)
+	if err != nil {
+		return "", err
+	}
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse reference %s", ref)
+	}
+	return named.Name(), nil
+}
+
+// fetchSignatureLayers returns the layers of the existing signature manifest sigRef, if any.
+func fetchSignatureLayers(ctx context.Context, sigRef string, reg Registry) ([]ocispec.Descriptor, error) {
+	resolver := newResolver(reg)
+	name, desc, err := resolver.Resolve(ctx, sigRef)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "resolve %s", sigRef)
+	}
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create fetcher for %s", sigRef)
+	}
+	dt, err := fetchBlob(ctx, fetcher, desc)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ocispec.Manifest
+	err = json.Unmarshal(dt, &manifest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse signature manifest %s", sigRef)
+	}
+	return manifest.Layers, nil
+}
+
+func signPayload(key crypto.Signer, payload []byte) ([]byte, error) {
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		sig, err := key.Sign(rand.Reader, payload, crypto.Hash(0))
+		if err != nil {
+			return nil, errors.Wrap(err, "sign payload")
+		}
+		return sig, nil
+	}
+	h := sha256.Sum256(payload)
+	sig, err := key.Sign(rand.Reader, h[:], crypto.SHA256)
+	if err != nil {
+		return nil, errors.Wrap(err, "sign payload")
+	}
+	return sig, nil
+}
+
+func verifyPayload(pub crypto.PublicKey, payload, sig []byte) bool {
+	h := sha256.Sum256(payload)
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, h[:], sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sig) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, sig)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,139 @@
+package ociartifact
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	pemTypeEncryptedCosign   = "ENCRYPTED COSIGN PRIVATE KEY"
+	pemTypeEncryptedSigstore = "ENCRYPTED SIGSTORE PRIVATE KEY"
+	pemTypePKCS8             = "PRIVATE KEY"
+	pemTypeEC                = "EC PRIVATE KEY"
+	pemTypeRSA               = "RSA PRIVATE KEY"
+	pemTypePublicKey         = "PUBLIC KEY"
+)
+
+// encryptedKey is the body of an encrypted cosign private key: a PKCS #8 key encrypted with nacl/secretbox,
+// whose key is derived from the password via scrypt.
+type encryptedKey struct {
+	KDF struct {
+		Name   string `json:"name"`
+		Params struct {
+			N int `json:"N"`
+			R int `json:"r"`
+			P int `json:"p"`
+		} `json:"params"`
+		Salt []byte `json:"salt"`
+	} `json:"kdf"`
+	Cipher struct {
+		Name  string `json:"name"`
+		Nonce []byte `json:"nonce"`
+	} `json:"cipher"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// ParsePrivateKey parses a PEM-encoded private key, used for signing images. Both plain PKCS #8, EC and RSA
+// keys and encrypted cosign keys are supported; password is only called for the latter.
+func ParsePrivateKey(dt []byte, password func() ([]byte, error)) (crypto.Signer, error) {
+	block, _ := pem.Decode(dt)
+	if block == nil {
+		return nil, errors.New("no PEM block found in private key")
+	}
+	der := block.Bytes
+	switch block.Type {
+	case pemTypeEncryptedCosign, pemTypeEncryptedSigstore:
+		if password == nil {
+			return nil, errors.New("private key is encrypted, but no password was provided")
+		}
+		pw, err := password()
+		if err != nil {
+			return nil, err
+		}
+		der, err = decryptKey(block.Bytes, pw)
+		if err != nil {
+			return nil, err
+		}
+	case pemTypeEC:
+		key, err := x509.ParseECPrivateKey(der)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse EC private key")
+		}
+		return key, nil
+	case pemTypeRSA:
+		key, err := x509.ParsePKCS1PrivateKey(der)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse RSA private key")
+		}
+		return key, nil
+	case pemTypePKCS8:
+	default:
+		return nil, errors.Errorf("unsupported private key PEM type %q", block.Type)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse private key")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+func decryptKey(dt []byte, password []byte) ([]byte, error) {
+	var ek encryptedKey
+	err := json.Unmarshal(dt, &ek)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse encrypted private key")
+	}
+	if ek.KDF.Name != "scrypt" || ek.Cipher.Name != "nacl/secretbox" {
+		return nil, errors.Errorf("unsupported private key encryption %s with %s", ek.Cipher.Name, ek.KDF.Name)
+	}
+	if len(ek.Cipher.Nonce) != 24 {
+		return nil, errors.New("invalid nonce in encrypted private key")
+	}
+	k, err := scrypt.Key(password, ek.KDF.Salt, ek.KDF.Params.N, ek.KDF.Params.R, ek.KDF.Params.P, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "derive private key encryption key")
+	}
+	var key [32]byte
+	var nonce [24]byte
+	copy(key[:], k)
+	copy(nonce[:], ek.Cipher.Nonce)
+	der, ok := secretbox.Open(nil, ek.Ciphertext, &nonce, &key)
+	if !ok {
+		return nil, errors.New("decrypt private key: invalid password")
+	}
+	return der, nil
+}
+
+// ParsePublicKey parses a PEM-encoded public key, used for verifying image signatures.
+func ParsePublicKey(dt []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(dt)
+	if block == nil {
+		return nil, errors.New("no PEM block found in public key")
+	}
+	if block.Type != pemTypePublicKey {
+		return nil, errors.Errorf("unsupported public key PEM type %q", block.Type)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse public key")
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, errors.Errorf("unsupported public key type %T", key)
+	}
+}
@@ -0,0 +1,514 @@
+// Package ocilayout reads and writes OCI image layouts, such that output images can be written to the host
+// as an OCI image layout directory or tarball, without a container frontend.
+package ocilayout
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/containerd/containerd/images"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	blobsDir  = "blobs"
+	indexFile = "index.json"
+)
+
+// annotationImageName is the annotation used by containerd (and thus buildkit) for the full image name.
+const annotationImageName = "io.containerd.image.name"
+
+// Layout is an OCI image layout directory.
+type Layout struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Open opens the OCI image layout at the given dir, creating it if it does not exist.
+func Open(dir string) (*Layout, error) {
+	err := os.MkdirAll(filepath.Join(dir, blobsDir, digest.SHA256.String()), 0755)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create oci layout %s", dir)
+	}
+	layoutPath := filepath.Join(dir, ocispec.ImageLayoutFile)
+	_, err = os.Stat(layoutPath)
+	if os.IsNotExist(err) {
+		dt, err := json.Marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal oci layout")
+		}
+		err = os.WriteFile(layoutPath, dt, 0644)
+		if err != nil {
+			return nil, errors.Wrapf(err, "write %s", layoutPath)
+		}
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "stat %s", layoutPath)
+	}
+	return &Layout{dir: dir}, nil
+}
+
+// Dir returns the directory of the layout.
+func (l *Layout) Dir() string {
+	return l.dir
+}
+
+func (l *Layout) blobPath(dgst digest.Digest) string {
+	return filepath.Join(l.dir, blobsDir, dgst.Algorithm().String(), dgst.Encoded())
+}
+
+// Import reads an image tarball, as produced by buildkit's docker and oci exporters, and adds its blobs
+// to the layout. It returns the manifest descriptors listed in the index of the tarball.
+func (l *Layout) Import(r io.Reader) ([]ocispec.Descriptor, error) {
+	var index *ocispec.Index
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read image tar")
+		}
+		name := path.Clean(hdr.Name)
+		switch {
+		case name == indexFile:
+			index = &ocispec.Index{}
+			err = json.NewDecoder(tr).Decode(index)
+			if err != nil {
+				return nil, errors.Wrap(err, "decode index.json")
+			}
+		case hdr.Typeflag == tar.TypeReg && strings.HasPrefix(name, blobsDir+"/"):
+			parts := strings.Split(name, "/")
+			if len(parts) != 3 {
+				continue
+			}
+			dgst := digest.NewDigestFromEncoded(digest.Algorithm(parts[1]), parts[2])
+			err = dgst.Validate()
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid blob %s", name)
+			}
+			err = l.writeBlob(dgst, tr)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if index == nil {
+		return nil, errors.New("image tar does not contain an index.json")
+	}
+	return index.Manifests, nil
+}
+
+// writeBlob writes the blob with the given digest, unless it exists already.
+func (l *Layout) writeBlob(dgst digest.Digest, r io.Reader) error {
+	p := l.blobPath(dgst)
+	_, err := os.Stat(p)
+	if err == nil {
+		return nil
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return errors.Wrapf(err, "mkdir %s", filepath.Dir(p))
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-"+dgst.Encoded())
+	if err != nil {
+		return errors.Wrapf(err, "create blob %s", dgst)
+	}
+	defer os.Remove(f.Name())
+	verifier := dgst.Verifier()
+	_, err = io.Copy(io.MultiWriter(f, verifier), r)
+	if err != nil {
+		f.Close()
+		return errors.Wrapf(err, "write blob %s", dgst)
+	}
+	err = f.Close()
+	if err != nil {
+		return errors.Wrapf(err, "close blob %s", dgst)
+	}
+	if !verifier.Verified() {
+		return errors.Errorf("blob %s does not match its digest", dgst)
+	}
+	return os.Rename(f.Name(), p)
+}
+
+func (l *Layout) writeJSONBlob(mediaType string, v interface{}) (ocispec.Descriptor, error) {
+	dt, err := json.Marshal(v)
+	if err != nil {
+		return ocispec.Descriptor{}, errors.Wrapf(err, "marshal %s", mediaType)
+	}
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(dt),
+		Size:      int64(len(dt)),
+	}
+	err = l.writeBlob(desc.Digest, bytes.NewReader(dt))
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return desc, nil
+}
+
+func (l *Layout) readJSONBlob(dgst digest.Digest, v interface{}) error {
+	dt, err := os.ReadFile(l.blobPath(dgst))
+	if err != nil {
+		return errors.Wrapf(err, "read blob %s", dgst)
+	}
+	err = json.Unmarshal(dt, v)
+	if err != nil {
+		return errors.Wrapf(err, "unmarshal blob %s", dgst)
+	}
+	return nil
+}
+
+// AddIndex creates an image index (manifest list) referencing the given image manifests. The platform of each
+// manifest is read from its image config.
+func (l *Layout) AddIndex(manifests []ocispec.Descriptor) (ocispec.Descriptor, error) {
+	index := ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+	}
+	for _, desc := range manifests {
+		var manifest ocispec.Manifest
+		err := l.readJSONBlob(desc.Digest, &manifest)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		var platform ocispec.Platform
+		err = l.readJSONBlob(manifest.Config.Digest, &platform)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		index.Manifests = append(index.Manifests, ocispec.Descriptor{
+			MediaType: desc.MediaType,
+			Digest:    desc.Digest,
+			Size:      desc.Size,
+			Platform: &ocispec.Platform{
+				Architecture: platform.Architecture,
+				OS:           platform.OS,
+				Variant:      platform.Variant,
+			},
+		})
+	}
+	sort.SliceStable(index.Manifests, func(i, j int) bool {
+		return platformString(index.Manifests[i].Platform) < platformString(index.Manifests[j].Platform)
+	})
+	return l.writeJSONBlob(ocispec.MediaTypeImageIndex, index)
+}
+
+func platformString(p *ocispec.Platform) string {
+	return path.Join(p.OS, p.Architecture, p.Variant)
+}
+
+// Copy copies the blobs of the given manifest or index, and of everything it references, into dst.
+func (l *Layout) Copy(dst *Layout, desc ocispec.Descriptor) error {
+	children, err := l.children(desc)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		err = l.Copy(dst, child)
+		if err != nil {
+			return err
+		}
+	}
+	f, err := os.Open(l.blobPath(desc.Digest))
+	if err != nil {
+		return errors.Wrapf(err, "open blob %s", desc.Digest)
+	}
+	defer f.Close()
+	return dst.writeBlob(desc.Digest, f)
+}
+
+// children returns the descriptors referenced by the given manifest or index.
+func (l *Layout) children(desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest, images.MediaTypeDockerSchema2Manifest:
+		var manifest ocispec.Manifest
+		err := l.readJSONBlob(desc.Digest, &manifest)
+		if err != nil {
+			return nil, err
+		}
+		return append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...), nil
+	case ocispec.MediaTypeImageIndex, images.MediaTypeDockerSchema2ManifestList:
+		var index ocispec.Index
+		err := l.readJSONBlob(desc.Digest, &index)
+		if err != nil {
+			return nil, err
+		}
+		return index.Manifests, nil
+	default:
+		return nil, nil
+	}
+}
+
+// Tag adds the given manifest or index to the index.json of the layout, under the given image name.
+// Any existing entry with the same name is replaced.
+func (l *Layout) Tag(name string, desc ocispec.Descriptor) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	index, err := l.readIndex()
+	if err != nil {
+		return err
+	}
+	manifests := index.Manifests[:0]
+	for _, m := range index.Manifests {
+		if m.Annotations[annotationImageName] != name {
+			manifests = append(manifests, m)
+		}
+	}
+	entry := ocispec.Descriptor{
+		MediaType: desc.MediaType,
+		Digest:    desc.Digest,
+		Size:      desc.Size,
+		Annotations: map[string]string{
+			annotationImageName:       name,
+			ocispec.AnnotationRefName: refName(name),
+		},
+	}
+	index.Manifests = append(manifests, entry)
+	sort.SliceStable(index.Manifests, func(i, j int) bool {
+		return index.Manifests[i].Annotations[annotationImageName] < index.Manifests[j].Annotations[annotationImageName]
+	})
+	dt, err := json.Marshal(index)
+	if err != nil {
+		return errors.Wrap(err, "marshal index.json")
+	}
+	err = os.WriteFile(filepath.Join(l.dir, indexFile), dt, 0644)
+	if err != nil {
+		return errors.Wrap(err, "write index.json")
+	}
+	return nil
+}
+
+func (l *Layout) readIndex() (*ocispec.Index, error) {
+	index := &ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+	}
+	dt, err := os.ReadFile(filepath.Join(l.dir, indexFile))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read index.json")
+	}
+	err = json.Unmarshal(dt, index)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal index.json")
+	}
+	return index, nil
+}
+
+// refName returns the tag of the image name, which is how tools such as skopeo refer to images within a layout.
+func refName(name string) string {
+	i := strings.LastIndex(name, ":")
+	if i == -1 || strings.Contains(name[i:], "/") {
+		return name
+	}
+	return name[i+1:]
+}
+
+type dockerManifestEntry struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// WriteTar writes the layout as a tarball. For every tagged single-platform image, a docker manifest.json
+// entry is also written, such that the tarball can be loaded via docker load.
+func (l *Layout) WriteTar(w io.Writer) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	index, err := l.readIndex()
+	if err != nil {
+		return err
+	}
+	var dockerManifest []dockerManifestEntry
+	for _, desc := range index.Manifests {
+		if desc.MediaType != ocispec.MediaTypeImageManifest && desc.MediaType != images.MediaTypeDockerSchema2Manifest {
+			continue
+		}
+		var manifest ocispec.Manifest
+		err = l.readJSONBlob(desc.Digest, &manifest)
+		if err != nil {
+			return err
+		}
+		entry := dockerManifestEntry{
+			Config:   blobName(manifest.Config.Digest),
+			RepoTags: []string{desc.Annotations[annotationImageName]},
+		}
+		for _, layer := range manifest.Layers {
+			entry.Layers = append(entry.Layers, blobName(layer.Digest))
+		}
+		dockerManifest = append(dockerManifest, entry)
+	}
+
+	tw := tar.NewWriter(w)
+	var names []string
+	err = filepath.Walk(l.dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(l.dir, p)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "walk %s", l.dir)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err = writeTarFile(tw, name, filepath.Join(l.dir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+	}
+	if len(dockerManifest) > 0 {
+		dt, err := json.Marshal(dockerManifest)
+		if err != nil {
+			return errors.Wrap(err, "marshal manifest.json")
+		}
+		err = tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(dt)), Typeflag: tar.TypeReg})
+		if err != nil {
+			return errors.Wrap(err, "write manifest.json header")
+		}
+		_, err = tw.Write(dt)
+		if err != nil {
+			return errors.Wrap(err, "write manifest.json")
+		}
+	}
+	return tw.Close()
+}
+
+func blobName(dgst digest.Digest) string {
+	return path.Join(blobsDir, dgst.Algorithm().String(), dgst.Encoded())
+}
+
+func writeTarFile(tw *tar.Writer, name, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", p)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "stat %s", p)
+	}
+	err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: fi.Size(), Typeflag: tar.TypeReg})
+	if err != nil {
+		return errors.Wrapf(err, "write tar header for %s", name)
+	}
+	_, err = io.Copy(tw, f)
+	if err != nil {
+		return errors.Wrapf(err, "write %s to tar", name)
+	}
+	return nil
+}
+
+// WriteTarFile writes the layout as a tarball at dest. See WriteTar.
+func (l *Layout) WriteTarFile(dest string) (retErr error) {
+	err := os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return errors.Wrapf(err, "mkdir %s", filepath.Dir(dest))
+	}
+	f, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "create %s", dest)
+	}
+	defer func() {
+		if retErr != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	err = l.WriteTar(f)
+	if err != nil {
+		return err
+	}
+	err = f.Chmod(0644)
+	if err != nil {
+		return errors.Wrapf(err, "chmod %s", dest)
+	}
+	err = f.Close()
+	if err != nil {
+		return errors.Wrapf(err, "close %s", dest)
+	}
+	return os.Rename(f.Name(), dest)
+}
+
+// Images returns the images tagged in the layout, by image name.
+func (l *Layout) Images() (map[string]ocispec.Descriptor, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	index, err := l.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]ocispec.Descriptor)
+	for _, m := range index.Manifests {
+		if name, ok := m.Annotations[annotationImageName]; ok {
+			ret[name] = m
+		}
+	}
+	return ret, nil
+}
+
+// Manifests returns the single-platform image manifests of the given manifest or index, by platform.
+func (l *Layout) Manifests(desc ocispec.Descriptor) (map[string]ocispec.Manifest, error) {
+	ret := make(map[string]ocispec.Manifest)
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest, images.MediaTypeDockerSchema2Manifest:
+		var manifest ocispec.Manifest
+		err := l.readJSONBlob(desc.Digest, &manifest)
+		if err != nil {
+			return nil, err
+		}
+		var platform ocispec.Platform
+		err = l.readJSONBlob(manifest.Config.Digest, &platform)
+		if err != nil {
+			return nil, err
+		}
+		ret[platformString(&platform)] = manifest
+	case ocispec.MediaTypeImageIndex, images.MediaTypeDockerSchema2ManifestList:
+		children, err := l.children(desc)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			manifests, err := l.Manifests(child)
+			if err != nil {
+				return nil, err
+			}
+			for p, m := range manifests {
+				ret[p] = m
+			}
+		}
+	}
+	return ret, nil
+}
+
+// OpenBlob opens the blob with the given digest.
+func (l *Layout) OpenBlob(dgst digest.Digest) (io.ReadCloser, error) {
+	f, err := os.Open(l.blobPath(dgst))
+	if err != nil {
+		return nil, errors.Wrapf(err, "open blob %s", dgst)
+	}
+	return f, nil
+}
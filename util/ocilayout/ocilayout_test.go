@@ -0,0 +1,106 @@
+package ocilayout
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	. "github.com/stretchr/testify/assert"
+)
+
+// imageTar returns an image tarball, similar to the ones produced by buildkit, with a single manifest.
+func imageTar(t *testing.T, arch string) ([]byte, ocispec.Descriptor) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	addBlob := func(mediaType string, dt []byte) ocispec.Descriptor {
+		desc := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(dt), Size: int64(len(dt))}
+		NoError(t, tw.WriteHeader(&tar.Header{Name: blobName(desc.Digest), Mode: 0644, Size: desc.Size, Typeflag: tar.TypeReg}))
+		_, err := tw.Write(dt)
+		NoError(t, err)
+		return desc
+	}
+	config := addBlob(ocispec.MediaTypeImageConfig, []byte(`{"architecture":"`+arch+`","os":"linux"}`))
+	layer := addBlob(ocispec.MediaTypeImageLayerGzip, []byte("layer-"+arch))
+	dt, err := json.Marshal(ocispec.Manifest{MediaType: ocispec.MediaTypeImageManifest, Config: config, Layers: []ocispec.Descriptor{layer}})
+	NoError(t, err)
+	manifest := addBlob(ocispec.MediaTypeImageManifest, dt)
+	dt, err = json.Marshal(ocispec.Index{Manifests: []ocispec.Descriptor{manifest}})
+	NoError(t, err)
+	NoError(t, tw.WriteHeader(&tar.Header{Name: indexFile, Mode: 0644, Size: int64(len(dt)), Typeflag: tar.TypeReg}))
+	_, err = tw.Write(dt)
+	NoError(t, err)
+	NoError(t, tw.Close())
+	return buf.Bytes(), manifest
+}
+
+func TestImportIndexAndTag(t *testing.T) {
+	staging, err := Open(t.TempDir())
+	NoError(t, err)
+	var manifests []ocispec.Descriptor
+	for _, arch := range []string{"amd64", "arm64"} {
+		dt, want := imageTar(t, arch)
+		descs, err := staging.Import(bytes.NewReader(dt))
+		NoError(t, err)
+		Equal(t, []ocispec.Descriptor{want}, descs)
+		manifests = append(manifests, descs...)
+	}
+	indexDesc, err := staging.AddIndex(manifests)
+	NoError(t, err)
+
+	dst, err := Open(filepath.Join(t.TempDir(), "out"))
+	NoError(t, err)
+	NoError(t, staging.Copy(dst, indexDesc))
+	NoError(t, dst.Tag("docker.io/example/app:v1", indexDesc))
+	NoError(t, dst.Tag("docker.io/example/app:v1", indexDesc))
+
+	index, err := dst.readIndex()
+	NoError(t, err)
+	if Len(t, index.Manifests, 1) {
+		Equal(t, "v1", index.Manifests[0].Annotations[ocispec.AnnotationRefName])
+	}
+	var list ocispec.Index
+	NoError(t, dst.readJSONBlob(indexDesc.Digest, &list))
+	if Len(t, list.Manifests, 2) {
+		Equal(t, "amd64", list.Manifests[0].Platform.Architecture)
+		Equal(t, "arm64", list.Manifests[1].Platform.Architecture)
+	}
+	_, err = os.Stat(filepath.Join(dst.Dir(), ocispec.ImageLayoutFile))
+	NoError(t, err)
+}
+
+func TestWriteTar(t *testing.T) {
+	l, err := Open(t.TempDir())
+	NoError(t, err)
+	dt, manifest := imageTar(t, "amd64")
+	_, err = l.Import(bytes.NewReader(dt))
+	NoError(t, err)
+	NoError(t, l.Tag("example/app:latest", manifest))
+
+	var buf bytes.Buffer
+	NoError(t, l.WriteTar(&buf))
+	tr := tar.NewReader(&buf)
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		NoError(t, err)
+		files[hdr.Name], err = io.ReadAll(tr)
+		NoError(t, err)
+	}
+	Contains(t, files, ocispec.ImageLayoutFile)
+	Contains(t, files, indexFile)
+	var dockerManifest []dockerManifestEntry
+	NoError(t, json.Unmarshal(files["manifest.json"], &dockerManifest))
+	if Len(t, dockerManifest, 1) {
+		Equal(t, []string{"example/app:latest"}, dockerManifest[0].RepoTags)
+		Contains(t, files, dockerManifest[0].Config)
+	}
+}
@@ -0,0 +1,265 @@
+// Package provenance generates SLSA provenance attestations for the outputs of a build.
+package provenance
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/earthly/earthly/domain"
+	"github.com/earthly/earthly/states/dedup"
+	"github.com/earthly/earthly/util/gitutil"
+	"github.com/earthly/earthly/util/ociartifact"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+const (
+	// PredicateType is the in-toto predicate type of SLSA provenance.
+	PredicateType = "https://slsa.dev/provenance/v0.2"
+	// BuildType is the SLSA build type of Earthly builds.
+	BuildType = "https://earthly.dev/Earthfile@v1"
+	// FileExtension is the extension of provenance statements written to the host.
+	FileExtension = ".intoto.json"
+
+	builderIDPrefix = "https://earthly.dev/earthly@"
+)
+
+// Predicate is a SLSA v0.2 provenance predicate.
+type Predicate struct {
+	Builder    Builder    `json:"builder"`
+	BuildType  string     `json:"buildType"`
+	Invocation Invocation `json:"invocation"`
+	Metadata   Metadata   `json:"metadata"`
+	Materials  []Material `json:"materials,omitempty"`
+}
+
+// Builder identifies the builder which produced the outputs.
+type Builder struct {
+	ID string `json:"id"`
+}
+
+// Invocation describes how the build was invoked.
+type Invocation struct {
+	ConfigSource ConfigSource           `json:"configSource"`
+	Parameters   Parameters             `json:"parameters"`
+	Environment  map[string]interface{} `json:"environment,omitempty"`
+}
+
+// ConfigSource identifies the Earthfile target which was built.
+type ConfigSource struct {
+	URI        string            `json:"uri,omitempty"`
+	Digest     map[string]string `json:"digest,omitempty"`
+	EntryPoint string            `json:"entryPoint"`
+}
+
+// Parameters are the inputs of the target which was built.
+type Parameters struct {
+	BuildArgs       map[string]string `json:"buildArgs,omitempty"`
+	Platform        string            `json:"platform,omitempty"`
+	AllowPrivileged bool              `json:"allowPrivileged,omitempty"`
+}
+
+// Metadata holds additional information about the build.
+type Metadata struct {
+	BuildStartedOn  string       `json:"buildStartedOn"`
+	BuildFinishedOn string       `json:"buildFinishedOn"`
+	Completeness    Completeness `json:"completeness"`
+	Reproducible    bool         `json:"reproducible"`
+}
+
+// Completeness states which parts of the predicate are known to be complete.
+type Completeness struct {
+	Parameters  bool `json:"parameters"`
+	Environment bool `json:"environment"`
+	Materials   bool `json:"materials"`
+}
+
+// Material is an input of the build, such as a base image.
+type Material struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// TargetInputer provides the inputs of a target, which are only known once it has been converted.
+type TargetInputer interface {
+	TargetInput() dedup.TargetInput
+}
+
+type targetInfo struct {
+	target  domain.Target
+	gitMeta *gitutil.GitMetadata
+	input   TargetInputer
+}
+
+// Collector is a thread-safe store of the provenance information gathered during a build.
+type Collector struct {
+	mu         sync.Mutex
+	version    string
+	started    time.Time
+	targets    map[string]targetInfo // salt -> target
+	baseImages map[string]Material   // uri -> material
+}
+
+// NewCollector returns a new Collector for a build of the given Earthly version, started at started.
+func NewCollector(version string, started time.Time) *Collector {
+	return &Collector{
+		version:    version,
+		started:    started,
+		targets:    make(map[string]targetInfo),
+		baseImages: make(map[string]Material),
+	}
+}
+
+// AddTarget registers a target of the build, identified by its salt.
+func (c *Collector) AddTarget(salt string, target domain.Target, gitMeta *gitutil.GitMetadata, input TargetInputer) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets[salt] = targetInfo{
+		target:  target,
+		gitMeta: gitMeta,
+		input:   input,
+	}
+}
+
+// AddBaseImage registers a base image of the build, as resolved to its digest.
+func (c *Collector) AddBaseImage(imageName, platform string, dgst digest.Digest) {
+	if c == nil || dgst == "" {
+		return
+	}
+	uri := "pkg:docker/" + imageName
+	if platform != "" {
+		uri += "?platform=" + url.QueryEscape(platform)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.baseImages[uri] = Material{
+		URI:    uri,
+		Digest: map[string]string{dgst.Algorithm().String(): dgst.Encoded()},
+	}
+}
+
+// Target returns the target registered for the salt.
+func (c *Collector) Target(salt string) (domain.Target, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, ok := c.targets[salt]
+	return info.target, ok
+}
+
+// Predicate returns the serialized provenance predicate of the outputs of the target identified by salt.
+func (c *Collector) Predicate(salt string, finished time.Time) ([]byte, error) {
+	c.mu.Lock()
+	info, ok := c.targets[salt]
+	var materials []Material
+	for _, m := range c.baseImages {
+		materials = append(materials, m)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, errors.Errorf("no provenance information for target with salt %s", salt)
+	}
+	sort.Slice(materials, func(i, j int) bool {
+		return materials[i].URI < materials[j].URI
+	})
+
+	ti := info.input.TargetInput()
+	params := Parameters{
+		Platform:        ti.Platform,
+		AllowPrivileged: ti.AllowPrivileged,
+	}
+	for _, bai := range ti.BuildArgs {
+		if params.BuildArgs == nil {
+			params.BuildArgs = make(map[string]string)
+		}
+		params.BuildArgs[bai.Name] = bai.ConstantValue
+	}
+	p := Predicate{
+		Builder:   Builder{ID: builderIDPrefix + c.version},
+		BuildType: BuildType,
+		Invocation: Invocation{
+			ConfigSource: ConfigSource{EntryPoint: info.target.StringCanonical()},
+			Parameters:   params,
+			Environment: map[string]interface{}{
+				"earthlyVersion": c.version,
+			},
+		},
+		Metadata: Metadata{
+			BuildStartedOn:  c.started.UTC().Format(time.RFC3339),
+			BuildFinishedOn: finished.UTC().Format(time.RFC3339),
+		},
+	}
+	if gm := info.gitMeta; gm != nil && gm.GitURL != "" {
+		uri := "git+https://" + gm.GitURL
+		var dgst map[string]string
+		if gm.Hash != "" {
+			dgst = map[string]string{"sha1": gm.Hash}
+		}
+		p.Invocation.ConfigSource.URI = uri
+		p.Invocation.ConfigSource.Digest = dgst
+		p.Invocation.Environment["git"] = map[string]interface{}{
+			"branch":    gm.Branch,
+			"tags":      gm.Tags,
+			"timestamp": gm.Timestamp,
+			"relDir":    gm.RelDir,
+		}
+		materials = append([]Material{{URI: uri, Digest: dgst}}, materials...)
+	}
+	p.Materials = materials
+	dt, err := json.Marshal(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal provenance predicate")
+	}
+	return dt, nil
+}
+
+// ImageLocalPath returns the host path of the provenance statement of a locally output image.
+func ImageLocalPath(earthfileDir, dockerTag string) string {
+	name := strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(dockerTag)
+	return path.Join(earthfileDir, "provenance", name+FileExtension)
+}
+
+// ArtifactLocalPath returns the host path of the provenance statement of an artifact output at artifactPath.
+func ArtifactLocalPath(artifactPath string) string {
+	return strings.TrimSuffix(artifactPath, "/") + FileExtension
+}
+
+// FileSubjects returns the in-toto subjects of the files output at localPath, which is either a file or a dir.
+func FileSubjects(localPath string) ([]ociartifact.InTotoSubject, error) {
+	var subjects []ociartifact.InTotoSubject
+	err := filepath.Walk(localPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return errors.Wrapf(err, "open %s", p)
+		}
+		defer f.Close()
+		dgst, err := digest.SHA256.FromReader(f)
+		if err != nil {
+			return errors.Wrapf(err, "digest %s", p)
+		}
+		subjects = append(subjects, ociartifact.InTotoSubject{
+			Name:   filepath.ToSlash(p),
+			Digest: map[string]string{dgst.Algorithm().String(): dgst.Encoded()},
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "walk %s", localPath)
+	}
+	return subjects, nil
+}
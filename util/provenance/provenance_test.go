@@ -0,0 +1,67 @@
+package provenance
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/earthly/earthly/domain"
+	"github.com/earthly/earthly/states/dedup"
+	"github.com/earthly/earthly/util/gitutil"
+	"github.com/opencontainers/go-digest"
+	. "github.com/stretchr/testify/assert"
+)
+
+type fakeInput dedup.TargetInput
+
+func (fi fakeInput) TargetInput() dedup.TargetInput {
+	return dedup.TargetInput(fi)
+}
+
+func TestPredicate(t *testing.T) {
+	c := NewCollector("v0.6.25", time.Unix(1600000000, 0))
+	target := domain.Target{LocalPath: "./app", Target: "docker"}
+	gitMeta := &gitutil.GitMetadata{GitURL: "github.com/earthly/earthly", Hash: "abc123", Branch: []string{"main"}}
+	c.AddTarget("salt", target, gitMeta, fakeInput{
+		TargetCanonical: target.StringCanonical(),
+		BuildArgs:       []dedup.BuildArgInput{{Name: "VERSION", ConstantValue: "1.0"}},
+		Platform:        "linux/amd64",
+	})
+	c.AddBaseImage("docker.io/library/alpine:3.16", "linux/amd64", digest.FromString("alpine"))
+	c.AddBaseImage("docker.io/library/alpine:3.16", "linux/amd64", digest.FromString("alpine"))
+
+	dt, err := c.Predicate("salt", time.Unix(1600000060, 0))
+	if !NoError(t, err) {
+		return
+	}
+	var p Predicate
+	NoError(t, json.Unmarshal(dt, &p))
+	Equal(t, "https://earthly.dev/earthly@v0.6.25", p.Builder.ID)
+	Equal(t, "./app+docker", p.Invocation.ConfigSource.EntryPoint)
+	Equal(t, "git+https://github.com/earthly/earthly", p.Invocation.ConfigSource.URI)
+	Equal(t, map[string]string{"VERSION": "1.0"}, p.Invocation.Parameters.BuildArgs)
+	Equal(t, "2020-09-13T12:27:40Z", p.Metadata.BuildFinishedOn)
+	Len(t, p.Materials, 2)
+	Equal(t, "pkg:docker/docker.io/library/alpine:3.16?platform=linux%2Famd64", p.Materials[1].URI)
+
+	_, err = c.Predicate("unknown", time.Now())
+	Error(t, err)
+}
+
+func TestFileSubjects(t *testing.T) {
+	dir := t.TempDir()
+	NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	NoError(t, os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("a"), 0644))
+	NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644))
+
+	subjects, err := FileSubjects(dir)
+	if !NoError(t, err) {
+		return
+	}
+	Len(t, subjects, 2)
+	Equal(t, filepath.ToSlash(filepath.Join(dir, "b.txt")), subjects[0].Name)
+	Equal(t, digest.FromString("b").Encoded(), subjects[0].Digest["sha256"])
+	Equal(t, "out.intoto.json", ArtifactLocalPath("out/"))
+}
@@ -0,0 +1,212 @@
+// Package pruneutil maps the options of earthly prune onto buildkit prune options, and estimates what a
+// prune would reclaim for its dry-run mode.
+package pruneutil
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/moby/buildkit/client"
+	"github.com/pkg/errors"
+)
+
+// filterKeys are the fields of a cache record which buildkit can filter prunes on.
+var filterKeys = map[string]bool{
+	"id":        true,
+	"type":      true,
+	"mutable":   true,
+	"immutable": true,
+	"shared":    true,
+	"private":   true,
+}
+
+var recordTypes = map[client.UsageRecordType]bool{
+	client.UsageRecordTypeInternal:    true,
+	client.UsageRecordTypeFrontend:    true,
+	client.UsageRecordTypeLocalSource: true,
+	client.UsageRecordTypeGitCheckout: true,
+	client.UsageRecordTypeCacheMount:  true,
+	client.UsageRecordTypeRegular:     true,
+}
+
+// Options are the options of a prune.
+type Options struct {
+	All          bool
+	KeepDuration time.Duration
+	KeepBytes    int64
+	// Filters are buildkit filter expressions (e.g. type==exec.cachemount), which must all match.
+	Filters []string
+}
+
+// ParseFilter converts a filter of the form key=value, key==value, key!=value or key~=value (a regexp), or
+// a lone boolean key such as mutable, into a buildkit filter expression.
+func ParseFilter(f string) (string, error) {
+	if strings.Contains(f, ",") {
+		return "", errors.Errorf("invalid filter %s: filters cannot contain commas; repeat --filter instead", f)
+	}
+	i := strings.IndexAny(f, "=!~")
+	if i == -1 {
+		if !filterKeys[f] {
+			return "", errors.Errorf("invalid filter %s: unknown key", f)
+		}
+		return f, nil
+	}
+	key, rest := f[:i], f[i:]
+	var op, value string
+	switch {
+	case strings.HasPrefix(rest, "=="), strings.HasPrefix(rest, "!="), strings.HasPrefix(rest, "~="):
+		op, value = rest[:2], rest[2:]
+	case strings.HasPrefix(rest, "="):
+		op, value = "==", rest[1:]
+	default:
+		return "", errors.Errorf("invalid filter %s: expected key=value", f)
+	}
+	if !filterKeys[key] {
+		return "", errors.Errorf("invalid filter %s: unknown key %s", f, key)
+	}
+	if value == "" {
+		return "", errors.Errorf("invalid filter %s: missing value", f)
+	}
+	if key == "type" && op != "~=" && !recordTypes[client.UsageRecordType(value)] {
+		return "", errors.Errorf("invalid filter %s: unknown record type %s", f, value)
+	}
+	return key + op + value, nil
+}
+
+// filter returns the buildkit filter of the options; buildkit ANDs the comma-separated expressions of a filter.
+func (o Options) filter() []string {
+	if len(o.Filters) == 0 {
+		return nil
+	}
+	return []string{strings.Join(o.Filters, ",")}
+}
+
+// PruneOptions returns the buildkit client options of the prune.
+func (o Options) PruneOptions() []client.PruneOption {
+	var opts []client.PruneOption
+	if o.All {
+		opts = append(opts, client.PruneAll)
+	}
+	if o.KeepDuration != 0 || o.KeepBytes != 0 {
+		opts = append(opts, client.WithKeepOpt(o.KeepDuration, o.KeepBytes))
+	}
+	if f := o.filter(); f != nil {
+		opts = append(opts, client.WithFilter(f))
+	}
+	return opts
+}
+
+// DiskUsageOptions returns the buildkit client options which list the records matched by the filters.
+func (o Options) DiskUsageOptions() []client.DiskUsageOption {
+	if f := o.filter(); f != nil {
+		return []client.DiskUsageOption{client.WithFilter(f)}
+	}
+	return nil
+}
+
+// Plan returns the records a prune would remove, following the selection of buildkit: records is the
+// whole cache, and candidates are the records matched by the filters. It is an estimate, as buildkit also
+// removes the parents of the removed records once they are no longer referenced.
+func Plan(records, candidates []*client.UsageInfo, o Options, now time.Time) []*client.UsageInfo {
+	var total int64
+	for _, r := range records {
+		if !r.Shared {
+			total += r.Size
+		}
+	}
+	if o.KeepBytes != 0 && total < o.KeepBytes {
+		return nil
+	}
+	cutOff := now.Add(-o.KeepDuration)
+	var selected []*client.UsageInfo
+	for _, r := range candidates {
+		if r.InUse {
+			continue
+		}
+		if !o.All && (r.RecordType == client.UsageRecordTypeInternal || r.RecordType == client.UsageRecordTypeFrontend || r.Shared) {
+			continue
+		}
+		if o.KeepDuration != 0 && r.LastUsedAt != nil && r.LastUsedAt.After(cutOff) {
+			continue
+		}
+		selected = append(selected, r)
+	}
+	if o.KeepBytes == 0 {
+		return selected
+	}
+	// Buildkit removes the least recently used records one at a time, until the cache fits in the budget.
+	sort.SliceStable(selected, func(i, j int) bool {
+		if selected[i].LastUsedAt == nil {
+			return selected[j].LastUsedAt != nil
+		}
+		if selected[j].LastUsedAt == nil {
+			return false
+		}
+		return selected[i].LastUsedAt.Before(*selected[j].LastUsedAt)
+	})
+	var ret []*client.UsageInfo
+	for _, r := range selected {
+		if total < o.KeepBytes {
+			break
+		}
+		ret = append(ret, r)
+		total -= r.Size
+	}
+	return ret
+}
+
+// TypeTotal is the number and size of the reclaimed records of a type.
+type TypeTotal struct {
+	Type  client.UsageRecordType
+	Count int
+	Size  int64
+}
+
+// Summary totals the reclaimed records per record type.
+type Summary struct {
+	totals map[client.UsageRecordType]*TypeTotal
+	size   int64
+}
+
+// NewSummary returns a new, empty Summary.
+func NewSummary() *Summary {
+	return &Summary{
+		totals: make(map[client.UsageRecordType]*TypeTotal),
+	}
+}
+
+// Add adds a reclaimed record to the summary.
+func (s *Summary) Add(recordType client.UsageRecordType, size int64) {
+	if recordType == "" {
+		recordType = client.UsageRecordTypeRegular
+	}
+	t, ok := s.totals[recordType]
+	if !ok {
+		t = &TypeTotal{Type: recordType}
+		s.totals[recordType] = t
+	}
+	t.Count++
+	t.Size += size
+	s.size += size
+}
+
+// Size returns the total reclaimed size.
+func (s *Summary) Size() int64 {
+	return s.size
+}
+
+// Totals returns the totals per record type, largest first.
+func (s *Summary) Totals() []TypeTotal {
+	ret := make([]TypeTotal, 0, len(s.totals))
+	for _, t := range s.totals {
+		ret = append(ret, *t)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Size != ret[j].Size {
+			return ret[i].Size > ret[j].Size
+		}
+		return ret[i].Type < ret[j].Type
+	})
+	return ret
+}
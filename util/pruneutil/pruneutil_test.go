@@ -0,0 +1,78 @@
+package pruneutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/moby/buildkit/client"
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		in   string
+		out  string
+		fail bool
+	}{
+		{in: "type=exec.cachemount", out: "type==exec.cachemount"},
+		{in: "type!=regular", out: "type!=regular"},
+		{in: "id~=^abc", out: "id~=^abc"},
+		{in: "mutable", out: "mutable"},
+		{in: "type=foo", fail: true},
+		{in: "description=foo", fail: true},
+		{in: "id=", fail: true},
+		{in: "id==a,type==regular", fail: true},
+	}
+	for _, tt := range tests {
+		out, err := ParseFilter(tt.in)
+		if tt.fail {
+			Error(t, err, tt.in)
+			continue
+		}
+		NoError(t, err, tt.in)
+		Equal(t, tt.out, out)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	now := time.Unix(100000, 0)
+	ago := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+	records := []*client.UsageInfo{
+		{ID: "old", Size: 100, RecordType: client.UsageRecordTypeRegular, LastUsedAt: ago(100 * time.Hour)},
+		{ID: "older", Size: 50, RecordType: client.UsageRecordTypeCacheMount, LastUsedAt: ago(200 * time.Hour)},
+		{ID: "new", Size: 10, RecordType: client.UsageRecordTypeRegular, LastUsedAt: ago(time.Hour)},
+		{ID: "inuse", Size: 10, InUse: true, LastUsedAt: ago(300 * time.Hour)},
+		{ID: "internal", Size: 10, RecordType: client.UsageRecordTypeInternal, LastUsedAt: ago(300 * time.Hour)},
+	}
+	ids := func(infos []*client.UsageInfo) []string {
+		var ret []string
+		for _, info := range infos {
+			ret = append(ret, info.ID)
+		}
+		return ret
+	}
+
+	Equal(t, []string{"old", "older", "new"}, ids(Plan(records, records, Options{}, now)))
+	Equal(t, []string{"old", "older", "new", "internal"}, ids(Plan(records, records, Options{All: true}, now)))
+	Equal(t, []string{"old", "older"}, ids(Plan(records, records, Options{KeepDuration: 72 * time.Hour}, now)))
+	Equal(t, []string{"older"}, ids(Plan(records, records[1:2], Options{KeepDuration: 72 * time.Hour}, now)))
+	// The total is 180; the least recently used records are removed until it is below 100.
+	Equal(t, []string{"older", "old"}, ids(Plan(records, records, Options{KeepBytes: 100}, now)))
+	Equal(t, []string{"older"}, ids(Plan(records, records, Options{KeepBytes: 150}, now)))
+	Empty(t, Plan(records, records, Options{KeepBytes: 1000}, now))
+}
+
+func TestSummary(t *testing.T) {
+	s := NewSummary()
+	s.Add(client.UsageRecordTypeCacheMount, 10)
+	s.Add("", 30)
+	s.Add(client.UsageRecordTypeCacheMount, 5)
+	Equal(t, int64(45), s.Size())
+	Equal(t, []TypeTotal{
+		{Type: client.UsageRecordTypeRegular, Count: 1, Size: 30},
+		{Type: client.UsageRecordTypeCacheMount, Count: 2, Size: 15},
+	}, s.Totals())
+}
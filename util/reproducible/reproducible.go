@@ -0,0 +1,379 @@
+package reproducible
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/earthly/earthly/util/ocilayout"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// File describes a regular file or a symlink of a build output.
+type File struct {
+	Size    int64
+	ModTime time.Time
+	Digest  digest.Digest // of the contents of regular files, or of the target of symlinks
+}
+
+// Snapshot holds the files of a build output, by their path within the output.
+type Snapshot map[string]File
+
+// Image holds the layers of a single-platform output image.
+type Image struct {
+	Config digest.Digest
+	Layers []digest.Digest
+}
+
+// Outputs holds the outputs of a build: the artifacts saved locally and the images written into an OCI image
+// layout.
+type Outputs struct {
+	Artifacts map[string]Snapshot // by local path
+	Images    map[string]Image    // by image name and platform
+	layout    *ocilayout.Layout
+}
+
+// Collect snapshots the given local artifact paths and reads the images of the OCI image layout imageDir.
+func Collect(artifactPaths []string, imageDir string) (*Outputs, error) {
+	o := &Outputs{
+		Artifacts: make(map[string]Snapshot),
+		Images:    make(map[string]Image),
+	}
+	for _, p := range artifactPaths {
+		s, err := SnapshotPath(p)
+		if err != nil {
+			return nil, err
+		}
+		o.Artifacts[p] = s
+	}
+	if imageDir == "" {
+		return o, nil
+	}
+	var err error
+	o.layout, err = ocilayout.Open(imageDir)
+	if err != nil {
+		return nil, err
+	}
+	imgs, err := o.layout.Images()
+	if err != nil {
+		return nil, err
+	}
+	for name, desc := range imgs {
+		manifests, err := o.layout.Manifests(desc)
+		if err != nil {
+			return nil, err
+		}
+		for platform, m := range manifests {
+			img := Image{Config: m.Config.Digest}
+			for _, l := range m.Layers {
+				img.Layers = append(img.Layers, l.Digest)
+			}
+			o.Images[fmt.Sprintf("%s (%s)", name, platform)] = img
+		}
+	}
+	return o, nil
+}
+
+// SnapshotPath snapshots the file or the dir at p.
+func SnapshotPath(p string) (Snapshot, error) {
+	s := make(Snapshot)
+	err := filepath.WalkDir(p, func(fp string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(p, fp)
+		if err != nil {
+			return err
+		}
+		f, err := SnapshotFile(fp, fi)
+		if err != nil {
+			return err
+		}
+		s[filepath.ToSlash(rel)] = f
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "snapshot %s", p)
+	}
+	return s, nil
+}
+
+// SnapshotFile snapshots the file at p, whose info is fi.
+func SnapshotFile(p string, fi fs.FileInfo) (File, error) {
+	f := File{Size: fi.Size(), ModTime: fi.ModTime()}
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(p)
+		if err != nil {
+			return File{}, err
+		}
+		f.Digest = digest.FromString(target)
+	} else if fi.Mode().IsRegular() {
+		rf, err := os.Open(p)
+		if err != nil {
+			return File{}, err
+		}
+		defer rf.Close()
+		f.Digest, err = digest.FromReader(rf)
+		if err != nil {
+			return File{}, err
+		}
+	}
+	return f, nil
+}
+
+// SnapshotTar snapshots the files of a (possibly gzip-compressed) tarball, such as an image layer, on top of
+// base. Whiteout entries remove the files of base that they refer to.
+func SnapshotTar(r io.Reader, base Snapshot) (Snapshot, error) {
+	s := make(Snapshot, len(base))
+	for p, f := range base {
+		s[p] = f
+	}
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	var tr *tar.Reader
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, errors.Wrap(err, "read gzip")
+		}
+		defer gr.Close()
+		tr = tar.NewReader(gr)
+	} else {
+		tr = tar.NewReader(br)
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read tar")
+		}
+		p := path.Clean("/" + hdr.Name)
+		dir, base := path.Split(p)
+		switch {
+		case base == whiteoutOpaque:
+			removePrefix(s, dir)
+			continue
+		case strings.HasPrefix(base, whiteoutPrefix):
+			removed := path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+			delete(s, removed)
+			removePrefix(s, removed+"/")
+			continue
+		}
+		f := File{Size: hdr.Size, ModTime: hdr.ModTime}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			f.Digest, err = digest.FromReader(tr)
+			if err != nil {
+				return nil, errors.Wrapf(err, "read %s", hdr.Name)
+			}
+		case tar.TypeSymlink, tar.TypeLink:
+			f.Digest = digest.FromString(hdr.Linkname)
+		default:
+			continue
+		}
+		s[p] = f
+	}
+	return s, nil
+}
+
+func removePrefix(s Snapshot, prefix string) {
+	for p := range s {
+		if strings.HasPrefix(p, prefix) {
+			delete(s, p)
+		}
+	}
+}
+
+// FileDiff describes a file which differs between two snapshots. Either side is nil if the file is missing.
+type FileDiff struct {
+	Path string
+	A, B *File
+}
+
+func (d FileDiff) String() string {
+	switch {
+	case d.A == nil:
+		return fmt.Sprintf("%s: only in the second build (size %d, mtime %s, %s)", d.Path, d.B.Size, formatTime(d.B.ModTime), d.B.Digest)
+	case d.B == nil:
+		return fmt.Sprintf("%s: only in the first build (size %d, mtime %s, %s)", d.Path, d.A.Size, formatTime(d.A.ModTime), d.A.Digest)
+	}
+	var diffs []string
+	if d.A.Size != d.B.Size {
+		diffs = append(diffs, fmt.Sprintf("size %d != %d", d.A.Size, d.B.Size))
+	}
+	if !d.A.ModTime.Equal(d.B.ModTime) {
+		diffs = append(diffs, fmt.Sprintf("mtime %s != %s", formatTime(d.A.ModTime), formatTime(d.B.ModTime)))
+	}
+	if d.A.Digest != d.B.Digest {
+		diffs = append(diffs, fmt.Sprintf("content %s != %s", d.A.Digest, d.B.Digest))
+	}
+	return fmt.Sprintf("%s: %s", d.Path, strings.Join(diffs, ", "))
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Diff returns the files which differ between the snapshots a and b, sorted by path.
+func Diff(a, b Snapshot) []FileDiff {
+	var ret []FileDiff
+	for p, fa := range a {
+		fa := fa
+		fb, ok := b[p]
+		if !ok {
+			ret = append(ret, FileDiff{Path: p, A: &fa})
+			continue
+		}
+		if fa.Size != fb.Size || !fa.ModTime.Equal(fb.ModTime) || fa.Digest != fb.Digest {
+			ret = append(ret, FileDiff{Path: p, A: &fa, B: &fb})
+		}
+	}
+	for p, fb := range b {
+		fb := fb
+		if _, ok := a[p]; !ok {
+			ret = append(ret, FileDiff{Path: p, B: &fb})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Path < ret[j].Path
+	})
+	return ret
+}
+
+// Mismatch describes an output which differs between two builds.
+type Mismatch struct {
+	Output  string   // e.g. "artifact ./out" or "image foo:latest (linux/amd64)"
+	Reasons []string // e.g. the differing layer digests
+	Files   []FileDiff
+}
+
+// Compare compares the outputs of two builds of the same target, and returns the outputs which differ.
+func Compare(a, b *Outputs) ([]Mismatch, error) {
+	var ret []Mismatch
+	for _, p := range unionKeys(a.Artifacts, b.Artifacts) {
+		sa, okA := a.Artifacts[p]
+		sb, okB := b.Artifacts[p]
+		output := "artifact " + p
+		switch {
+		case !okA:
+			ret = append(ret, Mismatch{Output: output, Reasons: []string{"only output by the second build"}})
+		case !okB:
+			ret = append(ret, Mismatch{Output: output, Reasons: []string{"only output by the first build"}})
+		default:
+			if diffs := Diff(sa, sb); len(diffs) > 0 {
+				ret = append(ret, Mismatch{Output: output, Files: diffs})
+			}
+		}
+	}
+
+	imageNames := make([]string, 0, len(a.Images)+len(b.Images))
+	for name := range a.Images {
+		imageNames = append(imageNames, name)
+	}
+	for name := range b.Images {
+		if _, ok := a.Images[name]; !ok {
+			imageNames = append(imageNames, name)
+		}
+	}
+	sort.Strings(imageNames)
+	for _, name := range imageNames {
+		ia, okA := a.Images[name]
+		ib, okB := b.Images[name]
+		output := "image " + name
+		switch {
+		case !okA:
+			ret = append(ret, Mismatch{Output: output, Reasons: []string{"only output by the second build"}})
+			continue
+		case !okB:
+			ret = append(ret, Mismatch{Output: output, Reasons: []string{"only output by the first build"}})
+			continue
+		}
+		var reasons []string
+		if ia.Config != ib.Config {
+			reasons = append(reasons, fmt.Sprintf("config %s != %s", ia.Config, ib.Config))
+		}
+		layersDiffer := len(ia.Layers) != len(ib.Layers)
+		if layersDiffer {
+			reasons = append(reasons, fmt.Sprintf("%d layers != %d layers", len(ia.Layers), len(ib.Layers)))
+		}
+		for i := 0; i < len(ia.Layers) && i < len(ib.Layers); i++ {
+			if ia.Layers[i] != ib.Layers[i] {
+				layersDiffer = true
+				reasons = append(reasons, fmt.Sprintf("layer %d: %s != %s", i+1, ia.Layers[i], ib.Layers[i]))
+			}
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+		m := Mismatch{Output: output, Reasons: reasons}
+		if layersDiffer {
+			sa, err := a.imageSnapshot(ia)
+			if err != nil {
+				return nil, err
+			}
+			sb, err := b.imageSnapshot(ib)
+			if err != nil {
+				return nil, err
+			}
+			m.Files = Diff(sa, sb)
+		}
+		ret = append(ret, m)
+	}
+	return ret, nil
+}
+
+// imageSnapshot snapshots the filesystem of the image, by applying its layers in order.
+func (o *Outputs) imageSnapshot(img Image) (Snapshot, error) {
+	s := make(Snapshot)
+	for _, l := range img.Layers {
+		rc, err := o.layout.OpenBlob(l)
+		if err != nil {
+			return nil, err
+		}
+		s, err = SnapshotTar(rc, s)
+		rc.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "snapshot layer %s", l)
+		}
+	}
+	return s, nil
+}
+
+func unionKeys(a, b map[string]Snapshot) []string {
+	var keys []string
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,72 @@
+package reproducible
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func writeTar(t *testing.T, files map[string]string) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Size:     int64(len(content)),
+			ModTime:  time.Unix(1000, 0),
+		}))
+		_, err := tw.Write([]byte(content))
+		NoError(t, err)
+	}
+	NoError(t, tw.Close())
+	return &buf
+}
+
+func TestSnapshotTar(t *testing.T) {
+	s, err := SnapshotTar(writeTar(t, map[string]string{"a/b.txt": "b", "a/c.txt": "c", "d.txt": "d"}), nil)
+	if !NoError(t, err) {
+		return
+	}
+	s, err = SnapshotTar(writeTar(t, map[string]string{"a/.wh.b.txt": "", "d.txt": "dd"}), s)
+	if !NoError(t, err) {
+		return
+	}
+	Len(t, s, 2)
+	Equal(t, int64(2), s["/d.txt"].Size)
+	_, ok := s["/a/c.txt"]
+	True(t, ok)
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644))
+	a, err := SnapshotPath(dir)
+	if !NoError(t, err) {
+		return
+	}
+	Empty(t, Diff(a, a))
+
+	NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("bb"), 0644))
+	NoError(t, os.Chtimes(filepath.Join(dir, "b.txt"), time.Unix(1000, 0), time.Unix(1000, 0)))
+	NoError(t, os.Remove(filepath.Join(dir, "a.txt")))
+	b, err := SnapshotPath(dir)
+	if !NoError(t, err) {
+		return
+	}
+	diffs := Diff(a, b)
+	if !Len(t, diffs, 2) {
+		return
+	}
+	Equal(t, "a.txt", diffs[0].Path)
+	Nil(t, diffs[0].B)
+	Equal(t, "b.txt", diffs[1].Path)
+	Contains(t, diffs[1].String(), "size 1 != 2")
+	Contains(t, diffs[1].String(), "mtime")
+}
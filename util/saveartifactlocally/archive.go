@@ -0,0 +1,242 @@
+package saveartifactlocally
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ArchiveTar saves the artifact as an uncompressed tar archive.
+	ArchiveTar = "tar"
+	// ArchiveTarGz saves the artifact as a gzip-compressed tar archive.
+	ArchiveTarGz = "tar.gz"
+	// ArchiveZip saves the artifact as a zip archive.
+	ArchiveZip = "zip"
+)
+
+// archiveModTime is the modification time of all the archive entries, unless the timestamps are kept.
+// It is the earliest time that can be represented in a zip archive.
+var archiveModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// ValidateArchiveFormat returns an error if the given archive format is not supported.
+func ValidateArchiveFormat(format string) error {
+	switch format {
+	case ArchiveTar, ArchiveTarGz, ArchiveZip:
+		return nil
+	default:
+		return errors.Errorf("unsupported archive format %q; valid options are %s, %s and %s", format, ArchiveTar, ArchiveTarGz, ArchiveZip)
+	}
+}
+
+type archiveEntry struct {
+	name string // the slash-separated path within the archive
+	path string // the path on the host
+	fi   os.FileInfo
+}
+
+// collectArchiveEntries walks the given paths and returns the entries of the archive, sorted by name.
+// Each path is placed at the root of the archive, under its base name.
+func collectArchiveEntries(paths []string) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		parent := filepath.Dir(p)
+		err := filepath.Walk(p, func(walkPath string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(parent, walkPath)
+			if err != nil {
+				return err
+			}
+			name := filepath.ToSlash(rel)
+			if fi.IsDir() {
+				name += "/"
+			}
+			if seen[name] {
+				return nil
+			}
+			seen[name] = true
+			entries = append(entries, archiveEntry{name: name, path: walkPath, fi: fi})
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "walk %s", p)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+	return entries, nil
+}
+
+// writeArchive writes the given paths into an archive at dest. The entries are sorted and, unless keepTs
+// is set, have a fixed modification time, such that the same inputs always result in the same archive.
+func writeArchive(format string, paths []string, dest string, keepTs bool) (retErr error) {
+	entries, err := collectArchiveEntries(paths)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return errors.Wrapf(err, "mkdir all for archive %s", filepath.Dir(dest))
+	}
+	f, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "create archive %s", dest)
+	}
+	defer func() {
+		if retErr != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	switch format {
+	case ArchiveTar:
+		err = writeTar(f, entries, keepTs)
+	case ArchiveTarGz:
+		gw := gzip.NewWriter(f)
+		err = writeTar(gw, entries, keepTs)
+		if err == nil {
+			err = gw.Close()
+		}
+	case ArchiveZip:
+		err = writeZip(f, entries, keepTs)
+	default:
+		err = ValidateArchiveFormat(format)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "write archive %s", dest)
+	}
+	err = f.Chmod(0644)
+	if err != nil {
+		return errors.Wrapf(err, "chmod archive %s", dest)
+	}
+	err = f.Close()
+	if err != nil {
+		return errors.Wrapf(err, "close archive %s", dest)
+	}
+	err = os.Rename(f.Name(), dest)
+	if err != nil {
+		return errors.Wrapf(err, "rename archive to %s", dest)
+	}
+	return nil
+}
+
+func entryModTime(e archiveEntry, keepTs bool) time.Time {
+	if keepTs {
+		return e.fi.ModTime()
+	}
+	return archiveModTime
+}
+
+func writeTar(w io.Writer, entries []archiveEntry, keepTs bool) error {
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		var link string
+		if e.fi.Mode()&os.ModeSymlink != 0 {
+			var err error
+			link, err = os.Readlink(e.path)
+			if err != nil {
+				return errors.Wrapf(err, "readlink %s", e.path)
+			}
+		}
+		hdr, err := tar.FileInfoHeader(e.fi, link)
+		if err != nil {
+			return errors.Wrapf(err, "tar header for %s", e.path)
+		}
+		hdr.Name = e.name
+		hdr.ModTime = entryModTime(e, keepTs)
+		hdr.AccessTime = time.Time{}
+		hdr.ChangeTime = time.Time{}
+		hdr.Uid, hdr.Gid = 0, 0
+		hdr.Uname, hdr.Gname = "", ""
+		err = tw.WriteHeader(hdr)
+		if err != nil {
+			return errors.Wrapf(err, "write tar header for %s", e.path)
+		}
+		if e.fi.Mode().IsRegular() {
+			err = copyFileTo(tw, e.path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, entries []archiveEntry, keepTs bool) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		hdr, err := zip.FileInfoHeader(e.fi)
+		if err != nil {
+			return errors.Wrapf(err, "zip header for %s", e.path)
+		}
+		hdr.Name = e.name
+		hdr.Modified = entryModTime(e, keepTs)
+		if e.fi.Mode().IsRegular() {
+			hdr.Method = zip.Deflate
+		} else {
+			hdr.Method = zip.Store
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return errors.Wrapf(err, "write zip header for %s", e.path)
+		}
+		switch {
+		case e.fi.Mode().IsRegular():
+			err = copyFileTo(fw, e.path)
+			if err != nil {
+				return err
+			}
+		case e.fi.Mode()&os.ModeSymlink != 0:
+			// Symlinks are stored with their target as the content, as done by Info-ZIP.
+			link, err := os.Readlink(e.path)
+			if err != nil {
+				return errors.Wrapf(err, "readlink %s", e.path)
+			}
+			_, err = io.WriteString(fw, link)
+			if err != nil {
+				return errors.Wrapf(err, "write zip entry for %s", e.path)
+			}
+		}
+	}
+	return zw.Close()
+}
+
+func copyFileTo(w io.Writer, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", p)
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	if err != nil {
+		return errors.Wrapf(err, "archive %s", p)
+	}
+	return nil
+}
+
+// archiveDestPath returns the path of the archive file. When the dest is a dir, the archive is named
+// after the artifact, with the extension of the format.
+func archiveDestPath(artifactPath, destPath, format string) (string, error) {
+	if !strings.HasSuffix(destPath, "/") && destPath != "." {
+		return destPath, nil
+	}
+	base := path.Base(artifactPath)
+	if strings.ContainsAny(base, `*?[`) {
+		return "", errors.New("artifact is a wildcard, so the AS LOCAL destination of an archive must be a file name")
+	}
+	return path.Join(destPath, base+"."+format), nil
+}
@@ -0,0 +1,102 @@
+package saveartifactlocally
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func makeArtifactDir(t *testing.T, mtime time.Time) string {
+	dir := filepath.Join(t.TempDir(), "dist")
+	for _, f := range []string{"b.txt", "a/z.txt", "a/c.txt"} {
+		p := filepath.Join(dir, f)
+		NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		NoError(t, os.WriteFile(p, []byte(f), 0644))
+		NoError(t, os.Chtimes(p, mtime, mtime))
+	}
+	return dir
+}
+
+func TestWriteArchiveDeterministic(t *testing.T) {
+	for _, format := range []string{ArchiveTar, ArchiveTarGz, ArchiveZip} {
+		dest1 := filepath.Join(t.TempDir(), "out."+format)
+		dest2 := filepath.Join(t.TempDir(), "out."+format)
+		NoError(t, writeArchive(format, []string{makeArtifactDir(t, time.Unix(1000, 0))}, dest1, false))
+		NoError(t, writeArchive(format, []string{makeArtifactDir(t, time.Unix(2000, 0))}, dest2, false))
+		dt1, err := os.ReadFile(dest1)
+		NoError(t, err)
+		dt2, err := os.ReadFile(dest2)
+		NoError(t, err)
+		True(t, bytes.Equal(dt1, dt2), "archives differ for format %s", format)
+	}
+}
+
+func TestWriteArchiveTar(t *testing.T) {
+	mtime := time.Unix(1600000000, 0)
+	dest := filepath.Join(t.TempDir(), "out.tar.gz")
+	NoError(t, writeArchive(ArchiveTarGz, []string{makeArtifactDir(t, mtime)}, dest, true))
+
+	f, err := os.Open(dest)
+	NoError(t, err)
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	NoError(t, err)
+	tr := tar.NewReader(gr)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		NoError(t, err)
+		names = append(names, hdr.Name)
+		if hdr.Typeflag == tar.TypeReg {
+			True(t, mtime.Equal(hdr.ModTime))
+			Equal(t, 0, hdr.Uid)
+		}
+	}
+	Equal(t, []string{"dist/", "dist/a/", "dist/a/c.txt", "dist/a/z.txt", "dist/b.txt"}, names)
+}
+
+func TestWriteArchiveZip(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "out.zip")
+	NoError(t, writeArchive(ArchiveZip, []string{makeArtifactDir(t, time.Now())}, dest, false))
+
+	zr, err := zip.OpenReader(dest)
+	NoError(t, err)
+	defer zr.Close()
+	var names []string
+	for _, zf := range zr.File {
+		names = append(names, zf.Name)
+		True(t, archiveModTime.Equal(zf.Modified))
+		if zf.Name == "dist/a/c.txt" {
+			rc, err := zf.Open()
+			NoError(t, err)
+			dt, err := io.ReadAll(rc)
+			NoError(t, err)
+			rc.Close()
+			Equal(t, "a/c.txt", string(dt))
+		}
+	}
+	Equal(t, []string{"dist/", "dist/a/", "dist/a/c.txt", "dist/a/z.txt", "dist/b.txt"}, names)
+}
+
+func TestArchiveDestPath(t *testing.T) {
+	p, err := archiveDestPath("dist", "out/", ArchiveZip)
+	NoError(t, err)
+	Equal(t, "out/dist.zip", p)
+	p, err = archiveDestPath("dist", "release.tgz", ArchiveTarGz)
+	NoError(t, err)
+	Equal(t, "release.tgz", p)
+	_, err = archiveDestPath("*.txt", "./", ArchiveTar)
+	Error(t, err)
+	Error(t, ValidateArchiveFormat("rar"))
+}
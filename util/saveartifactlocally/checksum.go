@@ -0,0 +1,175 @@
+package saveartifactlocally
+
+import (
+	_ "crypto/sha256" // Register the digest algorithms.
+	_ "crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+
+	"github.com/earthly/earthly/util/gatewaycrafter"
+)
+
+// Checksum algorithms.
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumSHA512 = "sha512"
+)
+
+// ValidateChecksumAlgorithm returns an error if the checksum algorithm is not supported.
+func ValidateChecksumAlgorithm(algorithm string) error {
+	switch algorithm {
+	case ChecksumSHA256, ChecksumSHA512:
+		return nil
+	default:
+		return errors.Errorf("unsupported checksum algorithm %s; must be one of sha256 or sha512", algorithm)
+	}
+}
+
+// ChecksumEntry is the checksum of a file.
+type ChecksumEntry struct {
+	Artifact string `json:"artifact,omitempty"`
+	Path     string `json:"path"`
+	Checksum string `json:"checksum"`
+}
+
+// checksumFiles returns the checksums of all the files within the given paths (files or dirs), by their path
+// relative to baseDir, sorted by path.
+func checksumFiles(algorithm string, baseDir string, paths []string, artifacts []string) ([]ChecksumEntry, error) {
+	alg := digest.Algorithm(algorithm)
+	seen := make(map[string]bool)
+	var entries []ChecksumEntry
+	for i, p := range paths {
+		err := filepath.WalkDir(p, func(fp string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if d.Type()&fs.ModeSymlink != 0 {
+				// Symlinks are followed, as by sha256sum, unless they point to a dir or nowhere.
+				fi, err := os.Stat(fp)
+				if err != nil || fi.IsDir() {
+					return nil
+				}
+			}
+			abs, err := filepath.Abs(fp)
+			if err != nil {
+				return err
+			}
+			if seen[abs] {
+				return nil
+			}
+			seen[abs] = true
+			rel, err := filepath.Rel(baseDir, abs)
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(fp)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			dgst, err := alg.FromReader(f)
+			if err != nil {
+				return errors.Wrapf(err, "read %s", fp)
+			}
+			entry := ChecksumEntry{Path: filepath.ToSlash(rel), Checksum: dgst.Encoded()}
+			if artifacts != nil {
+				entry.Artifact = artifacts[i]
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "checksum %s", p)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+// formatChecksums formats the checksums as the GNU coreutils sha256sum and sha512sum commands do, such that
+// they can be verified via sha256sum -c.
+func formatChecksums(entries []ChecksumEntry) []byte {
+	var sb strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&sb, "%s  %s\n", e.Checksum, e.Path)
+	}
+	return []byte(sb.String())
+}
+
+// writeChecksumSidecar writes the checksums of the files saved to the path to into the sidecar file
+// <to>.<algorithm>, with the paths relative to the dir of the sidecar file.
+func writeChecksumSidecar(algorithm string, to string) error {
+	to = strings.TrimSuffix(to, "/")
+	abs, err := filepath.Abs(to)
+	if err != nil {
+		return errors.Wrapf(err, "get absolute path of %s", to)
+	}
+	entries, err := checksumFiles(algorithm, filepath.Dir(abs), []string{abs}, nil)
+	if err != nil {
+		return err
+	}
+	p := fmt.Sprintf("%s.%s", to, algorithm)
+	err = os.WriteFile(p, formatChecksums(entries), 0644)
+	if err != nil {
+		return errors.Wrapf(err, "write %s", p)
+	}
+	return nil
+}
+
+// WriteChecksumManifest writes the checksums of all the files of the artifacts saved locally into the manifest
+// file p, with the paths relative to the dir of the manifest. The manifest is written in the JSON format if p
+// has the .json extension, or in the GNU coreutils format otherwise (as in SHA256SUMS).
+func WriteChecksumManifest(p string, algorithm string, artifacts []gatewaycrafter.ArtifactOutputSummaryEntry) error {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return errors.Wrapf(err, "get absolute path of %s", p)
+	}
+	paths := make([]string, 0, len(artifacts))
+	names := make([]string, 0, len(artifacts))
+	for _, a := range artifacts {
+		paths = append(paths, a.Path)
+		names = append(names, a.Target)
+	}
+	entries, err := checksumFiles(algorithm, filepath.Dir(abs), paths, names)
+	if err != nil {
+		return err
+	}
+	var dt []byte
+	if filepath.Ext(p) == ".json" {
+		if entries == nil {
+			entries = []ChecksumEntry{}
+		}
+		dt, err = json.MarshalIndent(struct {
+			Algorithm string          `json:"algorithm"`
+			Files     []ChecksumEntry `json:"files"`
+		}{algorithm, entries}, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "serialize checksum manifest")
+		}
+		dt = append(dt, '\n')
+	} else {
+		dt = formatChecksums(entries)
+	}
+	err = os.MkdirAll(filepath.Dir(abs), 0755)
+	if err != nil {
+		return errors.Wrapf(err, "create dir for %s", p)
+	}
+	err = os.WriteFile(abs, dt, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "write %s", p)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package saveartifactlocally
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/earthly/earthly/util/gatewaycrafter"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+// sha256OfBTxt is the sha256 checksum of the b.txt file of makeArtifactDir.
+const sha256OfBTxt = "ffa0da5d885fba09d903c782713b6b098c8cf21f56a3a35d9aa920613220d2e1"
+
+func TestChecksums(t *testing.T) {
+	dir := t.TempDir()
+	dist := filepath.Join(dir, "out", "dist")
+	var stats SyncStats
+	NoError(t, syncPath(makeArtifactDir(t, time.Unix(1000, 0)), dist, false, &stats))
+
+	NoError(t, writeChecksumSidecar(ChecksumSHA256, dist+"/"))
+	dt, err := os.ReadFile(dist + ".sha256")
+	NoError(t, err)
+	entries, err := checksumFiles(ChecksumSHA256, filepath.Join(dir, "out"), []string{dist}, nil)
+	if !NoError(t, err) || !Len(t, entries, 3) {
+		return
+	}
+	Equal(t, "dist/a/c.txt", entries[0].Path)
+	Equal(t, string(formatChecksums(entries)), string(dt))
+
+	artifacts := []gatewaycrafter.ArtifactOutputSummaryEntry{{Target: "+build/dist", Path: dist}}
+	NoError(t, WriteChecksumManifest(filepath.Join(dir, "SHA512SUMS"), ChecksumSHA512, artifacts))
+	dt, err = os.ReadFile(filepath.Join(dir, "SHA512SUMS"))
+	NoError(t, err)
+	Contains(t, string(dt), "  out/dist/b.txt\n")
+
+	NoError(t, WriteChecksumManifest(filepath.Join(dir, "checksums.json"), ChecksumSHA256, artifacts))
+	dt, err = os.ReadFile(filepath.Join(dir, "checksums.json"))
+	NoError(t, err)
+	var manifest struct {
+		Algorithm string
+		Files     []ChecksumEntry
+	}
+	NoError(t, json.Unmarshal(dt, &manifest))
+	Equal(t, ChecksumSHA256, manifest.Algorithm)
+	Equal(t, ChecksumEntry{Artifact: "+build/dist", Path: "out/dist/b.txt", Checksum: sha256OfBTxt}, manifest.Files[2])
+
+	Error(t, ValidateChecksumAlgorithm("md5"))
+}
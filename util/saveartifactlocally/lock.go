@@ -0,0 +1,170 @@
+package saveartifactlocally
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/earthly/earthly/conslogging"
+	"github.com/earthly/earthly/util/cliutil"
+	"github.com/earthly/earthly/util/gitutil"
+
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+)
+
+const (
+	outputLockTimeout    = 10 * time.Minute
+	outputLockRetryDelay = 200 * time.Millisecond
+)
+
+// ProcessOutputLock is the OutputLock of the local outputs of an earthly process. It is acquired on the first
+// local output write of a build, and held until the end of the build, such that the outputs of concurrent
+// invocations are not interleaved. As the lock is taken once per process, the output writes of the same build
+// (e.g. of the WAIT blocks and of the final target) never wait for each other.
+type ProcessOutputLock struct {
+	mu       sync.Mutex
+	locksDir string
+	root     string
+	lock     *OutputLock
+	locked   bool
+}
+
+// NewProcessOutputLock returns the process lock of the local outputs written under root. See LockRoot.
+func NewProcessOutputLock(root string) *ProcessOutputLock {
+	return &ProcessOutputLock{
+		locksDir: filepath.Join(cliutil.GetEarthlyDir(), "locks"),
+		root:     root,
+	}
+}
+
+// LockRoot returns the dir which the output lock of an invocation covers: the output root, if set, or else
+// the root of the git repository of the working dir, or the working dir itself outside of git repositories.
+// This way, the invocations from different dirs of the same checkout are serialized too.
+func LockRoot(ctx context.Context, outputRoot string) string {
+	if outputRoot != "" {
+		return outputRoot
+	}
+	root, err := gitutil.BaseDir(ctx, ".")
+	if err != nil {
+		return "."
+	}
+	return root
+}
+
+// Lock acquires the lock, unless it is already held by this process.
+func (l *ProcessOutputLock) Lock(ctx context.Context, console conslogging.ConsoleLogger) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locked {
+		return nil
+	}
+	if l.lock == nil {
+		lock, err := newOutputLock(l.locksDir, l.root)
+		if err != nil {
+			return err
+		}
+		l.lock = lock
+	}
+	err := l.lock.Lock(ctx, console)
+	if err != nil {
+		return err
+	}
+	l.locked = true
+	return nil
+}
+
+// Unlock releases the lock, if it is held.
+func (l *ProcessOutputLock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.locked {
+		return nil
+	}
+	l.locked = false
+	return l.lock.Unlock()
+}
+
+// OutputLock is an advisory file lock on a local output directory, which prevents concurrent earthly
+// invocations (e.g. from an editor and from a terminal, in the same checkout) from interleaving their writes.
+// The lock files are kept in the .earthly dir, such that no file is left behind in the output directory.
+type OutputLock struct {
+	dir string
+	fl  *flock.Flock
+}
+
+// NewOutputLock returns the lock of the given local output directory.
+func NewOutputLock(dir string) (*OutputLock, error) {
+	return newOutputLock(filepath.Join(cliutil.GetEarthlyDir(), "locks"), dir)
+}
+
+func newOutputLock(locksDir, dir string) (*OutputLock, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "abs %s", dir)
+	}
+	err = os.MkdirAll(locksDir, 0755)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create dir %s", locksDir)
+	}
+	sum := sha256.Sum256([]byte(absDir))
+	lockPath := filepath.Join(locksDir, "output-"+hex.EncodeToString(sum[:])[:16]+".lock")
+	return &OutputLock{
+		dir: absDir,
+		fl:  flock.New(lockPath),
+	}, nil
+}
+
+// Lock acquires the lock exclusively. If another earthly invocation holds the lock, a message is printed,
+// and Lock waits for it to be released, for up to 10 minutes.
+func (l *OutputLock) Lock(ctx context.Context, console conslogging.ConsoleLogger) error {
+	return l.lock(ctx, console, l.fl.TryLock, l.fl.TryLockContext)
+}
+
+// RLock acquires the lock in shared mode, waiting for it in the same way as Lock.
+func (l *OutputLock) RLock(ctx context.Context, console conslogging.ConsoleLogger) error {
+	return l.lock(ctx, console, l.fl.TryRLock, l.fl.TryRLockContext)
+}
+
+// TryLock attempts to acquire the lock exclusively, without waiting. It returns whether it has been acquired.
+func (l *OutputLock) TryLock() (bool, error) {
+	locked, err := l.fl.TryLock()
+	if err != nil {
+		return false, errors.Wrapf(err, "try flock %s", l.fl.Path())
+	}
+	return locked, nil
+}
+
+// Unlock releases the lock.
+func (l *OutputLock) Unlock() error {
+	err := l.fl.Unlock()
+	if err != nil {
+		return errors.Wrapf(err, "unlock flock %s", l.fl.Path())
+	}
+	return nil
+}
+
+func (l *OutputLock) lock(ctx context.Context, console conslogging.ConsoleLogger, tryLock func() (bool, error), tryLockContext func(context.Context, time.Duration) (bool, error)) error {
+	locked, err := tryLock()
+	if err != nil {
+		return errors.Wrapf(err, "try flock %s", l.fl.Path())
+	}
+	if locked {
+		return nil
+	}
+	console.Printf("Waiting for another earthly process to finish writing its outputs to %s\n", l.dir)
+	timeoutCtx, cancel := context.WithTimeout(ctx, outputLockTimeout)
+	defer cancel()
+	_, err = tryLockContext(timeoutCtx, outputLockRetryDelay)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return errors.Errorf("timeout after %s waiting for another earthly process to finish writing its outputs to %s (lock %s)", outputLockTimeout, l.dir, l.fl.Path())
+		}
+		return errors.Wrapf(err, "try flock context %s", l.fl.Path())
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package saveartifactlocally
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/earthly/earthly/conslogging"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestOutputLock(t *testing.T) {
+	locksDir := t.TempDir()
+	outDir := t.TempDir()
+	console := conslogging.Current(conslogging.NoColor, conslogging.DefaultPadding, conslogging.Info)
+
+	l1, err := newOutputLock(locksDir, outDir)
+	NoError(t, err)
+	l2, err := newOutputLock(locksDir, outDir)
+	NoError(t, err)
+	other, err := newOutputLock(locksDir, t.TempDir())
+	NoError(t, err)
+
+	NoError(t, l1.Lock(context.Background(), console))
+	locked, err := l2.TryLock()
+	NoError(t, err)
+	False(t, locked)
+	locked, err = other.TryLock()
+	NoError(t, err)
+	True(t, locked)
+
+	// A waiting lock is acquired once released.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		l1.Unlock()
+	}()
+	NoError(t, l2.Lock(context.Background(), console))
+	NoError(t, l2.Unlock())
+
+	// Shared locks exclude exclusive ones only.
+	NoError(t, l1.RLock(context.Background(), console))
+	NoError(t, l2.RLock(context.Background(), console))
+	NoError(t, l1.Unlock())
+	locked, err = l1.TryLock()
+	NoError(t, err)
+	False(t, locked)
+	NoError(t, l2.Unlock())
+	locked, err = l1.TryLock()
+	NoError(t, err)
+	True(t, locked)
+
+	// Waiting for a lock stops with the context.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	Error(t, l2.Lock(ctx, console))
+}
+
+func TestProcessOutputLock(t *testing.T) {
+	locksDir := t.TempDir()
+	root := t.TempDir()
+	console := conslogging.Current(conslogging.NoColor, conslogging.DefaultPadding, conslogging.Info)
+
+	pl := &ProcessOutputLock{locksDir: locksDir, root: root}
+	other, err := newOutputLock(locksDir, root)
+	if !NoError(t, err) {
+		return
+	}
+
+	// The lock is taken once, such that the output writes of the same process do not wait for each other.
+	NoError(t, pl.Lock(context.Background(), console))
+	NoError(t, pl.Lock(context.Background(), console))
+	locked, err := other.TryLock()
+	NoError(t, err)
+	False(t, locked)
+
+	NoError(t, pl.Unlock())
+	NoError(t, pl.Unlock())
+	locked, err = other.TryLock()
+	NoError(t, err)
+	True(t, locked)
+	NoError(t, other.Unlock())
+}
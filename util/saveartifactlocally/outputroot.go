@@ -0,0 +1,113 @@
+package saveartifactlocally
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/earthly/earthly/util/gatewaycrafter"
+
+	"github.com/pkg/errors"
+)
+
+// OutputManifestName is the name of the manifest written into the output root.
+const OutputManifestName = "earthly-outputs.json"
+
+// RebaseDest returns the local destination p (relative to the current directory, or absolute) rebased under
+// the output root. Destinations within the current directory keep their relative path, while the others are
+// placed under the output root by their absolute path. A trailing slash is preserved.
+func RebaseDest(outputRoot string, p string) (string, error) {
+	hasTrailingSlash := strings.HasSuffix(p, "/")
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", errors.Wrapf(err, "get absolute path of %s", p)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", errors.Wrap(err, "get working dir")
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil {
+		return "", errors.Wrapf(err, "get path of %s relative to %s", abs, wd)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = strings.TrimPrefix(abs, filepath.VolumeName(abs))
+	}
+	root, err := filepath.Abs(outputRoot)
+	if err != nil {
+		return "", errors.Wrapf(err, "get absolute path of %s", outputRoot)
+	}
+	ret := filepath.Join(root, rel)
+	if hasTrailingSlash {
+		ret += "/"
+	}
+	return ret, nil
+}
+
+// OutputManifestEntry describes an artifact written into the output root.
+type OutputManifestEntry struct {
+	Artifact string   `json:"artifact"`
+	Path     string   `json:"path"`  // relative to the output root
+	Files    []string `json:"files"` // relative to the output root
+}
+
+// WriteOutputManifest writes the manifest of the artifacts saved into the output root.
+func WriteOutputManifest(outputRoot string, artifacts []gatewaycrafter.ArtifactOutputSummaryEntry) error {
+	root, err := filepath.Abs(outputRoot)
+	if err != nil {
+		return errors.Wrapf(err, "get absolute path of %s", outputRoot)
+	}
+	entries := make([]OutputManifestEntry, 0, len(artifacts))
+	for _, a := range artifacts {
+		p, err := filepath.Abs(a.Path)
+		if err != nil {
+			return errors.Wrapf(err, "get absolute path of %s", a.Path)
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return errors.Wrapf(err, "get path of %s relative to %s", p, root)
+		}
+		entry := OutputManifestEntry{Artifact: a.Target, Path: filepath.ToSlash(rel), Files: []string{}}
+		err = filepath.WalkDir(p, func(fp string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			frel, err := filepath.Rel(root, fp)
+			if err != nil {
+				return err
+			}
+			entry.Files = append(entry.Files, filepath.ToSlash(frel))
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "list files of %s", p)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Path != entries[j].Path {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].Artifact < entries[j].Artifact
+	})
+	dt, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "serialize output manifest")
+	}
+	err = os.MkdirAll(root, 0755)
+	if err != nil {
+		return errors.Wrapf(err, "create dir %s", root)
+	}
+	p := filepath.Join(root, OutputManifestName)
+	err = os.WriteFile(p, append(dt, '\n'), 0644)
+	if err != nil {
+		return errors.Wrapf(err, "write %s", p)
+	}
+	return nil
+}
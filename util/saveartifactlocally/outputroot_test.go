@@ -0,0 +1,56 @@
+package saveartifactlocally
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/earthly/earthly/util/gatewaycrafter"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestRebaseDest(t *testing.T) {
+	wd, err := os.Getwd()
+	if !NoError(t, err) {
+		return
+	}
+	root := t.TempDir()
+	for _, tt := range []struct {
+		dest string
+		want string
+	}{
+		{"dist", filepath.Join(root, "dist")},
+		{"./sub/dist/", filepath.Join(root, "sub/dist") + "/"},
+		{"./", root + "/"},
+		{"/etc/app.conf", filepath.Join(root, "etc/app.conf")},
+		{"../out", filepath.Join(root, filepath.Dir(wd), "out")},
+	} {
+		got, err := RebaseDest(root, tt.dest)
+		NoError(t, err)
+		Equal(t, tt.want, got, tt.dest)
+	}
+}
+
+func TestWriteOutputManifest(t *testing.T) {
+	root := t.TempDir()
+	src := makeArtifactDir(t, time.Unix(1000, 0))
+	var stats SyncStats
+	NoError(t, syncPath(src, filepath.Join(root, "out/dist"), false, &stats))
+	NoError(t, WriteOutputManifest(root, []gatewaycrafter.ArtifactOutputSummaryEntry{
+		{Target: "+build/dist", Path: filepath.Join(root, "out/dist")},
+	}))
+	dt, err := os.ReadFile(filepath.Join(root, OutputManifestName))
+	if !NoError(t, err) {
+		return
+	}
+	var entries []OutputManifestEntry
+	NoError(t, json.Unmarshal(dt, &entries))
+	Equal(t, []OutputManifestEntry{{
+		Artifact: "+build/dist",
+		Path:     "out/dist",
+		Files:    []string{"out/dist/a/c.txt", "out/dist/a/z.txt", "out/dist/b.txt"},
+	}}, entries)
+}
@@ -11,12 +11,28 @@ import (
 	"github.com/earthly/earthly/domain"
 	"github.com/earthly/earthly/util/gatewaycrafter"
 
-	reccopy "github.com/otiai10/copy"
 	"github.com/pkg/errors"
 )
 
-// SaveArtifactLocally handles saving artifacts to the local host, and is called from both builder and waitblock
-func SaveArtifactLocally(ctx context.Context, exportCoordinator *gatewaycrafter.ExportCoordinator, console conslogging.ConsoleLogger, artifact domain.Artifact, indexOutDir string, destPath string, salt string, ifExists bool) error {
+// SaveOpt holds the options of saving an artifact to the local host.
+type SaveOpt struct {
+	// Archive is the format (one of the Archive* formats) of the single archive file to save the artifact
+	// as, if any. Otherwise, the artifact is saved incrementally, only writing the files which differ from
+	// the existing ones.
+	Archive string
+	// KeepTs keeps the file timestamps within the archive.
+	KeepTs bool
+	// SyncDelete removes the files of the destination directory which are not part of the artifact.
+	SyncDelete bool
+	// Checksum is the algorithm (one of the Checksum* algorithms) of the sidecar file with the checksums of
+	// the saved files to write next to the artifact, if any.
+	Checksum string
+}
+
+// SaveArtifactLocally handles saving artifacts to the local host, and is called from both builder and waitblock.
+// Callers hold the ProcessOutputLock, such that concurrent earthly invocations do not
+// interleave their writes.
+func SaveArtifactLocally(ctx context.Context, exportCoordinator *gatewaycrafter.ExportCoordinator, console conslogging.ConsoleLogger, artifact domain.Artifact, indexOutDir string, destPath string, salt string, ifExists bool, opt SaveOpt) error {
 	fromPattern := filepath.Join(indexOutDir, filepath.FromSlash(artifact.Artifact))
 	// Resolve possible wildcards.
 	// TODO: Note that this is not very portable, as the glob is host-platform dependent,
@@ -30,6 +46,12 @@ func SaveArtifactLocally(ctx context.Context, exportCoordinator *gatewaycrafter.
 		}
 		return errors.Errorf("cannot save artifact %s, since it does not exist", artifact.StringCanonical())
 	}
+	if opt.Archive != "" {
+		if len(fromGlobMatches) == 0 {
+			return nil
+		}
+		return saveArchiveLocally(exportCoordinator, artifact, fromGlobMatches, destPath, salt, opt)
+	}
 	isWildcard := strings.ContainsAny(fromPattern, `*?[`)
 	for _, from := range fromGlobMatches {
 		fiSrc, err := os.Stat(from)
@@ -64,33 +86,23 @@ func SaveArtifactLocally(ctx context.Context, exportCoordinator *gatewaycrafter.
 			return errors.New(
 				"artifact is a directory, but existing AS LOCAL destination is a file")
 		}
-		if destExists {
-			if !srcIsDir {
-				// Remove preexisting dest file.
-				err = os.Remove(to)
-				if err != nil {
-					return errors.Wrapf(err, "rm %s", to)
-				}
-			} else {
-				// Remove preexisting dest dir.
-				err = os.RemoveAll(to)
-				if err != nil {
-					return errors.Wrapf(err, "rm -rf %s", to)
-				}
+		if destExists && !srcIsDir && destIsDir {
+			// Remove preexisting (empty) dest dir.
+			err = os.Remove(to)
+			if err != nil {
+				return errors.Wrapf(err, "rm %s", to)
 			}
 		}
 
-		toDir := path.Dir(to)
-		err = os.MkdirAll(toDir, 0755)
+		var stats SyncStats
+		err = syncPath(from, to, opt.SyncDelete, &stats)
 		if err != nil {
-			return errors.Wrapf(err, "mkdir all for artifact %s", toDir)
+			return errors.Wrapf(err, "save artifact %s", from)
 		}
-		err = os.Link(from, to)
-		if err != nil {
-			// Hard linking did not work. Try recursive copy.
-			errCopy := reccopy.Copy(from, to)
-			if errCopy != nil {
-				return errors.Wrapf(errCopy, "copy artifact %s", from)
+		if opt.Checksum != "" {
+			err = writeChecksumSidecar(opt.Checksum, to)
+			if err != nil {
+				return err
 			}
 		}
 
@@ -100,12 +112,38 @@ func SaveArtifactLocally(ctx context.Context, exportCoordinator *gatewaycrafter.
 			Target:   artifact.Target,
 			Artifact: artifactPath,
 		}
-		destPath2 := filepath.FromSlash(destPath)
-		if strings.HasSuffix(destPath, "/") {
-			destPath2 = filepath.Join(destPath2, filepath.Base(artifactPath))
+		// Record the path the artifact has actually been written to (i.e. within the dir of a local external
+		// target), such that it can be read back via the summary.
+		exportCoordinator.AddArtifactSummary(artifact2.StringCanonical(), filepath.FromSlash(to), salt, stats.String())
+	}
+	return nil
+}
+
+func saveArchiveLocally(exportCoordinator *gatewaycrafter.ExportCoordinator, artifact domain.Artifact, fromGlobMatches []string, destPath string, salt string, opt SaveOpt) error {
+	archivePath, err := archiveDestPath(artifact.Artifact, destPath, opt.Archive)
+	if err != nil {
+		return err
+	}
+	to := archivePath
+	if artifact.Target.IsLocalExternal() && !filepath.IsAbs(to) {
+		// Place within external dir.
+		to = path.Join(artifact.Target.LocalPath, to)
+	}
+	fiDest, err := os.Stat(to)
+	if err == nil && fiDest.IsDir() {
+		return errors.Errorf("cannot save archive to %s, since it is an existing directory", to)
+	}
+	err = writeArchive(opt.Archive, fromGlobMatches, to, opt.KeepTs)
+	if err != nil {
+		return err
+	}
+	if opt.Checksum != "" {
+		err = writeChecksumSidecar(opt.Checksum, to)
+		if err != nil {
+			return err
 		}
-		exportCoordinator.AddArtifactSummary(artifact2.StringCanonical(), destPath2, salt)
 	}
+	exportCoordinator.AddArtifactSummary(artifact.StringCanonical(), filepath.FromSlash(to), salt, "")
 	return nil
 }
 
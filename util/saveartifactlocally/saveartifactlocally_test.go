@@ -0,0 +1,60 @@
+package saveartifactlocally
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/earthly/earthly/conslogging"
+	"github.com/earthly/earthly/domain"
+	"github.com/earthly/earthly/util/gatewaycrafter"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestSaveArtifactLocallyExternalTarget(t *testing.T) {
+	wd, err := os.Getwd()
+	if !NoError(t, err) {
+		return
+	}
+	defer os.Chdir(wd)
+	if !NoError(t, os.Chdir(t.TempDir())) {
+		return
+	}
+	indexOutDir := t.TempDir()
+	src := makeArtifactDir(t, time.Unix(1000, 0))
+	if !NoError(t, os.Rename(src, filepath.Join(indexOutDir, "dist"))) {
+		return
+	}
+
+	console := conslogging.Current(conslogging.NoColor, conslogging.DefaultPadding, conslogging.Info)
+	ec := gatewaycrafter.NewExportCoordinator()
+	artifact := domain.Artifact{
+		Target:   domain.Target{LocalPath: "./sub", Target: "t"},
+		Artifact: "dist",
+	}
+	err = SaveArtifactLocally(context.Background(), ec, console, artifact, indexOutDir, "dist", "salt", false, SaveOpt{})
+	if !NoError(t, err) {
+		return
+	}
+	err = SaveArtifactLocally(context.Background(), ec, console, artifact, indexOutDir, "out.tar", "salt", false, SaveOpt{Archive: ArchiveTar})
+	if !NoError(t, err) {
+		return
+	}
+	summary := ec.GetArtifactSummary()
+	if !Len(t, summary, 2) {
+		return
+	}
+	Equal(t, filepath.Join("sub", "dist"), summary[0].Path)
+	Equal(t, filepath.Join("sub", "out.tar"), summary[1].Path)
+
+	NoError(t, WriteChecksumManifest("SHA256SUMS", ChecksumSHA256, summary))
+	dt, err := os.ReadFile("SHA256SUMS")
+	if !NoError(t, err) {
+		return
+	}
+	Contains(t, string(dt), "sub/dist/a/c.txt")
+	Contains(t, string(dt), "sub/out.tar")
+}
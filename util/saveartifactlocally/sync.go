@@ -0,0 +1,243 @@
+package saveartifactlocally
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+	reccopy "github.com/otiai10/copy"
+	"github.com/pkg/errors"
+)
+
+// SyncStats counts the files written and removed by an incremental save of an artifact.
+type SyncStats struct {
+	Added     int
+	Changed   int
+	Removed   int
+	Unchanged int
+}
+
+func (s SyncStats) String() string {
+	return fmt.Sprintf("%d added, %d changed, %d removed", s.Added, s.Changed, s.Removed)
+}
+
+// syncPath saves the file or directory from to the path to incrementally: only the files whose contents (or
+// mode, or symlink target) differ from the existing ones are written, such that the timestamps of the
+// unchanged files are preserved. When syncDelete is set, the files of the destination directory which are
+// not part of the artifact are removed.
+func syncPath(from, to string, syncDelete bool, stats *SyncStats) error {
+	fi, err := os.Lstat(from)
+	if err != nil {
+		return errors.Wrapf(err, "lstat %s", from)
+	}
+	if !fi.IsDir() {
+		return syncFile(from, to, fi, stats)
+	}
+	srcPaths := make(map[string]bool)
+	dirModes := make(map[string]fs.FileMode)
+	err = filepath.WalkDir(from, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, p)
+		if err != nil {
+			return err
+		}
+		srcPaths[rel] = true
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(to, rel)
+		if !d.IsDir() {
+			return syncFile(p, dest, fi, stats)
+		}
+		destFi, err := os.Lstat(dest)
+		if err == nil && !destFi.IsDir() {
+			err = os.Remove(dest)
+			if err != nil {
+				return errors.Wrapf(err, "rm %s", dest)
+			}
+			stats.Removed++
+		}
+		err = os.MkdirAll(dest, fi.Mode().Perm())
+		if err != nil {
+			return errors.Wrapf(err, "mkdir %s", dest)
+		}
+		destFi, err = os.Lstat(dest)
+		if err != nil {
+			return errors.Wrapf(err, "lstat %s", dest)
+		}
+		if destFi.Mode().Perm() != fi.Mode().Perm() {
+			dirModes[dest] = fi.Mode().Perm()
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "sync %s to %s", from, to)
+	}
+	// The directory modes are applied once their contents have been written, as in a full copy, such that
+	// read-only directories can be synced.
+	for dir, mode := range dirModes {
+		err = os.Chmod(dir, mode)
+		if err != nil {
+			return errors.Wrapf(err, "chmod %s", dir)
+		}
+	}
+	if !syncDelete {
+		return nil
+	}
+	err = filepath.WalkDir(to, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(to, p)
+		if err != nil {
+			return err
+		}
+		if srcPaths[rel] {
+			return nil
+		}
+		if d.IsDir() {
+			stats.Removed += countFiles(p)
+			err = os.RemoveAll(p)
+			if err != nil {
+				return errors.Wrapf(err, "rm -rf %s", p)
+			}
+			return filepath.SkipDir
+		}
+		err = os.Remove(p)
+		if err != nil {
+			return errors.Wrapf(err, "rm %s", p)
+		}
+		stats.Removed++
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "delete stale files of %s", to)
+	}
+	return nil
+}
+
+// syncFile saves the regular file or symlink from to the path to, unless an identical one already exists.
+func syncFile(from, to string, fi fs.FileInfo, stats *SyncStats) error {
+	destFi, err := os.Lstat(to)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		stats.Added++
+	case err != nil:
+		return errors.Wrapf(err, "lstat %s", to)
+	default:
+		same, err := sameFile(from, fi, to, destFi)
+		if err != nil {
+			return err
+		}
+		if same {
+			if destFi.Mode().Perm() != fi.Mode().Perm() && fi.Mode().IsRegular() {
+				err = os.Chmod(to, fi.Mode().Perm())
+				if err != nil {
+					return errors.Wrapf(err, "chmod %s", to)
+				}
+				stats.Changed++
+				return nil
+			}
+			stats.Unchanged++
+			return nil
+		}
+		if destFi.IsDir() {
+			err = os.RemoveAll(to)
+		} else {
+			err = os.Remove(to)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "rm %s", to)
+		}
+		stats.Changed++
+	}
+	err = os.MkdirAll(filepath.Dir(to), 0755)
+	if err != nil {
+		return errors.Wrapf(err, "mkdir all for artifact %s", filepath.Dir(to))
+	}
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(from)
+		if err != nil {
+			return errors.Wrapf(err, "readlink %s", from)
+		}
+		err = os.Symlink(target, to)
+		if err != nil {
+			return errors.Wrapf(err, "symlink %s", to)
+		}
+		return nil
+	}
+	err = os.Link(from, to)
+	if err != nil {
+		// Hard linking did not work. Try copying.
+		errCopy := reccopy.Copy(from, to)
+		if errCopy != nil {
+			return errors.Wrapf(errCopy, "copy artifact %s", from)
+		}
+	}
+	return nil
+}
+
+// sameFile returns whether the existing destination file has the same contents as the source file, or,
+// for symlinks, the same target.
+func sameFile(from string, fi fs.FileInfo, to string, destFi fs.FileInfo) (bool, error) {
+	if fi.Mode().Type() != destFi.Mode().Type() {
+		return false, nil
+	}
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		srcTarget, err := os.Readlink(from)
+		if err != nil {
+			return false, errors.Wrapf(err, "readlink %s", from)
+		}
+		destTarget, err := os.Readlink(to)
+		if err != nil {
+			return false, errors.Wrapf(err, "readlink %s", to)
+		}
+		return srcTarget == destTarget, nil
+	}
+	if !fi.Mode().IsRegular() || fi.Size() != destFi.Size() {
+		return false, nil
+	}
+	if os.SameFile(fi, destFi) {
+		// Hard linked by a previous save.
+		return true, nil
+	}
+	srcDigest, err := fileDigest(from)
+	if err != nil {
+		return false, err
+	}
+	destDigest, err := fileDigest(to)
+	if err != nil {
+		return false, err
+	}
+	return srcDigest == destDigest, nil
+}
+
+func fileDigest(p string) (digest.Digest, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", errors.Wrapf(err, "open %s", p)
+	}
+	defer f.Close()
+	dgst, err := digest.FromReader(f)
+	if err != nil {
+		return "", errors.Wrapf(err, "read %s", p)
+	}
+	return dgst, nil
+}
+
+// countFiles returns the number of files within the directory dir.
+func countFiles(dir string) int {
+	n := 0
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
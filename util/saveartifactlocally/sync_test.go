@@ -0,0 +1,65 @@
+package saveartifactlocally
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestSyncPath(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "dist")
+	var stats SyncStats
+	NoError(t, syncPath(makeArtifactDir(t, time.Unix(1000, 0)), dest, false, &stats))
+	Equal(t, SyncStats{Added: 3}, stats)
+
+	// Mark the existing files, such that rewrites can be detected.
+	old := time.Unix(500, 0)
+	for _, f := range []string{"b.txt", "a/z.txt", "a/c.txt"} {
+		NoError(t, os.Chtimes(filepath.Join(dest, f), old, old))
+	}
+	NoError(t, os.WriteFile(filepath.Join(dest, "stale.txt"), []byte("stale"), 0644))
+	NoError(t, os.MkdirAll(filepath.Join(dest, "stale"), 0755))
+	NoError(t, os.WriteFile(filepath.Join(dest, "stale", "x.txt"), []byte("x"), 0644))
+
+	src := makeArtifactDir(t, time.Unix(2000, 0))
+	NoError(t, os.WriteFile(filepath.Join(src, "b.txt"), []byte("changed"), 0644))
+	NoError(t, os.WriteFile(filepath.Join(src, "new.txt"), []byte("new"), 0644))
+	stats = SyncStats{}
+	NoError(t, syncPath(src, dest, false, &stats))
+	Equal(t, SyncStats{Added: 1, Changed: 1, Unchanged: 2}, stats)
+	fi, err := os.Stat(filepath.Join(dest, "a/z.txt"))
+	NoError(t, err)
+	True(t, fi.ModTime().Equal(old), "unchanged file was rewritten")
+	dt, err := os.ReadFile(filepath.Join(dest, "b.txt"))
+	NoError(t, err)
+	Equal(t, "changed", string(dt))
+	FileExists(t, filepath.Join(dest, "stale.txt"))
+
+	stats = SyncStats{}
+	NoError(t, syncPath(src, dest, true, &stats))
+	Equal(t, SyncStats{Removed: 2, Unchanged: 4}, stats)
+	NoFileExists(t, filepath.Join(dest, "stale.txt"))
+	NoDirExists(t, filepath.Join(dest, "stale"))
+	FileExists(t, filepath.Join(dest, "new.txt"))
+}
+
+func TestSyncPathDirMode(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "dist")
+	src := makeArtifactDir(t, time.Unix(1000, 0))
+	var stats SyncStats
+	NoError(t, syncPath(src, dest, false, &stats))
+	fi, err := os.Stat(filepath.Join(dest, "a"))
+	NoError(t, err)
+	Equal(t, os.FileMode(0755), fi.Mode().Perm())
+
+	NoError(t, os.Chmod(filepath.Join(src, "a"), 0700))
+	stats = SyncStats{}
+	NoError(t, syncPath(src, dest, false, &stats))
+	Equal(t, SyncStats{Unchanged: 3}, stats)
+	fi, err = os.Stat(filepath.Join(dest, "a"))
+	NoError(t, err)
+	Equal(t, os.FileMode(0700), fi.Mode().Perm())
+}
@@ -0,0 +1,389 @@
+// Package sbom generates software bills of materials (SBOMs) for images, by scanning their filesystem
+// for OS packages and language lockfiles.
+package sbom
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/earthly/earthly/util/llbutil"
+	"github.com/earthly/earthly/util/llbutil/pllb"
+	"github.com/earthly/earthly/util/platutil"
+	"github.com/moby/buildkit/client/llb"
+	gwclient "github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/pkg/errors"
+)
+
+const (
+	// FormatSPDX is the SPDX 2.3 JSON format.
+	FormatSPDX = "spdx"
+	// FormatCycloneDX is the CycloneDX 1.4 JSON format.
+	FormatCycloneDX = "cyclonedx"
+
+	// PredicateTypeSPDX is the in-toto predicate type of SPDX documents.
+	PredicateTypeSPDX = "https://spdx.dev/Document"
+	// PredicateTypeCycloneDX is the in-toto predicate type of CycloneDX documents.
+	PredicateTypeCycloneDX = "https://cyclonedx.org/bom"
+)
+
+// ValidateFormat returns an error if the given SBOM format is not supported.
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatSPDX, FormatCycloneDX:
+		return nil
+	default:
+		return errors.Errorf("unsupported SBOM format %q; valid options are %s and %s", format, FormatSPDX, FormatCycloneDX)
+	}
+}
+
+// FileExtension returns the extension of SBOM files of the given format.
+func FileExtension(format string) string {
+	if format == FormatCycloneDX {
+		return ".cdx.json"
+	}
+	return ".spdx.json"
+}
+
+// PredicateType returns the in-toto predicate type of SBOMs of the given format.
+func PredicateType(format string) string {
+	if format == FormatCycloneDX {
+		return PredicateTypeCycloneDX
+	}
+	return PredicateTypeSPDX
+}
+
+// Encode returns the SBOM document describing the image name, with the given packages.
+func Encode(format, name string, pkgs []Package, created time.Time) ([]byte, error) {
+	var doc interface{}
+	switch format {
+	case FormatSPDX:
+		doc = spdxDocument(name, pkgs, created)
+	case FormatCycloneDX:
+		doc = cycloneDXDocument(name, pkgs, created)
+	default:
+		return nil, ValidateFormat(format)
+	}
+	dt, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshal %s sbom", format)
+	}
+	return dt, nil
+}
+
+// documentID returns an ID which is unique to the contents of the document, such that generating the
+// SBOM of the same image twice results in the same document.
+func documentID(name string, pkgs []Package) string {
+	h := sha256.New()
+	fmt.Fprintln(h, name)
+	for _, p := range pkgs {
+		fmt.Fprintln(h, p.PURL())
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+type spdxDoc struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	PrimaryPurpose   string            `json:"primaryPackagePurpose,omitempty"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func spdxDocument(name string, pkgs []Package, created time.Time) spdxDoc {
+	const imageID = "SPDXRef-Image"
+	doc := spdxDoc{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: fmt.Sprintf("https://earthly.dev/spdxdocs/%s", documentID(name, pkgs)),
+		CreationInfo: spdxCreationInfo{
+			Created:  created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: earthly"},
+		},
+		Packages: []spdxPackage{{
+			Name:             name,
+			SPDXID:           imageID,
+			DownloadLocation: "NOASSERTION",
+			PrimaryPurpose:   "CONTAINER",
+		}},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: imageID,
+		}},
+	}
+	for i, p := range pkgs {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i)
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             p.Name,
+			SPDXID:           id,
+			VersionInfo:      p.Version,
+			DownloadLocation: "NOASSERTION",
+			SourceInfo:       fmt.Sprintf("acquired package info from %s", p.Location),
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  p.PURL(),
+			}},
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      imageID,
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: id,
+		})
+	}
+	return doc
+}
+
+type cdxDoc struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     []cdxTool    `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTool struct {
+	Vendor string `json:"vendor"`
+	Name   string `json:"name"`
+}
+
+type cdxComponent struct {
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Type       string        `json:"type"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func cycloneDXDocument(name string, pkgs []Package, created time.Time) cdxDoc {
+	id := documentID(name, pkgs)
+	doc := cdxDoc{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: fmt.Sprintf("urn:uuid:%s-%s-%s-%s-%s", id[0:8], id[8:12], id[12:16], id[16:20], id[20:32]),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: created.UTC().Format(time.RFC3339),
+			Tools:     []cdxTool{{Vendor: "Earthly", Name: "earthly"}},
+			Component: cdxComponent{Type: "container", Name: name},
+		},
+		Components: []cdxComponent{},
+	}
+	for _, p := range pkgs {
+		purl := p.PURL()
+		doc.Components = append(doc.Components, cdxComponent{
+			BOMRef:     purl,
+			Type:       "library",
+			Name:       p.Name,
+			Version:    p.Version,
+			PURL:       purl,
+			Properties: []cdxProperty{{Name: "earthly:location", Value: p.Location}},
+		})
+	}
+	return doc
+}
+
+// refFS is the filesystem of a solved buildkit reference.
+type refFS struct {
+	ref gwclient.Reference
+}
+
+func (r *refFS) ReadFile(ctx context.Context, p string) ([]byte, error) {
+	_, err := r.ref.StatFile(ctx, gwclient.StatRequest{Path: p})
+	if err != nil {
+		// The gateway does not expose the error kind; treat any stat failure as a missing file.
+		return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+	}
+	dt, err := r.ref.ReadFile(ctx, gwclient.ReadRequest{Filename: p})
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", p)
+	}
+	return dt, nil
+}
+
+func (r *refFS) ReadDir(ctx context.Context, p string) ([]DirEntry, error) {
+	st, err := r.ref.StatFile(ctx, gwclient.StatRequest{Path: p})
+	if err != nil || !st.IsDir() {
+		return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+	}
+	stats, err := r.ref.ReadDir(ctx, gwclient.ReadDirRequest{Path: p})
+	if err != nil {
+		return nil, errors.Wrapf(err, "read dir %s", p)
+	}
+	entries := make([]DirEntry, 0, len(stats))
+	for _, st := range stats {
+		entries = append(entries, DirEntry{Name: path.Base(st.Path), IsDir: st.IsDir()})
+	}
+	return entries, nil
+}
+
+const rpmQueryOutDir = "/earthly-sbom"
+
+// rpmQuery returns a function which runs rpm within the image, to list its installed packages.
+func rpmQuery(gwClient gwclient.Client, state pllb.State, platr *platutil.Resolver) RPMQueryFunc {
+	return func(ctx context.Context) ([]byte, error) {
+		cmd := fmt.Sprintf(`rpm -qa --qf '%%{NAME}\t%%{VERSION}-%%{RELEASE}\t%%{ARCH}\n' > %s/rpm.txt`, rpmQueryOutDir)
+		out := state.Run(
+			llb.Args([]string{"/bin/sh", "-c", cmd}),
+			llb.WithCustomName("[sbom] query rpm database"),
+		).AddMount(rpmQueryOutDir, pllb.Scratch())
+		ref, err := llbutil.StateToRef(ctx, gwClient, out, false, platr, nil)
+		if err != nil {
+			return nil, err
+		}
+		return ref.ReadFile(ctx, gwclient.ReadRequest{Filename: "rpm.txt"})
+	}
+}
+
+// GenerateOpt holds the options of Generate.
+type GenerateOpt struct {
+	GwClient         gwclient.Client
+	Ref              gwclient.Reference // the solved image
+	State            pllb.State         // the state of the image, used for querying the rpm database
+	PlatformResolver *platutil.Resolver
+	Name             string // the image name
+	Format           string
+	WorkDir          string // the WORKDIR of the image, which is searched for lockfiles
+	Created          time.Time
+}
+
+// Generate scans the solved image and returns its SBOM document.
+func Generate(ctx context.Context, opt GenerateOpt) ([]byte, error) {
+	pkgs, err := Scan(ctx, &refFS{ref: opt.Ref}, opt.WorkDir, rpmQuery(opt.GwClient, opt.State, opt.PlatformResolver))
+	if err != nil {
+		return nil, errors.Wrapf(err, "scan image %s", opt.Name)
+	}
+	return Encode(opt.Format, opt.Name, pkgs, opt.Created)
+}
+
+// Entry is an SBOM generated during a build.
+type Entry struct {
+	Target    string
+	Salt      string
+	DockerTag string
+	Platform  string // set for the platforms of multi-platform images
+	Format    string
+	Document  []byte
+	LocalPath string // where to write the document on the host, if anywhere
+	Push      bool   // whether to attach the document to the pushed image
+}
+
+// Collector is a thread-safe store of the SBOMs generated during a build.
+type Collector struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewCollector returns a new Collector.
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// Add adds an SBOM entry, replacing any entry for the same image and platform.
+func (c *Collector) Add(e Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, existing := range c.entries {
+		if existing.DockerTag == e.DockerTag && existing.Platform == e.Platform {
+			c.entries[i] = e
+			return
+		}
+	}
+	c.entries = append(c.entries, e)
+}
+
+// AddImage generates the SBOM of a solved image, and adds it to the collector.
+func (c *Collector) AddImage(ctx context.Context, opt GenerateOpt, e Entry) error {
+	if c == nil {
+		return nil
+	}
+	doc, err := Generate(ctx, opt)
+	if err != nil {
+		return err
+	}
+	e.Format = opt.Format
+	e.Document = doc
+	c.Add(e)
+	return nil
+}
+
+// Entries returns all the SBOM entries.
+func (c *Collector) Entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Entry(nil), c.entries...)
+}
+
+// LocalPath returns the host path of the SBOM of an image. SBOMs of images written via --oci-tar are
+// placed next to the tarball; other SBOMs are placed in the sbom dir of the Earthfile.
+func LocalPath(earthfileDir, ociTar, dockerTag, platform, format string) string {
+	name := sanitizeName(dockerTag)
+	if platform != "" {
+		name += "_" + sanitizeName(platform)
+	}
+	if ociTar != "" {
+		base := strings.TrimSuffix(ociTar, path.Ext(ociTar))
+		if platform != "" {
+			base += "_" + sanitizeName(platform)
+		}
+		return base + FileExtension(format)
+	}
+	return path.Join(earthfileDir, "sbom", name+FileExtension(format))
+}
+
+func sanitizeName(s string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(s)
+}
@@ -0,0 +1,115 @@
+package sbom
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+// mapFS is an in-memory FS, keyed by absolute file path.
+type mapFS map[string]string
+
+func (m mapFS) ReadFile(ctx context.Context, p string) ([]byte, error) {
+	dt, ok := m[p]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+	return []byte(dt), nil
+}
+
+func (m mapFS) ReadDir(ctx context.Context, p string) ([]DirEntry, error) {
+	seen := map[string]bool{}
+	var entries []DirEntry
+	for f := range m {
+		if !strings.HasPrefix(f, p+"/") {
+			continue
+		}
+		rest := strings.TrimPrefix(f, p+"/")
+		name := strings.Split(rest, "/")[0]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		entries = append(entries, DirEntry{Name: name, IsDir: strings.Contains(rest, "/")})
+	}
+	if len(entries) == 0 {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+	return entries, nil
+}
+
+func TestScan(t *testing.T) {
+	fsys := mapFS{
+		"/etc/os-release": "NAME=\"Debian GNU/Linux\"\nID=debian\n",
+		"/var/lib/dpkg/status": "Package: libc6\nStatus: install ok installed\nVersion: 2.31-13\nArchitecture: amd64\nDescription: GNU C Library\n continued\n\n" +
+			"Package: removed\nStatus: deinstall ok config-files\nVersion: 1.0\n",
+		"/var/lib/rpm/Packages": "",
+		"/app/go.sum":           "github.com/pkg/errors v0.9.1 h1:abc=\ngithub.com/pkg/errors v0.9.1/go.mod h1:def=\n",
+		"/app/web/package-lock.json": `{"lockfileVersion":2,"packages":{"":{"name":"web"},"node_modules/@types/node":{"version":"18.0.0"},` +
+			`"node_modules/left-pad":{"version":"1.3.0"},"node_modules/left-pad/node_modules/x":{"version":"0.1.0"}}}`,
+		"/app/node_modules/ignored/requirements.txt": "ignored==1.0\n",
+		"/srv/requirements.txt":                      "# comment\nRequests[security]==2.28.1 ; python_version > '3'\nflask>=2.0\n-r other.txt\n",
+		"/srv/again/go.sum":                          "github.com/pkg/errors v0.9.1 h1:abc=\n",
+	}
+	queryRPM := func(ctx context.Context) ([]byte, error) {
+		return []byte("bash\t5.1-2.fc36\tx86_64\ngpg-pubkey\t1-1\t(none)\n"), nil
+	}
+	pkgs, err := Scan(context.Background(), fsys, "/app", queryRPM)
+	if !NoError(t, err) {
+		return
+	}
+	var purls []string
+	for _, p := range pkgs {
+		purls = append(purls, p.PURL())
+	}
+	Equal(t, []string{
+		"pkg:deb/debian/libc6@2.31-13?arch=amd64",
+		"pkg:golang/github.com/pkg/errors@v0.9.1",
+		"pkg:npm/%40types/node@18.0.0",
+		"pkg:npm/left-pad@1.3.0",
+		"pkg:npm/x@0.1.0",
+		"pkg:pypi/requests@2.28.1",
+		"pkg:pypi/flask",
+		"pkg:rpm/debian/bash@5.1-2.fc36?arch=x86_64",
+	}, purls)
+	Equal(t, path.Join("/app", "go.sum"), pkgs[1].Location)
+}
+
+func TestEncode(t *testing.T) {
+	pkgs := []Package{{Name: "musl", Version: "1.2.3-r0", Type: typeApk, Arch: "x86_64", Distro: "alpine", Location: apkInstalledPath}}
+	created := time.Unix(1600000000, 0)
+
+	dt, err := Encode(FormatSPDX, "example/app:latest", pkgs, created)
+	NoError(t, err)
+	var spdx spdxDoc
+	NoError(t, json.Unmarshal(dt, &spdx))
+	Equal(t, "SPDX-2.3", spdx.SPDXVersion)
+	Len(t, spdx.Packages, 2)
+	Equal(t, "pkg:apk/alpine/musl@1.2.3-r0?arch=x86_64", spdx.Packages[1].ExternalRefs[0].ReferenceLocator)
+	Equal(t, "2020-09-13T12:26:40Z", spdx.CreationInfo.Created)
+
+	dt2, err := Encode(FormatSPDX, "example/app:latest", pkgs, created)
+	NoError(t, err)
+	Equal(t, string(dt), string(dt2))
+
+	dt, err = Encode(FormatCycloneDX, "example/app:latest", pkgs, created)
+	NoError(t, err)
+	var cdx cdxDoc
+	NoError(t, json.Unmarshal(dt, &cdx))
+	Equal(t, "CycloneDX", cdx.BOMFormat)
+	Equal(t, "musl", cdx.Components[0].Name)
+
+	_, err = Encode("swid", "example/app:latest", pkgs, created)
+	Error(t, err)
+}
+
+func TestLocalPath(t *testing.T) {
+	Equal(t, "dir/sbom/example_app_latest.spdx.json", LocalPath("dir", "", "example/app:latest", "", FormatSPDX))
+	Equal(t, "out/app_linux_arm64.cdx.json", LocalPath("dir", "out/app.tar", "example/app:latest", "linux/arm64", FormatCycloneDX))
+}
@@ -0,0 +1,441 @@
+package sbom
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Package types, as used in package URLs.
+const (
+	typeDeb    = "deb"
+	typeApk    = "apk"
+	typeRPM    = "rpm"
+	typeGolang = "golang"
+	typeNPM    = "npm"
+	typePyPI   = "pypi"
+)
+
+// Package is a software package found in an image.
+type Package struct {
+	Name     string
+	Version  string
+	Type     string // the package URL type (deb, apk, rpm, golang, npm or pypi)
+	Arch     string
+	Distro   string // the distro ID from /etc/os-release, for OS packages
+	Location string // the file the package was found in
+}
+
+// PURL returns the package URL of the package.
+func (p Package) PURL() string {
+	name := p.Name
+	switch p.Type {
+	case typeNPM:
+		name = strings.Replace(name, "@", "%40", 1)
+	case typePyPI:
+		name = strings.ReplaceAll(strings.ToLower(name), "_", "-")
+	}
+	purl := "pkg:" + p.Type + "/"
+	if p.Distro != "" {
+		purl += p.Distro + "/"
+	}
+	purl += name
+	if p.Version != "" {
+		purl += "@" + p.Version
+	}
+	if p.Arch != "" {
+		purl += "?arch=" + p.Arch
+	}
+	return purl
+}
+
+// FS is the read-only filesystem of an image.
+type FS interface {
+	// ReadFile returns the contents of the file, or an error satisfying os.IsNotExist.
+	ReadFile(ctx context.Context, p string) ([]byte, error)
+	// ReadDir returns the entries of the dir, or an error satisfying os.IsNotExist.
+	ReadDir(ctx context.Context, p string) ([]DirEntry, error)
+}
+
+// DirEntry is an entry of a dir within an FS.
+type DirEntry struct {
+	Name  string
+	IsDir bool
+}
+
+const (
+	dpkgStatusPath   = "/var/lib/dpkg/status"
+	dpkgStatusDPath  = "/var/lib/dpkg/status.d"
+	apkInstalledPath = "/lib/apk/db/installed"
+	osReleasePath    = "/etc/os-release"
+	maxScanDepth     = 8
+)
+
+// rpmDBPaths are the locations of the rpm database, in the various distros.
+var rpmDBPaths = []string{"/var/lib/rpm", "/usr/lib/sysimage/rpm"}
+
+// lockfileRoots are the dirs which are searched for language lockfiles, in addition to the WORKDIR
+// of the image. System dirs are not searched, to keep the scan fast.
+var lockfileRoots = []string{"/app", "/src", "/go/src", "/usr/src", "/usr/local/src", "/opt", "/srv", "/home", "/root"}
+
+// skipDirs are never descended into, when searching for lockfiles.
+var skipDirs = map[string]bool{".git": true, "node_modules": true, "vendor": true, "__pycache__": true, ".cache": true}
+
+// RPMQueryFunc returns the installed rpm packages, one "name\tversion\tarch" line per package.
+type RPMQueryFunc func(ctx context.Context) ([]byte, error)
+
+// Scan returns the OS packages and language dependencies found in the image filesystem, sorted by
+// type, name and version.
+func Scan(ctx context.Context, fsys FS, workDir string, queryRPM RPMQueryFunc) ([]Package, error) {
+	distro, err := readDistro(ctx, fsys)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []Package
+
+	dt, err := fsys.ReadFile(ctx, dpkgStatusPath)
+	if err == nil {
+		pkgs = append(pkgs, parseDpkgStatus(dt, distro, dpkgStatusPath)...)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	entries, err := fsys.ReadDir(ctx, dpkgStatusDPath)
+	if err == nil {
+		// Distroless images keep one status file per package.
+		for _, e := range entries {
+			if e.IsDir {
+				continue
+			}
+			p := path.Join(dpkgStatusDPath, e.Name)
+			dt, err := fsys.ReadFile(ctx, p)
+			if err != nil {
+				return nil, err
+			}
+			pkgs = append(pkgs, parseDpkgStatus(dt, distro, p)...)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	dt, err = fsys.ReadFile(ctx, apkInstalledPath)
+	if err == nil {
+		pkgs = append(pkgs, parseApkInstalled(dt, distro, apkInstalledPath)...)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, dbPath := range rpmDBPaths {
+		_, err := fsys.ReadDir(ctx, dbPath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if queryRPM == nil {
+			break
+		}
+		dt, err := queryRPM(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "query rpm database")
+		}
+		pkgs = append(pkgs, parseRPMQuery(dt, distro, dbPath)...)
+		break
+	}
+
+	roots := lockfileRoots
+	if workDir != "" && workDir != "/" {
+		roots = append([]string{path.Clean(workDir)}, roots...)
+	}
+	seenDirs := map[string]bool{}
+	for _, root := range roots {
+		found, err := scanLockfiles(ctx, fsys, root, 0, seenDirs)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, found...)
+	}
+
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		if pkgs[i].Type != pkgs[j].Type {
+			return pkgs[i].Type < pkgs[j].Type
+		}
+		if pkgs[i].Name != pkgs[j].Name {
+			return pkgs[i].Name < pkgs[j].Name
+		}
+		return pkgs[i].Version < pkgs[j].Version
+	})
+	// The same dependency may be listed by several lockfiles.
+	deduped := pkgs[:0]
+	seenPURLs := map[string]bool{}
+	for _, p := range pkgs {
+		purl := p.PURL()
+		if seenPURLs[purl] {
+			continue
+		}
+		seenPURLs[purl] = true
+		deduped = append(deduped, p)
+	}
+	return deduped, nil
+}
+
+func readDistro(ctx context.Context, fsys FS) (string, error) {
+	dt, err := fsys.ReadFile(ctx, osReleasePath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(dt), "\n") {
+		if strings.HasPrefix(line, "ID=") {
+			return strings.Trim(strings.TrimPrefix(line, "ID="), `"'`), nil
+		}
+	}
+	return "", nil
+}
+
+func scanLockfiles(ctx context.Context, fsys FS, dir string, depth int, seen map[string]bool) ([]Package, error) {
+	if depth > maxScanDepth || seen[dir] {
+		return nil, nil
+	}
+	seen[dir] = true
+	entries, err := fsys.ReadDir(ctx, dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []Package
+	for _, e := range entries {
+		p := path.Join(dir, e.Name)
+		if e.IsDir {
+			if skipDirs[e.Name] {
+				continue
+			}
+			found, err := scanLockfiles(ctx, fsys, p, depth+1, seen)
+			if err != nil {
+				return nil, err
+			}
+			pkgs = append(pkgs, found...)
+			continue
+		}
+		var parse func([]byte, string) ([]Package, error)
+		switch e.Name {
+		case "go.sum":
+			parse = parseGoSum
+		case "package-lock.json":
+			parse = parsePackageLock
+		case "requirements.txt":
+			parse = parseRequirements
+		default:
+			continue
+		}
+		dt, err := fsys.ReadFile(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		found, err := parse(dt, p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse %s", p)
+		}
+		pkgs = append(pkgs, found...)
+	}
+	return pkgs, nil
+}
+
+// parseStanzas splits a dpkg status or apk installed database into its "Key: value" stanzas.
+func parseStanzas(dt []byte, sep string) []map[string]string {
+	var stanzas []map[string]string
+	cur := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(dt))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			if len(cur) > 0 {
+				stanzas = append(stanzas, cur)
+				cur = map[string]string{}
+			}
+			continue
+		}
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue // continuation line
+		}
+		i := strings.Index(line, sep)
+		if i == -1 {
+			continue
+		}
+		cur[line[:i]] = strings.TrimSpace(line[i+len(sep):])
+	}
+	if len(cur) > 0 {
+		stanzas = append(stanzas, cur)
+	}
+	return stanzas
+}
+
+func parseDpkgStatus(dt []byte, distro, location string) []Package {
+	var pkgs []Package
+	for _, s := range parseStanzas(dt, ":") {
+		if s["Package"] == "" {
+			continue
+		}
+		if status, ok := s["Status"]; ok && !strings.HasSuffix(status, " installed") {
+			continue
+		}
+		pkgs = append(pkgs, Package{
+			Name:     s["Package"],
+			Version:  s["Version"],
+			Type:     typeDeb,
+			Arch:     s["Architecture"],
+			Distro:   distro,
+			Location: location,
+		})
+	}
+	return pkgs
+}
+
+func parseApkInstalled(dt []byte, distro, location string) []Package {
+	var pkgs []Package
+	for _, s := range parseStanzas(dt, ":") {
+		if s["P"] == "" {
+			continue
+		}
+		pkgs = append(pkgs, Package{
+			Name:     s["P"],
+			Version:  s["V"],
+			Type:     typeApk,
+			Arch:     s["A"],
+			Distro:   distro,
+			Location: location,
+		})
+	}
+	return pkgs
+}
+
+func parseRPMQuery(dt []byte, distro, location string) []Package {
+	var pkgs []Package
+	for _, line := range strings.Split(string(dt), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) != 3 || fields[0] == "gpg-pubkey" {
+			continue
+		}
+		pkgs = append(pkgs, Package{
+			Name:     fields[0],
+			Version:  fields[1],
+			Type:     typeRPM,
+			Arch:     fields[2],
+			Distro:   distro,
+			Location: location,
+		})
+	}
+	return pkgs
+}
+
+func parseGoSum(dt []byte, location string) ([]Package, error) {
+	var pkgs []Package
+	seen := map[string]bool{}
+	for _, line := range strings.Split(string(dt), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		version := strings.TrimSuffix(fields[1], "/go.mod")
+		key := fields[0] + "@" + version
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		pkgs = append(pkgs, Package{Name: fields[0], Version: version, Type: typeGolang, Location: location})
+	}
+	return pkgs, nil
+}
+
+type packageLock struct {
+	Packages     map[string]packageLockEntry `json:"packages"`
+	Dependencies map[string]packageLockEntry `json:"dependencies"`
+}
+
+type packageLockEntry struct {
+	Version      string                      `json:"version"`
+	Link         bool                        `json:"link"`
+	Dependencies map[string]packageLockEntry `json:"dependencies"`
+}
+
+func parsePackageLock(dt []byte, location string) ([]Package, error) {
+	var lock packageLock
+	err := json.Unmarshal(dt, &lock)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var pkgs []Package
+	add := func(name, version string) {
+		key := name + "@" + version
+		if name == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		pkgs = append(pkgs, Package{Name: name, Version: version, Type: typeNPM, Location: location})
+	}
+	if len(lock.Packages) > 0 {
+		// lockfileVersion 2 and 3.
+		for p, entry := range lock.Packages {
+			i := strings.LastIndex(p, "node_modules/")
+			if i == -1 || entry.Link {
+				continue // the root package, or a workspace link
+			}
+			add(p[i+len("node_modules/"):], entry.Version)
+		}
+		return pkgs, nil
+	}
+	// lockfileVersion 1.
+	var walk func(deps map[string]packageLockEntry)
+	walk = func(deps map[string]packageLockEntry) {
+		for name, entry := range deps {
+			add(name, entry.Version)
+			walk(entry.Dependencies)
+		}
+	}
+	walk(lock.Dependencies)
+	return pkgs, nil
+}
+
+func parseRequirements(dt []byte, location string) ([]Package, error) {
+	var pkgs []Package
+	for _, line := range strings.Split(string(dt), "\n") {
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		if i := strings.Index(line, ";"); i != -1 {
+			line = line[:i] // environment markers
+		}
+		line = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), "\\"))
+		if line == "" || strings.HasPrefix(line, "-") || strings.Contains(line, "://") {
+			continue
+		}
+		name, version := line, ""
+		if i := strings.Index(line, "=="); i != -1 {
+			name, version = line[:i], strings.TrimSpace(line[i+2:])
+		} else if i := strings.IndexAny(line, "<>=!~ "); i != -1 {
+			name = line[:i]
+		}
+		if i := strings.Index(name, "["); i != -1 {
+			name = name[:i] // extras
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		pkgs = append(pkgs, Package{Name: name, Version: version, Type: typePyPI, Location: location})
+	}
+	return pkgs, nil
+}
@@ -23,6 +23,9 @@ type Group struct {
 	errOnce sync.Once
 	err     error
 	errMu   sync.Mutex
+
+	keepGoing bool
+	errs      []error
 }
 
 // WithContext returns a new Group and an associated Context derived from ctx.
@@ -35,6 +38,25 @@ func WithContext(ctx context.Context) (*Group, context.Context) {
 	return &Group{cancel: cancel}, ctx
 }
 
+// WithContextKeepGoing returns a new Group and an associated Context derived
+// from ctx. Unlike WithContext, an error returned by a function passed to Go
+// neither cancels the derived Context nor prevents further work from being
+// added; all errors are collected and made available via Errs.
+//
+// The derived Context is canceled the first time Wait returns.
+func WithContextKeepGoing(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{cancel: cancel, keepGoing: true}, ctx
+}
+
+// Errs returns all the non-nil errors of the goroutines started by Go, in the
+// order they occurred.
+func (g *Group) Errs() []error {
+	g.errMu.Lock()
+	defer g.errMu.Unlock()
+	return append([]error(nil), g.errs...)
+}
+
 // Err returns the first non-nil error (if any) of all goroutines started by Go.
 func (g *Group) Err() error {
 	g.errMu.Lock()
@@ -54,11 +76,11 @@ func (g *Group) Wait() error {
 
 // Go calls the given function in a new goroutine.
 //
-// The first call to return a non-nil error cancels the group; its error will be
-// returned by Wait.
+// The first call to return a non-nil error cancels the group, unless it was
+// created via WithContextKeepGoing; its error will be returned by Wait.
 func (g *Group) Go(f func() error) {
 	g.errMu.Lock()
-	if g.err != nil {
+	if g.err != nil && !g.keepGoing {
 		g.errMu.Unlock()
 		// Don't add more work if there has been an error.
 		return
@@ -71,11 +93,14 @@ func (g *Group) Go(f func() error) {
 		defer g.wg.Done()
 
 		if err := f(); err != nil {
+			g.errMu.Lock()
+			g.errs = append(g.errs, err)
+			g.errMu.Unlock()
 			g.errOnce.Do(func() {
 				g.errMu.Lock()
 				defer g.errMu.Unlock()
 				g.err = err
-				if g.cancel != nil {
+				if g.cancel != nil && !g.keepGoing {
 					g.cancel()
 				}
 			})
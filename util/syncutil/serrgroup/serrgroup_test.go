@@ -0,0 +1,46 @@
+package serrgroup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestKeepGoing(t *testing.T) {
+	errA := errors.New("a")
+	errB := errors.New("b")
+	g, ctx := WithContextKeepGoing(context.Background())
+	g.Go(func() error {
+		return errA
+	})
+	g.Go(func() error {
+		// Give the failing function a chance to run first.
+		time.Sleep(50 * time.Millisecond)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		g.Go(func() error {
+			return errB
+		})
+		return nil
+	})
+	Equal(t, errA, g.Wait())
+	Equal(t, []error{errA, errB}, g.Errs())
+}
+
+func TestCancelOnError(t *testing.T) {
+	errA := errors.New("a")
+	g, ctx := WithContext(context.Background())
+	g.Go(func() error {
+		return errA
+	})
+	<-ctx.Done()
+	g.Go(func() error {
+		t.Error("work should not be added after an error")
+		return nil
+	})
+	Equal(t, errA, g.Wait())
+}
@@ -0,0 +1,212 @@
+// Package watchutil detects changes to the local files used by a build.
+package watchutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tonistiigi/fsutil"
+)
+
+// Set records the local files used by a build: build context dirs (optionally limited to a set of
+// include patterns) and individual files, such as Earthfiles. A nil *Set is valid and records nothing.
+type Set struct {
+	mu    sync.Mutex
+	dirs  map[string]*watchedDir
+	files map[string]struct{}
+}
+
+type watchedDir struct {
+	all      bool
+	includes map[string]struct{}
+	excludes []string
+}
+
+// NewSet returns a new, empty Set.
+func NewSet() *Set {
+	return &Set{
+		dirs:  make(map[string]*watchedDir),
+		files: make(map[string]struct{}),
+	}
+}
+
+// AddIncludes records that the files of dir matching the given include patterns are used by the build.
+// The excludes are the exclude patterns the build applies to dir (e.g. from .earthlyignore).
+func (s *Set) AddIncludes(dir string, patterns []string, excludes []string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wd := s.dir(dir, excludes)
+	for _, p := range patterns {
+		wd.includes[p] = struct{}{}
+	}
+}
+
+// AddDir records that all the files of dir, except for the given exclude patterns, are used by the build.
+func (s *Set) AddDir(dir string, excludes []string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir(dir, excludes).all = true
+}
+
+// AddFile records that a single file is used by the build.
+func (s *Set) AddFile(path string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[filepath.Clean(path)] = struct{}{}
+}
+
+// Empty returns true if nothing has been recorded.
+func (s *Set) Empty() bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.dirs) == 0 && len(s.files) == 0
+}
+
+func (s *Set) dir(dir string, excludes []string) *watchedDir {
+	dir = filepath.Clean(dir)
+	wd, ok := s.dirs[dir]
+	if !ok {
+		wd = &watchedDir{includes: make(map[string]struct{})}
+		s.dirs[dir] = wd
+	}
+	wd.excludes = excludes
+	return wd
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+	mode    os.FileMode
+}
+
+// Snapshot is the state of the files of a Set at a point in time.
+type Snapshot map[string]fileState
+
+// Snapshot walks the recorded dirs and files and returns their current state.
+func (s *Set) Snapshot(ctx context.Context) (Snapshot, error) {
+	snap := make(Snapshot)
+	if s == nil {
+		return snap, nil
+	}
+	s.mu.Lock()
+	dirs := make(map[string]*watchedDir, len(s.dirs))
+	for dir, wd := range s.dirs {
+		cp := &watchedDir{all: wd.all, includes: make(map[string]struct{}, len(wd.includes)), excludes: wd.excludes}
+		for p := range wd.includes {
+			cp.includes[p] = struct{}{}
+		}
+		dirs[dir] = cp
+	}
+	files := make([]string, 0, len(s.files))
+	for f := range s.files {
+		files = append(files, f)
+	}
+	s.mu.Unlock()
+
+	for dir, wd := range dirs {
+		opt := &fsutil.WalkOpt{}
+		if !wd.all {
+			for p := range wd.includes {
+				opt.IncludePatterns = append(opt.IncludePatterns, p)
+			}
+			sort.Strings(opt.IncludePatterns)
+		}
+		opt.ExcludePatterns = wd.excludes
+		err := fsutil.Walk(ctx, dir, opt, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				return nil
+			}
+			snap[filepath.Join(dir, path)] = fileState{size: fi.Size(), modTime: fi.ModTime(), mode: fi.Mode()}
+			return nil
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, errors.Wrapf(err, "walk %s", dir)
+		}
+	}
+	for _, f := range files {
+		fi, err := os.Lstat(f)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "stat %s", f)
+		}
+		snap[f] = fileState{size: fi.Size(), modTime: fi.ModTime(), mode: fi.Mode()}
+	}
+	return snap, nil
+}
+
+// Changed returns the sorted paths which have been added, modified or removed between the two snapshots.
+func Changed(before, after Snapshot) []string {
+	var changed []string
+	for path, st := range after {
+		if prev, ok := before[path]; !ok || prev != st {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// Wait polls the files of the Set every interval, until they have changed compared to the given baseline.
+// Once a change is detected, it keeps waiting until no further change happens for the debounce duration,
+// such that a burst of writes (e.g. a git checkout) triggers a single rebuild. It returns the changed paths.
+func (s *Set) Wait(ctx context.Context, baseline Snapshot, interval, debounce time.Duration) ([]string, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var (
+		last      = baseline
+		changedAt time.Time
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+		snap, err := s.Snapshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		if len(Changed(last, snap)) != 0 {
+			last = snap
+			changedAt = now
+			continue
+		}
+		if !changedAt.IsZero() && now.Sub(changedAt) >= debounce {
+			changed := Changed(baseline, snap)
+			if len(changed) == 0 {
+				// The files were changed and then restored; keep waiting.
+				changedAt = time.Time{}
+				continue
+			}
+			return changed, nil
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package watchutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "Earthfile"), "VERSION 0.6")
+	writeFile(t, filepath.Join(dir, "src", "main.go"), "package main")
+	writeFile(t, filepath.Join(dir, "src", "main_test.go"), "package main")
+	writeFile(t, filepath.Join(dir, "docs", "README.md"), "docs")
+
+	excludes := []string{"**/*_test.go"}
+	s := NewSet()
+	True(t, s.Empty())
+	s.AddIncludes(dir, []string{"src"}, excludes)
+	s.AddFile(filepath.Join(dir, "Earthfile"))
+	s.AddFile(filepath.Join(dir, "missing"))
+	False(t, s.Empty())
+
+	snap, err := s.Snapshot(context.Background())
+	NoError(t, err)
+	var paths []string
+	for path := range snap {
+		paths = append(paths, path)
+	}
+	ElementsMatch(t, []string{
+		filepath.Join(dir, "Earthfile"),
+		filepath.Join(dir, "src", "main.go"),
+	}, paths)
+
+	s.AddDir(dir, excludes)
+	snap2, err := s.Snapshot(context.Background())
+	NoError(t, err)
+	Equal(t, []string{filepath.Join(dir, "docs", "README.md")}, Changed(snap, snap2))
+}
+
+func TestWait(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	writeFile(t, path, "package main")
+
+	s := NewSet()
+	s.AddIncludes(dir, []string{"*.go"}, nil)
+	baseline, err := s.Snapshot(context.Background())
+	NoError(t, err)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		writeFile(t, path, "package main // changed")
+		writeFile(t, filepath.Join(dir, "other.txt"), "not watched")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	changed, err := s.Wait(ctx, baseline, 10*time.Millisecond, 50*time.Millisecond)
+	NoError(t, err)
+	Equal(t, []string{path}, changed)
+
+	cancel()
+	_, err = s.Wait(ctx, baseline, 10*time.Millisecond, 50*time.Millisecond)
+	ErrorIs(t, err, context.Canceled)
+}
+
+func TestNilSet(t *testing.T) {
+	var s *Set
+	s.AddDir("foo", nil)
+	s.AddFile("bar")
+	True(t, s.Empty())
+	snap, err := s.Snapshot(context.Background())
+	NoError(t, err)
+	Empty(t, snap)
+}
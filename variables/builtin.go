@@ -20,6 +20,9 @@ import (
 type DefaultArgs struct {
 	EarthlyVersion  string
 	EarthlyBuildSha string
+	// SourceDateEpoch is the value of EARTHLY_SOURCE_DATE_EPOCH, if set explicitly via --source-date-epoch.
+	// Otherwise, the git commit timestamp is used.
+	SourceDateEpoch string
 }
 
 // BuiltinArgs returns a scope containing the builtin args.
@@ -68,16 +71,16 @@ func BuiltinArgs(target domain.Target, platr *platutil.Resolver, gitMeta *gituti
 		ret.AddInactive(arg.EarthlyGitOriginURLScrubbed, stringutil.ScrubCredentials(gitMeta.RemoteURL))
 		ret.AddInactive(arg.EarthlyGitProjectName, getProjectName(gitMeta.RemoteURL))
 		ret.AddInactive(arg.EarthlyGitCommitTimestamp, gitMeta.Timestamp)
+	}
 
-		if gitMeta.Timestamp == "" {
-			ret.AddInactive(arg.EarthlySourceDateEpoch, "0")
-		} else {
-			ret.AddInactive(arg.EarthlySourceDateEpoch, gitMeta.Timestamp)
-		}
-	} else {
-		// Ensure SOURCE_DATE_EPOCH is always available
-		ret.AddInactive(arg.EarthlySourceDateEpoch, "0")
+	// Ensure EARTHLY_SOURCE_DATE_EPOCH is always available
+	sourceDateEpoch := "0"
+	if defaultArgs.SourceDateEpoch != "" {
+		sourceDateEpoch = defaultArgs.SourceDateEpoch
+	} else if gitMeta != nil && gitMeta.Timestamp != "" {
+		sourceDateEpoch = gitMeta.Timestamp
 	}
+	ret.AddInactive(arg.EarthlySourceDateEpoch, sourceDateEpoch)
 	return ret
 }
 
@@ -0,0 +1,19 @@
+package variables
+
+import (
+	"testing"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestParseCommandLineArgsBuiltIn(t *testing.T) {
+	_, err := ParseCommandLineArgs([]string{"EARTHLY_SOURCE_DATE_EPOCH=1234"})
+	Error(t, err)
+
+	// SOURCE_DATE_EPOCH is not a builtin arg, and may hence be passed as a regular build arg.
+	scope, err := ParseCommandLineArgs([]string{"SOURCE_DATE_EPOCH=1234"})
+	NoError(t, err)
+	v, ok := scope.GetAny("SOURCE_DATE_EPOCH")
+	True(t, ok)
+	Equal(t, "1234", v)
+}